@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const formatCombined = "combined"
+
+// combinedLogTemplate is the line template of the combined format, the
+// Combined Log Format of Apache and nginx access logs followed by the markers
+// and the payload.
+const combinedLogTemplate = `{{.IP}} - - [{{.CLFTimestamp}}] "{{.Method}} {{.Path}} HTTP/1.1" {{.Status}} {{.Size}} "{{.URL}}" "{{.UserAgent}}" {{.Payload}}`
+
+// statusStride is coprime with 100, so the lines numbered n to n+99 take
+// every slot from 0 to 99 once: every 100 lines of a pod print the status
+// code mix exactly, spread over them.
+const statusStride = 61
+
+// statusClassCodes are the codes printed for the classes of status_codes,
+// picked at random.
+var statusClassCodes = map[string][]string{
+	"1xx": {"100", "101"},
+	"2xx": {"200", "201", "204"},
+	"3xx": {"301", "302", "304"},
+	"4xx": {"400", "401", "403", "404", "429"},
+	"5xx": {"500", "502", "503", "504"},
+}
+
+// defaultStatusCodes is the status code mix of status_codes.
+var defaultStatusCodes = map[string]int{"2xx": 92, "4xx": 5, "5xx": 3}
+
+// validateStatusCodes returns the problems of status_codes, which maps
+// classes like 4xx or single codes like 404 to the percentage of the lines
+// printing them.
+func validateStatusCodes(codes map[string]int) []string {
+	var problems []string
+	total := 0
+	for _, key := range statusKeys(codes) {
+		code, err := strconv.Atoi(key)
+		if _, ok := statusClassCodes[key]; !ok && (err != nil || code < 100 || code > 599) {
+			problems = append(problems, fmt.Sprintf("Unknown status_codes key %q: must be a status code between 100 and 599 or a class from 1xx to 5xx", key))
+		}
+		if codes[key] <= 0 {
+			problems = append(problems, fmt.Sprintf("status_codes %s must be a positive percentage", key))
+		}
+		total += codes[key]
+	}
+	if total != 100 {
+		problems = append(problems, fmt.Sprintf("status_codes must add up to 100 percent, not %d", total))
+	}
+
+	return problems
+}
+
+// statusKeys returns the keys of codes in order.
+func statusKeys(codes map[string]int) []string {
+	keys := make([]string, 0, len(codes))
+	for key := range codes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// statusCodesAt returns the codes of status_codes one of which line seq of a
+// pod prints.
+func statusCodesAt(codes map[string]int, seq int) []string {
+	slot := seq * statusStride % 100
+	for _, key := range statusKeys(codes) {
+		if slot < codes[key] {
+			if classCodes, ok := statusClassCodes[key]; ok {
+				return classCodes
+			}
+			return []string{key}
+		}
+		slot -= codes[key]
+	}
+
+	return nil
+}
+
+// statusFunction defines status, which prints the status code of the line
+// numbered $lineno from codes: the keys of codes, in order, take the slots
+// of the lines in proportion to their percentages. The error lines of
+// incidents print a 5xx code instead.
+func statusFunction(codes map[string]int) string {
+	var branches []string
+	bound := 0
+	for _, key := range statusKeys(codes) {
+		bound += codes[key]
+		command := "printf " + key
+		if classCodes, ok := statusClassCodes[key]; ok {
+			command = "pick " + strings.Join(classCodes, " ")
+		}
+		branches = append(branches, fmt.Sprintf(`[ $slot -lt %d ]; then %s`, bound, command))
+	}
+
+	return fmt.Sprintf(`status() { slot=$((lineno * %d %% 100)); if [ -n "$erred" ]; then pick %s; elif %s; fi; }`,
+		statusStride, strings.Join(statusClassCodes["5xx"], " "), strings.Join(branches, "; elif "))
+}
+
+// statusPattern returns the pattern matching the status code of line seq of
+// a pod, an error line of an incident if erred.
+func statusPattern(codes map[string]int, seq int, erred bool) string {
+	if erred {
+		return "(?:" + strings.Join(statusClassCodes["5xx"], "|") + ")"
+	}
+
+	return "(?:" + strings.Join(statusCodesAt(codes, seq), "|") + ")"
+}
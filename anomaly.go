@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const defaultAnomalyOneInLines = 10000
+
+// Shell expressions of the random parts of the anomalies.
+const (
+	anomalyNumber = `$(od -An -tu2 -N2 /dev/urandom | tr -d ' ')`
+	anomalyHex    = `$(od -An -tx4 -N4 /dev/urandom | tr -d ' ')`
+)
+
+// anomalyPattern is a kind of anomaly: the name recorded in the ground
+// truth, the message as a double-quoted shell word, the most bytes of the
+// message and the pattern matching it. None of them looks like the other
+// lines of the run.
+type anomalyPattern struct {
+	name    string
+	message string
+	bytes   int
+	pattern string
+}
+
+// anomalyPatterns are the kinds of anomalies, taken in turn.
+var anomalyPatterns = []anomalyPattern{
+	{
+		name:    "go_panic",
+		message: `"panic: runtime error: index out of range [` + anomalyNumber + `] with length ` + anomalyNumber + `"`,
+		bytes:   len("panic: runtime error: index out of range [65535] with length 65535"),
+		pattern: `panic: runtime error: index out of range \[[0-9]{1,5}\] with length [0-9]{1,5}`,
+	},
+	{
+		name:    "soft_lockup",
+		message: `"watchdog: BUG: soft lockup - CPU#$((` + anomalyNumber + ` % 64)) stuck for $((` + anomalyNumber + ` % 60 + 22))s! [kworker/u16:2:` + anomalyNumber + `]"`,
+		bytes:   len("watchdog: BUG: soft lockup - CPU#63 stuck for 81s! [kworker/u16:2:65535]"),
+		pattern: `watchdog: BUG: soft lockup - CPU#[0-9]{1,2} stuck for [0-9]{2}s! \[kworker/u16:2:[0-9]{1,5}\]`,
+	},
+	{
+		name:    "segfault",
+		message: `"worker[` + anomalyNumber + `]: segfault at ` + anomalyHex + ` ip ` + anomalyHex + ` sp ` + anomalyHex + ` error 4 in libc.so.6"`,
+		bytes:   len("worker[65535]: segfault at ffffffff ip ffffffff sp ffffffff error 4 in libc.so.6"),
+		pattern: `worker\[[0-9]{1,5}\]: segfault at [0-9a-f]{8} ip [0-9a-f]{8} sp [0-9a-f]{8} error 4 in libc\.so\.6`,
+	},
+	{
+		name:    "certificate_expired",
+		message: `"tls: failed to verify certificate: x509: certificate has expired or is not yet valid: current time $(date -u +%Y-%m-%dT%H:%M:%SZ) is after 2024-01-01T00:00:00Z"`,
+		bytes:   len("tls: failed to verify certificate: x509: certificate has expired or is not yet valid: current time 2006-01-02T15:04:05Z is after 2024-01-01T00:00:00Z"),
+		pattern: `tls: failed to verify certificate: x509: certificate has expired or is not yet valid: current time [0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}Z is after 2024-01-01T00:00:00Z`,
+	},
+	{
+		name:    "disk_full",
+		message: `"write /var/lib/app/wal/` + anomalyNumber + `.log: no space left on device"`,
+		bytes:   len("write /var/lib/app/wal/65535.log: no space left on device"),
+		pattern: `write /var/lib/app/wal/[0-9]{1,5}\.log: no space left on device`,
+	},
+	{
+		name:    "checksum_mismatch",
+		message: `"checksum mismatch in block ` + anomalyNumber + ` of segment ` + anomalyHex + `: expected ` + anomalyHex + `, got ` + anomalyHex + `"`,
+		bytes:   len("checksum mismatch in block 65535 of segment ffffffff: expected ffffffff, got ffffffff"),
+		pattern: `checksum mismatch in block [0-9]{1,5} of segment [0-9a-f]{8}: expected [0-9a-f]{8}, got [0-9a-f]{8}`,
+	},
+}
+
+// Anomalies turns one line in OneInLines of every pod into a rare message
+// seen nowhere else in the run, and records every such line in
+// GroundTruthFile, so anomaly detection can be scored against it.
+type Anomalies struct {
+	OneInLines      int    `yaml:"one_in_lines"`
+	GroundTruthFile string `yaml:"ground_truth_file"`
+}
+
+// anomalous reports whether line seq of the pod numbered podNumber is an
+// anomaly. The pods are offset by their number, so short pods get their
+// share too.
+func (a *Anomalies) anomalous(podNumber, seq int) bool {
+	return (seq+podNumber)%a.OneInLines == 0
+}
+
+// patternAt returns the kind of anomaly line seq of the pod numbered
+// podNumber prints, if anomalous.
+func (a *Anomalies) patternAt(podNumber, seq int) anomalyPattern {
+	return anomalyPatterns[(seq+podNumber)/a.OneInLines%len(anomalyPatterns)]
+}
+
+// anomalyMarkerBytes returns the most bytes an anomaly adds to a line.
+func anomalyMarkerBytes() int {
+	bytes := 0
+	for _, pattern := range anomalyPatterns {
+		bytes = max(bytes, pattern.bytes)
+	}
+
+	return bytes + len(" ")
+}
+
+// markerCommand returns the shell command appending the message of the
+// anomaly to the markers in $2 on the anomalous lines, numbered in $lineno,
+// of the pod numbered after its name in $HOSTNAME.
+func (a *Anomalies) markerCommand() string {
+	branches := make([]string, len(anomalyPatterns))
+	for i, pattern := range anomalyPatterns {
+		branches[i] = fmt.Sprintf(`%d) anomaly=%s ;;`, i, pattern.message)
+	}
+
+	return fmt.Sprintf(`anomaly=$((lineno + ${HOSTNAME##*-})); if [ $((anomaly %% %[1]d)) -eq 0 ]; then case $((anomaly / %[1]d %% %[2]d)) in %[3]s esac; set -- "$1" "${2}$anomaly "; fi`,
+		a.OneInLines, len(anomalyPatterns), strings.Join(branches, " "))
+}
+
+// cutAnomalyMarker verifies that message starts with an anomaly of the kind
+// of pattern and returns the rest.
+func cutAnomalyMarker(message string, pattern anomalyPattern) (string, error) {
+	marker := regexp.MustCompile(`^` + pattern.pattern + ` `).FindString(message)
+	if marker == "" {
+		return "", fmt.Errorf("no %s anomaly", pattern.name)
+	}
+
+	return message[len(marker):], nil
+}
+
+// groundTruthRecord is a line of ground_truth_file: an anomalous line of a
+// pod, numbered like its sequence marker.
+type groundTruthRecord struct {
+	RunID     string `json:"run_id"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Seq       int    `json:"seq"`
+	Pattern   string `json:"pattern"`
+}
+
+// groundTruth appends the anomalous lines of the pods of the run to
+// ground_truth_file as JSON lines, so a resumed run adds to the records of
+// the pods it created before. A nil *groundTruth records nothing.
+type groundTruth struct {
+	path      string
+	runID     string
+	anomalies Anomalies
+	mu        sync.Mutex
+	file      *os.File
+}
+
+// openGroundTruth opens the ground truth file of anomalies for the run
+// runID, creating it if needed.
+func openGroundTruth(anomalies Anomalies, runID string) (*groundTruth, error) {
+	file, err := os.OpenFile(anomalies.GroundTruthFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &groundTruth{path: anomalies.GroundTruthFile, runID: runID, anomalies: anomalies, file: file}, nil
+}
+
+// record appends the anomalous lines among the totalLogLines lines of the pod
+// numbered podNumber, just created.
+func (g *groundTruth) record(cluster, namespace string, podNumber, totalLogLines int) {
+	if g == nil {
+		return
+	}
+
+	var data []byte
+	podName := fmt.Sprintf("logger-pod-%d", podNumber)
+	for seq := 1; seq <= totalLogLines; seq++ {
+		if !g.anomalies.anomalous(podNumber, seq) {
+			continue
+		}
+		line, err := json.Marshal(groundTruthRecord{
+			RunID:     g.runID,
+			Cluster:   cluster,
+			Namespace: namespace,
+			Pod:       podName,
+			Seq:       seq,
+			Pattern:   g.anomalies.patternAt(podNumber, seq).name,
+		})
+		if err != nil {
+			fatal("Failed to encode ground truth", "error", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// One write per pod keeps the records of concurrent pods apart.
+	if _, err := g.file.Write(data); err != nil {
+		fatal("Failed to write ground_truth_file", "path", g.path, "error", err)
+	}
+}
+
+// close closes the ground truth file.
+func (g *groundTruth) close() {
+	if g == nil {
+		return
+	}
+
+	if err := g.file.Close(); err != nil {
+		fatal("Failed to write ground_truth_file", "path", g.path, "error", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ansiColors is the number of foreground colors, 31 (red) to 36 (cyan), the
+// payloads of ansi_colors cycle through.
+const ansiColors = 6
+
+// ansiEscape returns the escape character of the ANSI sequences in format:
+// the raw byte in plain lines and its JSON escape inside the msg of json
+// lines, as JSON loggers print it.
+func ansiEscape(format string) string {
+	if format == formatJSON {
+		return `\u001b`
+	}
+
+	return "\x1b"
+}
+
+// ansiOverheadBytes returns the bytes the color and reset sequences of
+// ansi_colors add to a line of format.
+func ansiOverheadBytes(format string) int {
+	return len(ansiEscape(format)+"[31m") + len(ansiEscape(format)+"[0m")
+}
+
+// ansiColorArgs returns the command setting the reset sequence of format in
+// $sfx, which the emit functions print after the payload, and the suffix of
+// the argument $2 of emit_<format> starting the payload with the color in
+// $color.
+func ansiColorArgs(format string) (reset, start string) {
+	if format == formatJSON {
+		return `sfx='\u001b[0m'`, `'\u001b[3'"$color"m`
+	}
+
+	return `sfx="$esc[0m"`, `"$esc[3${color}m"`
+}
+
+// cutANSIColor verifies that payload is wrapped in a color and a reset
+// sequence and returns what they wrap.
+func cutANSIColor(payload string) (string, error) {
+	if len(payload) < len("\x1b[31m") || !strings.HasPrefix(payload, "\x1b[3") || payload[3] < '1' || payload[3] > '0'+ansiColors || payload[4] != 'm' {
+		return "", fmt.Errorf("no ANSI color sequence")
+	}
+	if !strings.HasSuffix(payload, "\x1b[0m") {
+		return "", fmt.Errorf("no ANSI reset sequence")
+	}
+
+	return strings.TrimSuffix(payload[len("\x1b[31m"):], "\x1b[0m"), nil
+}
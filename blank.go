@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	blankLinesEmpty      = "empty"
+	blankLinesWhitespace = "whitespace"
+)
+
+// blankLineWhitespace are the contents of the lines of the whitespace kind
+// of blank_lines, printed in turn.
+var blankLineWhitespace = []string{" ", "\t", "    ", " \t \t"}
+
+// BlankLines prints an empty or whitespace-only line before a share of the
+// lines, as applications separating their output do, to test the parsers
+// that expect every line to hold a message.
+type BlankLines struct {
+	Percent int    `yaml:"percent"`
+	Kind    string `yaml:"kind"`
+}
+
+// blankLineCommand returns the shell command printing a blank line of the
+// kind, ended like the other lines, before Percent percent of the lines,
+// spread evenly over the lines of the pod.
+func (b *BlankLines) blankLineCommand() string {
+	line := `printf '%s\n' "$cr"`
+	if b.Kind == blankLinesWhitespace {
+		cases := make([]string, len(blankLineWhitespace))
+		for i, whitespace := range blankLineWhitespace {
+			cases[i] = fmt.Sprintf(`%d) printf '%s%%s\n' "$cr";;`, i, strings.ReplaceAll(whitespace, "\t", `\t`))
+		}
+		line = fmt.Sprintf(`case $((blanks %% %d)) in %s esac`, len(blankLineWhitespace), strings.Join(cases, " "))
+	}
+
+	return fmt.Sprintf(`blanks=$((blanks + 1)); if %s; then %s; fi`, spreadCondition("blanks", b.Percent), line)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	defaultLoadCapNamespace = "default"
+	defaultLoadCapName      = "k8s-pod-log-generator-load-cap"
+
+	loadBudgetRefreshInterval = 5 * time.Second
+
+	// A claim that has not been refreshed for this long belongs to an
+	// instance that is gone and no longer counts against the cap.
+	loadBudgetClaimTTL = 1 * time.Minute
+)
+
+var invalidConfigMapKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// LoadCap is a limit on the logger pods running in a cluster shared by every
+// run and replica of the generator that uses the same ConfigMap.
+type LoadCap struct {
+	MaxRunningPods int    `yaml:"max_running_pods"`
+	Namespace      string `yaml:"namespace"`
+	Name           string `yaml:"name"`
+}
+
+// loadClaim is the entry of one instance in the load cap ConfigMap.
+type loadClaim struct {
+	ClaimedPods   int       `json:"claimed_pods"`
+	RunningPods   int       `json:"running_pods"`
+	PodsPerMinute float64   `json:"pods_per_minute"`
+	Updated       time.Time `json:"updated"`
+}
+
+// loadBudget claims a share of the load cap of a cluster for this instance.
+// Claims are written with optimistic concurrency, so the claims of all
+// instances together never exceed the cap. A nil *loadBudget allows any
+// number of pods.
+type loadBudget struct {
+	clientset *kubernetes.Clientset
+	limit     LoadCap
+	key       string
+	desired   int
+
+	claimed atomic.Int64
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+// newLoadBudget claims up to desired pods of the cap for the instance running
+// runID, or returns nil if no cap is configured.
+func newLoadBudget(clientset *kubernetes.Clientset, loadCap *LoadCap, runID string, desired int) (*loadBudget, error) {
+	if loadCap == nil {
+		return nil, nil
+	}
+
+	hostname, _ := os.Hostname()
+	b := &loadBudget{
+		clientset: clientset,
+		limit:     *loadCap,
+		key:       invalidConfigMapKeyChars.ReplaceAllString(fmt.Sprintf("%s.%s.%d", runID, hostname, os.Getpid()), "_"),
+		desired:   desired,
+		stopped:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := b.claim(0, 0); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// allowed returns the number of pods the instance may keep running.
+func (b *loadBudget) allowed() int {
+	if b == nil {
+		return math.MaxInt
+	}
+
+	return int(b.claimed.Load())
+}
+
+// claim records the running pods and creation rate of the instance and
+// claims as much of its desired pods as the other live claims leave.
+func (b *loadBudget) claim(running int, podsPerMinute float64) error {
+	configMaps := b.clientset.CoreV1().ConfigMaps(b.limit.Namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(context.TODO(), b.limit.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap, err = configMaps.Create(context.TODO(), &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: b.limit.Name},
+			}, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Another instance created it first; read it again.
+				return apierrors.NewConflict(v1.Resource("configmaps"), b.limit.Name, err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+
+		now := time.Now()
+		others := 0
+		for key, value := range configMap.Data {
+			if key == b.key {
+				continue
+			}
+			var c loadClaim
+			if err := json.Unmarshal([]byte(value), &c); err != nil || now.Sub(c.Updated) > loadBudgetClaimTTL {
+				delete(configMap.Data, key)
+				continue
+			}
+			others += c.ClaimedPods
+		}
+
+		claimed := min(b.desired, max(b.limit.MaxRunningPods-others, 0))
+		data, err := json.Marshal(loadClaim{ClaimedPods: claimed, RunningPods: running, PodsPerMinute: podsPerMinute, Updated: now})
+		if err != nil {
+			return err
+		}
+		configMap.Data[b.key] = string(data)
+
+		if _, err := configMaps.Update(context.TODO(), configMap, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+
+		if previous := b.claimed.Swap(int64(claimed)); int(previous) != claimed {
+			slog.Info("Load cap claimed", "namespace", b.limit.Namespace, "name", b.limit.Name, "claimed", claimed, "max_running_pods", b.limit.MaxRunningPods, "claimed_by_others", others)
+		}
+		return nil
+	})
+}
+
+// start refreshes the claim in the background until stop is called. running
+// returns the running pods of the instance and scheduled the number of pods
+// it scheduled so far.
+func (b *loadBudget) start(running func() int, scheduled func() int64) {
+	if b == nil {
+		return
+	}
+
+	go func() {
+		defer close(b.done)
+
+		ticker := time.NewTicker(loadBudgetRefreshInterval)
+		defer ticker.Stop()
+
+		lastScheduled := scheduled()
+		lastClaim := time.Now()
+		for {
+			select {
+			case <-b.stopped:
+				return
+			case <-ticker.C:
+			}
+
+			n := scheduled()
+			podsPerMinute := float64(n-lastScheduled) / loadBudgetRefreshInterval.Minutes()
+			lastScheduled = n
+
+			if err := b.claim(running(), podsPerMinute); err != nil {
+				slog.Warn("Failed to refresh the claim on the load cap", "namespace", b.limit.Namespace, "name", b.limit.Name, "error", err)
+
+				// Other instances stop counting a claim that is not
+				// refreshed, so stop using it as well.
+				if time.Since(lastClaim) > loadBudgetClaimTTL {
+					b.claimed.Store(0)
+				}
+				continue
+			}
+			lastClaim = time.Now()
+		}
+	}()
+}
+
+// stop stops refreshing the claim and removes it, so other instances can use
+// its share at once.
+func (b *loadBudget) stop() {
+	if b == nil {
+		return
+	}
+
+	close(b.stopped)
+	<-b.done
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := b.clientset.CoreV1().ConfigMaps(b.limit.Namespace).Get(context.TODO(), b.limit.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		delete(configMap.Data, b.key)
+		_, err = b.clientset.CoreV1().ConfigMaps(b.limit.Namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		slog.Warn("Failed to release the claim on the load cap, it expires on its own", "namespace", b.limit.Namespace, "name", b.limit.Name, "expires_in", loadBudgetClaimTTL, "error", err)
+	}
+}
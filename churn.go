@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NamespaceChurn keeps creating and deleting namespaces with logger pods in
+// them next to the namespaces of the run, to exercise the namespace metadata
+// caches of collectors and the re-lists of their watches.
+type NamespaceChurn struct {
+	Namespaces       int `yaml:"namespaces"`
+	LifetimeSeconds  int `yaml:"lifetime_seconds"`
+	PodsPerNamespace int `yaml:"pods_per_namespace"`
+}
+
+// churnedNamespaces tracks the churned namespaces alive in a cluster, so the
+// hard deadline and freeze windows reach them like the namespaces of the
+// run.
+type churnedNamespaces struct {
+	mu     sync.Mutex
+	names  map[string]bool
+	paused bool
+}
+
+func newChurnedNamespaces() *churnedNamespaces {
+	return &churnedNamespaces{names: make(map[string]bool)}
+}
+
+// add sets up namespace with setUp, told whether the loggers are paused by a
+// freeze window, and tracks it. No freeze starts or ends in between.
+func (s *churnedNamespaces) add(namespace string, setUp func(paused bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setUp(s.paused)
+	s.names[namespace] = true
+}
+
+// remove stops tracking namespace, before it is deleted.
+func (s *churnedNamespaces) remove(namespace string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.names, namespace)
+}
+
+// list returns the churned namespaces alive in order.
+func (s *churnedNamespaces) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sorted()
+}
+
+// pause records whether the loggers are paused and calls update with the
+// churned namespaces alive, so none is added or removed until it returns.
+func (s *churnedNamespaces) pause(paused bool, update func(namespaces []string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = paused
+	update(s.sorted())
+}
+
+// sorted returns the names in order. The caller must hold s.mu.
+func (s *churnedNamespaces) sorted() []string {
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// namespaceChurner runs the namespace churn of a cluster. A nil
+// *namespaceChurner does nothing.
+type namespaceChurner struct {
+	run       *clusterRun
+	clientset *kubernetes.Clientset
+	churn     NamespaceChurn
+
+	// next numbers the churned namespaces.
+	next atomic.Int64
+
+	stopped chan struct{}
+	wg      sync.WaitGroup
+}
+
+// startNamespaceChurn starts the namespace churn of run, or returns nil
+// without one. Each of the churn.Namespaces slots creates a namespace, lets
+// its pods log for churn.LifetimeSeconds, deletes it with its pods and
+// starts over; the slots are staggered so deletions are spread over the
+// lifetime.
+func startNamespaceChurn(run *clusterRun, clientset *kubernetes.Clientset, churn *NamespaceChurn) *namespaceChurner {
+	if churn == nil {
+		return nil
+	}
+
+	c := &namespaceChurner{run: run, clientset: clientset, churn: *churn, stopped: make(chan struct{})}
+	lifetime := time.Duration(churn.LifetimeSeconds) * time.Second
+	for i := 0; i < churn.Namespaces; i++ {
+		c.wg.Add(1)
+		go c.runSlot(lifetime * time.Duration(i) / time.Duration(churn.Namespaces))
+	}
+
+	return c
+}
+
+// stop stops the churn and waits for the namespaces alive to be deleted.
+func (c *namespaceChurner) stop() {
+	if c == nil {
+		return
+	}
+
+	close(c.stopped)
+	c.wg.Wait()
+}
+
+// sleep waits for d and reports whether the churn is still running.
+func (c *namespaceChurner) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-c.stopped:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (c *namespaceChurner) runSlot(delay time.Duration) {
+	defer c.wg.Done()
+
+	if !c.sleep(delay) {
+		return
+	}
+	for {
+		namespace := fmt.Sprintf("%s-churn-%d", c.run.config.NamespacePrefix, c.next.Add(1))
+		created := c.create(namespace)
+		alive := c.sleep(time.Duration(c.churn.LifetimeSeconds) * time.Second)
+		if created {
+			c.delete(namespace)
+		}
+		if !alive {
+			return
+		}
+	}
+}
+
+// create creates namespace and its logger pods, and reports whether the
+// namespace was created.
+func (c *namespaceChurner) create(namespace string) bool {
+	_, err := c.clientset.CoreV1().Namespaces().Create(context.TODO(), &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        namespace,
+			Labels:      buildNamespaceLabels(c.run.config),
+			Annotations: c.run.config.NamespaceAnnotations,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		slog.Warn("Failed to create a churned namespace", "namespace", namespace, "error", err)
+		return false
+	}
+	c.run.cluster.churned.add(namespace, func(paused bool) {
+		setUpNamespace(c.clientset, c.run.config, namespace, c.run.podLabels[runIDLabel])
+		if paused {
+			setPaused(c.clientset, []string{namespace}, true)
+		}
+	})
+
+	created := 0
+	for i := 0; i < c.churn.PodsPerNamespace; i++ {
+		// The pods take their numbers from the pods of the run, so
+		// their names and the lines numbered after them stay unique.
+		podNumber := int(c.run.podIndex.Add(1) - 1)
+		podName := fmt.Sprintf("logger-pod-%d", podNumber)
+		if err := createPod(c.clientset, namespace, podName, c.run.totalLogLines, c.run.podLabels, c.run.podSpec); err != nil {
+			slog.Warn("Failed to create a pod in a churned namespace", "namespace", namespace, "pod", podName, "error", err)
+			c.run.m.podCreationFailed(c.run.cluster.name, err)
+			continue
+		}
+		c.run.m.podCreated(c.run.cluster.name, c.run.totalLogLines, int(c.run.config.BytesPerLogLine))
+		c.run.timeline.podCreated(time.Now())
+		c.run.summary.podCreated(namespace)
+		c.run.truth.record(c.run.cluster.name, namespace, podNumber, c.run.totalLogLines)
+		created++
+	}
+	slog.Info("Churned namespace created", "cluster", c.run.cluster.name, "namespace", namespace, "pods", created)
+
+	return true
+}
+
+// delete deletes namespace together with its pods, without waiting for it
+// to terminate.
+func (c *namespaceChurner) delete(namespace string) {
+	c.run.cluster.churned.remove(namespace)
+	err := c.clientset.CoreV1().Namespaces().Delete(context.TODO(), namespace, metav1.DeleteOptions{})
+	if err != nil {
+		slog.Warn("Failed to delete a churned namespace", "namespace", namespace, "error", err)
+		return
+	}
+	slog.Info("Churned namespace deleted", "cluster", c.run.cluster.name, "namespace", namespace)
+	c.run.summary.namespaceChurned()
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultClosedLoopStepSeconds = 60
+
+// closedLoopQueryTimeout bounds every query of the saturation signal.
+const closedLoopQueryTimeout = 30 * time.Second
+
+// ClosedLoop ramps the running logger pods up step by step until a
+// saturation signal queried from Prometheus reaches a threshold, to discover
+// the highest load the logging stack sustains.
+type ClosedLoop struct {
+	PrometheusURL string  `yaml:"prometheus_url"`
+	TokenFrom     string  `yaml:"token_from"`
+	Query         string  `yaml:"query"`
+	Threshold     float64 `yaml:"threshold"`
+	InitialPods   int     `yaml:"initial_pods"`
+	StepPods      int     `yaml:"step_pods"`
+	StepSeconds   int     `yaml:"step_seconds"`
+}
+
+// loadController runs the closed loop of a cluster. A nil *loadController
+// allows any number of pods.
+type loadController struct {
+	loop        ClosedLoop
+	token       string
+	client      *http.Client
+	desired     int
+	bytesPerPod int64
+	created     func() int
+
+	limit atomic.Int64
+
+	mu sync.Mutex
+	// sustainedPods is the highest limit a whole step ran at without
+	// reaching the threshold, and sustainedBytesPerSecond the bytes the
+	// pods created during that step print per second.
+	sustainedPods           int
+	sustainedBytesPerSecond float64
+	saturated               bool
+
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+// newLoadController returns the controller of loop for a cluster running up
+// to desired pods of bytesPerPod bytes, or nil without a closed loop. created
+// returns the pods created so far.
+func newLoadController(loop *ClosedLoop, token string, desired int, bytesPerPod int64, created func() int) *loadController {
+	if loop == nil {
+		return nil
+	}
+
+	c := &loadController{
+		loop:        *loop,
+		token:       token,
+		client:      &http.Client{Timeout: closedLoopQueryTimeout},
+		desired:     desired,
+		bytesPerPod: bytesPerPod,
+		created:     created,
+		stopped:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	c.limit.Store(int64(min(loop.InitialPods, desired)))
+
+	return c
+}
+
+// allowed returns the number of pods the cluster may keep running.
+func (c *loadController) allowed() int {
+	if c == nil {
+		return math.MaxInt
+	}
+
+	return int(c.limit.Load())
+}
+
+// start ramps the limit up in the background, one step every
+// step_seconds, until the signal reaches the threshold, the limit reaches
+// the pods of the run, or stop is called. On saturation the limit falls back
+// to the last one sustained and holds there.
+func (c *loadController) start() {
+	if c == nil {
+		return
+	}
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(time.Duration(c.loop.StepSeconds) * time.Second)
+		defer ticker.Stop()
+
+		stepCreated := c.created()
+		slog.Info("Closed loop started", "running_pods", c.allowed(), "threshold", c.loop.Threshold)
+		for {
+			select {
+			case <-c.stopped:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), closedLoopQueryTimeout)
+			value, err := queryPrometheus(ctx, c.client, c.loop.PrometheusURL, c.token, c.loop.Query)
+			cancel()
+			if err != nil {
+				slog.Warn("Failed to query the saturation signal, holding the load", "error", err)
+				continue
+			}
+
+			created := c.created()
+			bytesPerSecond := float64(int64(created-stepCreated)*c.bytesPerPod) / float64(c.loop.StepSeconds)
+			stepCreated = created
+			limit := c.allowed()
+
+			if value >= c.loop.Threshold {
+				c.mu.Lock()
+				c.saturated = true
+				sustained := c.sustainedPods
+				c.mu.Unlock()
+
+				c.limit.Store(int64(sustained))
+				slog.Warn("Saturation signal reached the threshold, holding the last load sustained", "value", value, "threshold", c.loop.Threshold, "running_pods", limit, "sustained_pods", sustained)
+				return
+			}
+
+			c.mu.Lock()
+			c.sustainedPods = limit
+			c.sustainedBytesPerSecond = bytesPerSecond
+			c.mu.Unlock()
+
+			if limit >= c.desired {
+				slog.Info("Closed loop reached the pods of the run without saturation", "value", value, "running_pods", limit)
+				return
+			}
+			next := min(limit+c.loop.StepPods, c.desired)
+			c.limit.Store(int64(next))
+			slog.Info("Closed loop ramping up", "value", value, "threshold", c.loop.Threshold, "running_pods", next, "bytes_per_second", int64(bytesPerSecond))
+		}
+	}()
+}
+
+// stop stops ramping and returns the highest load sustained, its bytes per
+// second and whether the signal reached the threshold.
+func (c *loadController) stop() (sustainedPods int, bytesPerSecond float64, saturated bool) {
+	if c == nil {
+		return 0, 0, false
+	}
+
+	close(c.stopped)
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sustainedPods, c.sustainedBytesPerSecond, c.saturated
+}
+
+// queryPrometheus returns the value of the instant query: the highest sample
+// of a vector, 0 for an empty one, or the value of a scalar.
+func queryPrometheus(ctx context.Context, client *http.Client, addr, token, query string) (float64, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("query: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var parsed struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return 0, fmt.Errorf("query: %w", err)
+	}
+	if parsed.Status != "success" {
+		return 0, fmt.Errorf("query: %s", parsed.Error)
+	}
+
+	var values [][2]interface{}
+	switch parsed.Data.ResultType {
+	case "vector":
+		var samples []struct {
+			Value [2]interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(parsed.Data.Result, &samples); err != nil {
+			return 0, fmt.Errorf("query: %w", err)
+		}
+		for _, sample := range samples {
+			values = append(values, sample.Value)
+		}
+	case "scalar":
+		var value [2]interface{}
+		if err := json.Unmarshal(parsed.Data.Result, &value); err != nil {
+			return 0, fmt.Errorf("query: %w", err)
+		}
+		values = append(values, value)
+	default:
+		return 0, fmt.Errorf("query: unexpected result type %q, must be vector or scalar", parsed.Data.ResultType)
+	}
+
+	highest := 0.0
+	for i, value := range values {
+		s, _ := value[1].(string)
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("query: sample value %q: %w", s, err)
+		}
+		if i == 0 || v > highest {
+			highest = v
+		}
+	}
+	return highest, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log/slog"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/plan"
+)
+
+// ClusterConfig is one of the clusters a run fans out to.
+type ClusterConfig struct {
+	Name           string `yaml:"name"`
+	KubeconfigPath string `yaml:"kubeconfig_path"`
+	Context        string `yaml:"context"`
+	Share          int    `yaml:"share"`
+}
+
+// cluster is a connected cluster and the number of pods it must keep
+// running.
+type cluster struct {
+	name       string
+	restConfig *rest.Config
+	clientset  *kubernetes.Clientset
+	totalPods  int
+
+	// churned are the namespaces of namespace_churn alive in the cluster.
+	churned *churnedNamespaces
+}
+
+// clusterPods returns the configured clusters, or the single cluster of
+// kubeconfig_path without clusters, and splits totalPods between them
+// according to their share.
+func clusterPods(config Config, totalPods int) ([]ClusterConfig, []int) {
+	clusterConfigs := config.Clusters
+	if len(clusterConfigs) == 0 {
+		clusterConfigs = []ClusterConfig{{KubeconfigPath: config.KubeconfigPath, Share: 1}}
+	}
+
+	totalShares := 0
+	for _, cc := range clusterConfigs {
+		totalShares += cc.Share
+	}
+
+	pods := make([]int, len(clusterConfigs))
+	for i, cc := range clusterConfigs {
+		// Round every share up so the clusters together run at least
+		// totalPods.
+		p, err := plan.CeilDiv(int64(totalPods)*int64(cc.Share), int64(totalShares))
+		if err != nil {
+			fatal("Failed to plan pods of cluster", "cluster", cc.Name, "error", err)
+		}
+		pods[i] = int(p)
+	}
+
+	return clusterConfigs, pods
+}
+
+// connectClusters connects to every cluster of clusterPods.
+func connectClusters(config Config, totalPods int) []cluster {
+	clusterConfigs, pods := clusterPods(config, totalPods)
+
+	clusters := make([]cluster, len(clusterConfigs))
+	for i, cc := range clusterConfigs {
+		kubeconfig, clientset := connectCluster(config, cc)
+		clusters[i] = cluster{name: cc.Name, restConfig: kubeconfig, clientset: clientset, totalPods: pods[i], churned: newChurnedNamespaces()}
+		if cc.Name != "" {
+			slog.Info("Cluster planned", "cluster", cc.Name, "pods", pods[i])
+		}
+	}
+
+	return clusters
+}
+
+// connectCluster returns the client configuration of cc, falling back to
+// kubeconfig_path, and a client built from it.
+func connectCluster(config Config, cc ClusterConfig) (*rest.Config, *kubernetes.Clientset) {
+	kubeconfigPath := cc.KubeconfigPath
+	if kubeconfigPath == "" {
+		kubeconfigPath = config.KubeconfigPath
+	}
+
+	kubeconfig, err := buildRestConfig(kubeconfigPath, cc.Context)
+	if err != nil {
+		fatal("Error building kubeconfig of cluster", "cluster", cc.Name, "error", err)
+	}
+
+	// Zero keeps the client-go defaults (5 QPS, burst of 10).
+	if config.ClientQPS > 0 {
+		kubeconfig.QPS = config.ClientQPS
+	}
+	if config.ClientBurst > 0 {
+		kubeconfig.Burst = config.ClientBurst
+	}
+
+	clientset, err := kubernetes.NewForConfig(kubeconfig)
+	if err != nil {
+		fatal("Error creating Kubernetes client of cluster", "cluster", cc.Name, "error", err)
+	}
+
+	return kubeconfig, clientset
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+const defaultContainerImage = "busybox:1.36.1-uclibc"
+
+var defaultContainerCommand = []string{
+	"/bin/sh",
+	"-c",
+	"{{.Script}}",
+}
+
+type commandTemplateData struct {
+	TotalLogLines   int
+	BytesPerLogLine int
+	Script          string
+}
+
+func renderContainerCommand(commandTemplates []string, data commandTemplateData) ([]string, error) {
+	command := make([]string, len(commandTemplates))
+
+	for i, text := range commandTemplates {
+		tmpl, err := template.New(fmt.Sprintf("container_command[%d]", i)).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		command[i] = buf.String()
+	}
+
+	return command, nil
+}
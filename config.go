@@ -0,0 +1,1148 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/homedir"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/placement"
+	"github.com/zinrai/k8s-pod-log-generator/pkg/plan"
+)
+
+type Config struct {
+	KubeconfigPath                 string            `yaml:"kubeconfig_path"`
+	NumK8sNamespaces               int               `yaml:"num_k8s_namespaces"`
+	BytesPerLogLine                ByteSize          `yaml:"bytes_per_log_line"`
+	KilobytesPerPodLog             int               `yaml:"kilobytes_per_pod_log"`
+	MegabytesTotalLogSize          int               `yaml:"megabytes_total_log_size"`
+	RunDurationMinutes             int               `yaml:"run_duration_minutes"`
+	NamespacePrefix                string            `yaml:"namespace_prefix"`
+	ConcurrentRequests             int               `yaml:"concurrent_requests"`
+	Mode                           string            `yaml:"mode"`
+	CronSchedule                   string            `yaml:"cron_schedule"`
+	ContainerImage                 string            `yaml:"container_image"`
+	ContainerCommand               []string          `yaml:"container_command"`
+	NamespaceAssignment            string            `yaml:"namespace_assignment"`
+	ImagePullSecrets               []string          `yaml:"image_pull_secrets"`
+	ImagePullPolicy                string            `yaml:"image_pull_policy"`
+	ImagePullSecretsFrom           string            `yaml:"image_pull_secrets_namespace"`
+	Profile                        string            `yaml:"profile"`
+	Resources                      ResourcesConfig   `yaml:"resources"`
+	NodeSelector                   map[string]string `yaml:"node_selector"`
+	Affinity                       interface{}       `yaml:"affinity"`
+	SigtermBehavior                string            `yaml:"sigterm_behavior"`
+	PreStopSleepSeconds            int               `yaml:"pre_stop_sleep_seconds"`
+	TerminationGracePeriodSeconds  *int64            `yaml:"termination_grace_period_seconds"`
+	Tolerations                    interface{}       `yaml:"tolerations"`
+	TopologySpreadConstraints      interface{}       `yaml:"topology_spread_constraints"`
+	PriorityClassName              string            `yaml:"priority_class_name"`
+	CreatePriorityClass            bool              `yaml:"create_priority_class"`
+	PriorityClassValue             *int32            `yaml:"priority_class_value"`
+	FreezeWindows                  []FreezeWindow    `yaml:"freeze_windows"`
+	CatchUpStallSeconds            int               `yaml:"catch_up_stall_seconds"`
+	PodSecurityStandard            string            `yaml:"pod_security_standard"`
+	PodLabels                      map[string]string `yaml:"pod_labels"`
+	Tags                           map[string]string `yaml:"tags"`
+	NamespaceLabels                map[string]string `yaml:"namespace_labels"`
+	NamespaceAnnotations           map[string]string `yaml:"namespace_annotations"`
+	PodTemplateOverlay             interface{}       `yaml:"pod_template_overlay"`
+	HardDeadlineMinutes            int               `yaml:"hard_deadline_minutes"`
+	HardDeadlineCleanup            string            `yaml:"hard_deadline_cleanup"`
+	Placement                      string            `yaml:"placement"`
+	NamespaceWeights               []float64         `yaml:"namespace_weights"`
+	ZipfExponent                   *float64          `yaml:"zipf_exponent"`
+	Clusters                       []ClusterConfig   `yaml:"clusters"`
+	StateFile                      string            `yaml:"state_file"`
+	ClientQPS                      float32           `yaml:"client_qps"`
+	ClientBurst                    int               `yaml:"client_burst"`
+	Format                         string            `yaml:"format"`
+	FormatMigration                *FormatMigration  `yaml:"format_migration"`
+	RestartsPerPod                 int               `yaml:"restarts_per_pod"`
+	MaxConsecutiveFailures         int               `yaml:"max_consecutive_failures"`
+	ErrorPolicy                    string            `yaml:"error_policy"`
+	ErrorBudgetPercent             float64           `yaml:"error_budget_percent"`
+	MetricsTextfile                string            `yaml:"metrics_textfile"`
+	MetricsTextfileIntervalSeconds int               `yaml:"metrics_textfile_interval_seconds"`
+	SelfCheck                      *bool             `yaml:"self_check"`
+	NamespaceGroups                []NamespaceGroup  `yaml:"namespace_groups"`
+	LogReadBackPercent             int               `yaml:"log_read_back_percent"`
+	ServerDryRun                   *bool             `yaml:"server_dry_run"`
+	PodLogSize                     ByteSize          `yaml:"pod_log_size"`
+	TotalLogSize                   ByteSize          `yaml:"total_log_size"`
+	RunDuration                    Duration          `yaml:"run_duration"`
+	TimelineFile                   string            `yaml:"timeline_file"`
+	MetricsAddress                 string            `yaml:"metrics_address"`
+	LoadCap                        *LoadCap          `yaml:"load_cap"`
+	Expectations                   *Expectations     `yaml:"expectations"`
+	SizeAccounting                 string            `yaml:"size_accounting"`
+	TenantImpersonation            bool              `yaml:"tenant_impersonation"`
+	PodConfig                      *PodConfig        `yaml:"pod_config"`
+	DebugAddress                   string            `yaml:"debug_address"`
+	SequenceNumbers                bool              `yaml:"sequence_numbers"`
+	PodDisruptionBudget            bool              `yaml:"pod_disruption_budget"`
+	EmissionTimestamps             bool              `yaml:"emission_timestamps"`
+	ClosedLoop                     *ClosedLoop       `yaml:"closed_loop"`
+	StopConditions                 []StopCondition   `yaml:"stop_conditions"`
+	NamespaceChurn                 *NamespaceChurn   `yaml:"namespace_churn"`
+	ChurnRate                      float64           `yaml:"churn_rate"`
+	OOMKill                        *OOMKill          `yaml:"oom_kill"`
+	StderrPercent                  int               `yaml:"stderr_percent"`
+	LoggerContainers               []LoggerContainer `yaml:"logger_containers"`
+	InitContainerLines             int               `yaml:"init_container_lines"`
+	SidecarTailer                  bool              `yaml:"sidecar_tailer"`
+	PartialLines                   *PartialLines     `yaml:"partial_lines"`
+	LineEnding                     string            `yaml:"line_ending"`
+	InvalidBytes                   *InvalidBytes     `yaml:"invalid_bytes"`
+	ANSIColors                     bool              `yaml:"ansi_colors"`
+	Content                        string            `yaml:"content"`
+	BlankLines                     *BlankLines       `yaml:"blank_lines"`
+	DuplicateLines                 *DuplicateLines   `yaml:"duplicate_lines"`
+	TimestampPrefix                *TimestampPrefix  `yaml:"timestamp_prefix"`
+	TraceIDs                       *TraceIDs         `yaml:"trace_ids"`
+	RequestFlows                   *RequestFlows     `yaml:"request_flows"`
+	LineTemplate                   string            `yaml:"line_template"`
+	FakeFields                     []string          `yaml:"fake_fields"`
+	StatusCodes                    map[string]int    `yaml:"status_codes"`
+	Incidents                      []Incident        `yaml:"incidents"`
+	Anomalies                      *Anomalies        `yaml:"anomalies"`
+
+	affinity                  *v1.Affinity
+	tolerations               []v1.Toleration
+	topologySpreadConstraints []v1.TopologySpreadConstraint
+	podTemplateOverlay        []byte
+	formatCutover             time.Time
+	duplicateRunLines         []string
+	requestFlowSeed           string
+
+	// timestampPrefixBytes is the length of the timestamp prefix of a
+	// custom format, measured by the self-check.
+	timestampPrefixBytes int
+
+	// sequenceOffset and linesPerSecond are set on the copy of the config
+	// building the script of each of logger_containers.
+	sequenceOffset int
+	linesPerSecond int
+}
+
+type ResourcesConfig struct {
+	Requests map[string]string `yaml:"requests"`
+	Limits   map[string]string `yaml:"limits"`
+}
+
+func loadConfig(configFile string) Config {
+	configFileData, err := os.Open(configFile)
+	if err != nil {
+		fatal("Failed to open config file", "error", err)
+	}
+	defer configFileData.Close()
+
+	var config Config
+	decoder := yaml.NewDecoder(configFileData)
+	err = decoder.Decode(&config)
+	if err != nil {
+		fatal("Failed to parse config file", "error", err)
+	}
+
+	if problems := validateConfig(&config); len(problems) > 0 {
+		for _, problem := range problems {
+			slog.Error("Invalid configuration", "file", configFile, "problem", problem)
+		}
+		fatal("Configuration has problems", "file", configFile, "problems", len(problems))
+	}
+
+	return config
+}
+
+// validateCommand prints every problem of configFile and returns the exit
+// status of the validate command.
+func validateCommand(configFile string) int {
+	configFileData, err := os.ReadFile(configFile)
+	if err != nil {
+		fmt.Printf("%s: %v\n", configFile, err)
+		return 1
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(configFileData, &config); err != nil {
+		fmt.Printf("%s: %v\n", configFile, err)
+		return 1
+	}
+
+	problems := validateConfig(&config)
+	for _, problem := range problems {
+		fmt.Printf("%s: %s\n", configFile, problem)
+	}
+	if len(problems) > 0 {
+		noun := "problems"
+		if len(problems) == 1 {
+			noun = "problem"
+		}
+		fmt.Printf("%d %s found\n", len(problems), noun)
+		return 1
+	}
+
+	fmt.Printf("%s is valid\n", configFile)
+	return 0
+}
+
+// validateConfig fills in the defaults of config and returns every problem
+// found in it, each with what to change, so all of them can be fixed at once.
+func validateConfig(config *Config) []string {
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Inside a pod, an empty kubeconfig_path selects the in-cluster
+	// configuration of the service account instead.
+	if config.KubeconfigPath == "" && !runningInCluster() {
+		config.KubeconfigPath = filepath.Join(homedir.HomeDir(), ".kube", "config")
+	}
+
+	if config.NamespacePrefix == "" {
+		config.NamespacePrefix = "logger-ns"
+	}
+
+	// The sizes and the duration can also be given with units; they are
+	// converted to the scale of the numeric fields, rounding up.
+	if config.PodLogSize != 0 {
+		if config.KilobytesPerPodLog != 0 {
+			problemf("kilobytes_per_pod_log and pod_log_size are the same setting; keep only one")
+		}
+		config.KilobytesPerPodLog = ceilUnits(int64(config.PodLogSize), plan.BytesPerKilobyte)
+	}
+	if config.TotalLogSize != 0 {
+		if config.MegabytesTotalLogSize != 0 {
+			problemf("megabytes_total_log_size and total_log_size are the same setting; keep only one")
+		}
+		config.MegabytesTotalLogSize = ceilUnits(int64(config.TotalLogSize), plan.KilobytesPerMegabyte*plan.BytesPerKilobyte)
+	}
+	if config.RunDuration != 0 {
+		if config.RunDurationMinutes != 0 {
+			problemf("run_duration_minutes and run_duration are the same setting; keep only one")
+		}
+		config.RunDurationMinutes = ceilUnits(int64(config.RunDuration), int64(time.Minute))
+	}
+
+	sizeProblems := validateSizes(*config)
+	problems = append(problems, sizeProblems...)
+
+	if config.ContainerImage == "" {
+		config.ContainerImage = defaultContainerImage
+	}
+
+	if len(config.ContainerCommand) == 0 {
+		config.ContainerCommand = defaultContainerCommand
+	}
+
+	switch v1.PullPolicy(config.ImagePullPolicy) {
+	case "", v1.PullAlways, v1.PullIfNotPresent, v1.PullNever:
+	default:
+		problemf("Unknown image_pull_policy %q: must be Always, IfNotPresent or Never", config.ImagePullPolicy)
+	}
+
+	if config.PodSecurityStandard == "" {
+		config.PodSecurityStandard = podSecurityRestricted
+	}
+
+	switch config.PodSecurityStandard {
+	case podSecurityPrivileged, podSecurityBaseline, podSecurityRestricted:
+	default:
+		problemf("Unknown pod_security_standard %q: must be %s, %s or %s", config.PodSecurityStandard, podSecurityPrivileged, podSecurityBaseline, podSecurityRestricted)
+	}
+
+	if config.ImagePullSecretsFrom == "" {
+		config.ImagePullSecretsFrom = "default"
+	}
+
+	if config.Profile == "" {
+		config.Profile = profileSteady
+	}
+
+	switch config.Profile {
+	case profileSteady, profileEphemeralBurst:
+	case profileCatchUp:
+		if config.BytesPerLogLine <= catchUpTimestampBytes {
+			problemf("bytes_per_log_line must be greater than %d for the %s profile to fit the timestamp", catchUpTimestampBytes, profileCatchUp)
+		}
+		if config.CatchUpStallSeconds == 0 {
+			config.CatchUpStallSeconds = 60
+		}
+	default:
+		problemf("Unknown profile %q: must be %s, %s or %s", config.Profile, profileSteady, profileEphemeralBurst, profileCatchUp)
+	}
+
+	if config.Format == "" {
+		config.Format = formatPlain
+	}
+
+	if config.LineEnding == "" {
+		config.LineEnding = lineEndingLF
+	}
+
+	switch config.LineEnding {
+	case lineEndingLF:
+	case lineEndingCRLF, lineEndingMixed:
+		if config.Profile == profileEphemeralBurst {
+			problemf("line_ending %s is not supported with the %s profile", config.LineEnding, profileEphemeralBurst)
+		}
+		if config.LineEnding == lineEndingMixed && config.Profile != profileSteady {
+			problemf("line_ending %s is only supported with the %s profile", lineEndingMixed, profileSteady)
+		}
+	default:
+		problemf("Unknown line_ending %q: must be %s, %s or %s", config.LineEnding, lineEndingLF, lineEndingCRLF, lineEndingMixed)
+	}
+
+	if config.Content == "" {
+		config.Content = contentAlphanumeric
+	}
+
+	switch config.Content {
+	case contentAlphanumeric:
+	case contentUnicode:
+		if config.Profile == profileEphemeralBurst {
+			problemf("content %s is not supported with the %s profile", contentUnicode, profileEphemeralBurst)
+		}
+	default:
+		problemf("Unknown content %q: must be %s or %s", config.Content, contentAlphanumeric, contentUnicode)
+	}
+
+	if config.TimestampPrefix != nil {
+		switch {
+		case config.TimestampPrefix.Layout != "" && config.TimestampPrefix.Strftime != "":
+			problemf("timestamp_prefix needs layout or strftime, not both")
+		case config.TimestampPrefix.Strftime != "":
+			if strings.Contains(config.TimestampPrefix.Strftime, "'") {
+				problemf("timestamp_prefix.strftime must not contain a single quote")
+			}
+		case config.TimestampPrefix.Layout == "":
+			problemf("timestamp_prefix needs layout or strftime, e.g. layout: %s", timestampRFC3339)
+		case config.TimestampPrefix.Layout != timestampEpochMillis && timestampLayouts[config.TimestampPrefix.Layout].layout == "":
+			problemf("Unknown timestamp_prefix.layout %q: must be %s, %s or %s", config.TimestampPrefix.Layout, timestampRFC3339, timestampEpochMillis, timestampCLF)
+		}
+		if config.TimestampPrefix.OutOfOrderPercent < 0 || config.TimestampPrefix.OutOfOrderPercent > 100 {
+			problemf("timestamp_prefix.out_of_order_percent must be between 0 and 100")
+		}
+		if config.TimestampPrefix.OutOfOrderPercent > 0 {
+			if config.TimestampPrefix.OutOfOrderSeconds <= 0 {
+				problemf("timestamp_prefix.out_of_order_seconds must be positive with out_of_order_percent, e.g. out_of_order_seconds: 3600")
+			}
+			if config.Profile != profileSteady {
+				problemf("timestamp_prefix.out_of_order_percent is only supported with the %s profile", profileSteady)
+			}
+		}
+		if config.TimestampPrefix.ClockSkewSeconds < 0 {
+			problemf("timestamp_prefix.clock_skew_seconds must not be negative")
+		}
+		if config.TimestampPrefix.ClockSkewSeconds > 0 && config.Mode == "cronjob" {
+			problemf("timestamp_prefix.clock_skew_seconds is not supported when mode is cronjob, the pods are not numbered")
+		}
+		if config.Profile == profileEphemeralBurst {
+			problemf("timestamp_prefix is not supported with the %s profile", profileEphemeralBurst)
+		}
+	}
+
+	if config.ANSIColors && config.Profile == profileEphemeralBurst {
+		problemf("ansi_colors is not supported with the %s profile", profileEphemeralBurst)
+	}
+
+	if config.SizeAccounting == "" {
+		config.SizeAccounting = accountingMessage
+	}
+	if _, ok := sizeAccountings[config.SizeAccounting]; !ok {
+		problemf("Unknown size_accounting %q: must be %s, %s or %s", config.SizeAccounting, accountingMessage, accountingWire, accountingDisk)
+	}
+
+	if config.FormatMigration != nil {
+		if config.FormatMigration.AfterMinutes < 0 {
+			problemf("format_migration.after_minutes must not be negative")
+		}
+		config.formatCutover = formatCutover(*config.FormatMigration)
+	}
+
+	if config.RestartsPerPod < 0 {
+		problemf("restarts_per_pod must not be negative")
+	}
+
+	if config.RestartsPerPod > 0 {
+		if config.Profile != profileSteady {
+			problemf("restarts_per_pod is only supported with the %s profile", profileSteady)
+		}
+		if config.Mode == "cronjob" {
+			problemf("restarts_per_pod is not supported when mode is cronjob")
+		}
+	}
+
+	if config.EmissionTimestamps && config.Profile != profileSteady {
+		problemf("emission_timestamps is only supported with the %s profile, the others print lines later than they are generated", profileSteady)
+	}
+
+	for _, format := range formats(*config) {
+		switch format {
+		case formatPlain, formatJSON:
+		case formatTemplate, formatCombined:
+			if config.Profile != profileSteady {
+				problemf("The %s format is only supported with the %s profile", format, profileSteady)
+			}
+		default:
+			problemf("Unknown format %q: must be %s, %s, %s or %s", format, formatPlain, formatJSON, formatTemplate, formatCombined)
+		}
+
+		if minBytes := lineOverheadBytes(*config, format); int(config.BytesPerLogLine) <= minBytes {
+			problemf("bytes_per_log_line must be greater than %d for the %s format with the %s profile", minBytes, format, config.Profile)
+		}
+	}
+
+	if slices.Contains(formats(*config), formatTemplate) {
+		if _, _, err := renderLineTemplate(config.LineTemplate); err != nil {
+			problemf("line_template: %v", err)
+		}
+	} else if config.LineTemplate != "" {
+		problemf("line_template is only used by the %s format", formatTemplate)
+	}
+
+	if usesLineTemplates(*config) {
+		if config.StatusCodes == nil {
+			config.StatusCodes = defaultStatusCodes
+		}
+		problems = append(problems, validateStatusCodes(config.StatusCodes)...)
+	} else if config.StatusCodes != nil {
+		problemf("status_codes is only used by the %s and %s formats", formatCombined, formatTemplate)
+	}
+
+	for i, field := range config.FakeFields {
+		if value, ok := fakeValueOf(field); !ok || value.field != field {
+			problemf("Unknown fake_fields[%d] %q: must be one of %s", i, field, strings.Join(fakeFieldNames(), ", "))
+		}
+		if slices.Index(config.FakeFields, field) != i {
+			problemf("fake_fields[%d] %q is listed twice", i, field)
+		}
+	}
+	if len(config.FakeFields) > 0 {
+		if !slices.Contains(formats(*config), formatJSON) {
+			problemf("fake_fields is only used by the %s format", formatJSON)
+		}
+		if config.Profile == profileEphemeralBurst {
+			problemf("fake_fields is not supported with the %s profile", profileEphemeralBurst)
+		}
+	}
+
+	if config.CreatePriorityClass && config.PriorityClassName == "" {
+		config.PriorityClassName = defaultPriorityClassName
+	}
+
+	if config.PriorityClassValue == nil {
+		value := int32(defaultPriorityClassValue)
+		config.PriorityClassValue = &value
+	}
+
+	if config.HardDeadlineMinutes == 0 {
+		config.HardDeadlineMinutes = config.RunDurationMinutes + defaultHardDeadlineMarginMinutes
+	}
+
+	if config.HardDeadlineMinutes < 0 {
+		problemf("hard_deadline_minutes must not be negative")
+	}
+
+	if config.HardDeadlineCleanup == "" {
+		config.HardDeadlineCleanup = deadlineCleanupNone
+	}
+
+	switch config.HardDeadlineCleanup {
+	case deadlineCleanupNone, deadlineCleanupDeleteNamespaces:
+	default:
+		problemf("Unknown hard_deadline_cleanup %q: must be %s or %s", config.HardDeadlineCleanup, deadlineCleanupNone, deadlineCleanupDeleteNamespaces)
+	}
+
+	switch config.SigtermBehavior {
+	case "", sigtermExit, sigtermIgnore, sigtermLogUntilKilled:
+	default:
+		problemf("Unknown sigterm_behavior %q: must be %s, %s or %s", config.SigtermBehavior, sigtermExit, sigtermIgnore, sigtermLogUntilKilled)
+	}
+
+	if config.ErrorPolicy == "" {
+		config.ErrorPolicy = errorPolicyFailFast
+	}
+
+	switch config.ErrorPolicy {
+	case errorPolicyFailFast, errorPolicySkip:
+	case errorPolicyBudget:
+		if config.ErrorBudgetPercent <= 0 || config.ErrorBudgetPercent > 100 {
+			problemf("error_budget_percent must be greater than 0 and at most 100 when error_policy is %s", errorPolicyBudget)
+		}
+	default:
+		problemf("Unknown error_policy %q: must be %s, %s or %s", config.ErrorPolicy, errorPolicyFailFast, errorPolicySkip, errorPolicyBudget)
+	}
+
+	if config.SelfCheck == nil {
+		selfCheck := true
+		config.SelfCheck = &selfCheck
+	}
+
+	if config.LogReadBackPercent < 0 || config.LogReadBackPercent > 100 {
+		problemf("log_read_back_percent must be between 0 and 100")
+	}
+
+	if config.LogReadBackPercent > 0 && config.Mode == "cronjob" {
+		problemf("log_read_back_percent is not supported when mode is cronjob")
+	}
+
+	if config.ServerDryRun == nil {
+		serverDryRun := true
+		config.ServerDryRun = &serverDryRun
+	}
+
+	if config.LoadCap != nil {
+		if config.LoadCap.MaxRunningPods <= 0 {
+			problemf("load_cap.max_running_pods must be positive")
+		}
+		if config.LoadCap.Namespace == "" {
+			config.LoadCap.Namespace = defaultLoadCapNamespace
+		}
+		if config.LoadCap.Name == "" {
+			config.LoadCap.Name = defaultLoadCapName
+		}
+		if config.Mode == "cronjob" {
+			problemf("load_cap is not supported when mode is cronjob")
+		}
+	}
+
+	if config.ClosedLoop != nil {
+		if config.ClosedLoop.PrometheusURL == "" || config.ClosedLoop.Query == "" {
+			problemf("closed_loop needs prometheus_url and query, e.g. query: sum(rate(fluentbit_output_retries_total[1m]))")
+		}
+		if config.ClosedLoop.InitialPods <= 0 || config.ClosedLoop.StepPods <= 0 {
+			problemf("closed_loop.initial_pods and closed_loop.step_pods must be positive")
+		}
+		if config.ClosedLoop.StepSeconds < 0 {
+			problemf("closed_loop.step_seconds must not be negative")
+		}
+		if config.ClosedLoop.StepSeconds == 0 {
+			config.ClosedLoop.StepSeconds = defaultClosedLoopStepSeconds
+		}
+		if config.Mode == "cronjob" {
+			problemf("closed_loop is not supported when mode is cronjob")
+		}
+	}
+
+	if config.SidecarTailer {
+		if len(config.LoggerContainers) > 0 || config.OOMKill != nil || config.StderrPercent > 0 || config.LogReadBackPercent > 0 {
+			problemf("sidecar_tailer cannot be used together with logger_containers, oom_kill, stderr_percent or log_read_back_percent")
+		}
+	}
+
+	if config.InitContainerLines < 0 {
+		problemf("init_container_lines must not be negative")
+	}
+
+	if config.InitContainerLines > 0 {
+		if config.Profile != profileSteady || config.RestartsPerPod > 0 {
+			problemf("init_container_lines is only supported with the %s profile without restarts_per_pod", profileSteady)
+		}
+		if config.LogReadBackPercent > 0 {
+			problemf("init_container_lines and log_read_back_percent cannot be used together")
+		}
+	}
+
+	containerNames := map[string]bool{initContainerName: config.InitContainerLines > 0}
+	for i, container := range config.LoggerContainers {
+		if errs := validation.IsDNS1123Label(container.Name); len(errs) > 0 {
+			problemf("logger_containers[%d].name %q is not valid: %s", i, container.Name, strings.Join(errs, "; "))
+		}
+		if containerNames[container.Name] {
+			problemf("logger_containers[%d].name %q is used twice", i, container.Name)
+		}
+		containerNames[container.Name] = true
+		if container.LinesPerSecond < 0 {
+			problemf("logger_containers[%d].lines_per_second must not be negative", i)
+		}
+	}
+
+	if len(config.LoggerContainers) > 0 {
+		if config.Profile != profileSteady || config.RestartsPerPod > 0 {
+			problemf("logger_containers is only supported with the %s profile without restarts_per_pod", profileSteady)
+		}
+		if config.OOMKill != nil {
+			problemf("logger_containers and oom_kill cannot be used together")
+		}
+		if config.LogReadBackPercent > 0 {
+			problemf("logger_containers and log_read_back_percent cannot be used together")
+		}
+	}
+
+	if config.StderrPercent < 0 || config.StderrPercent > 100 {
+		problemf("stderr_percent must be between 0 and 100")
+	}
+
+	if config.StderrPercent > 0 && config.Profile != profileSteady {
+		problemf("stderr_percent is only supported with the %s profile", profileSteady)
+	}
+
+	if config.PartialLines != nil {
+		if config.PartialLines.Percent <= 0 || config.PartialLines.Percent > 100 {
+			problemf("partial_lines.percent must be between 1 and 100")
+		}
+		if config.PartialLines.DelayMilliseconds == 0 {
+			config.PartialLines.DelayMilliseconds = defaultPartialLineDelayMilliseconds
+		}
+		if config.PartialLines.DelayMilliseconds < 0 {
+			problemf("partial_lines.delay_milliseconds must be positive")
+		}
+		if config.Profile != profileSteady {
+			problemf("partial_lines is only supported with the %s profile", profileSteady)
+		}
+	}
+
+	if config.InvalidBytes != nil {
+		if config.InvalidBytes.Percent <= 0 || config.InvalidBytes.Percent > 100 {
+			problemf("invalid_bytes.percent must be between 1 and 100")
+		}
+		if config.InvalidBytes.Kind == "" {
+			config.InvalidBytes.Kind = invalidBytesUTF8
+		}
+		if _, ok := invalidByteRanges[config.InvalidBytes.Kind]; !ok {
+			problemf("Unknown invalid_bytes.kind %q: must be %s or %s", config.InvalidBytes.Kind, invalidBytesUTF8, invalidBytesControl)
+		}
+		if config.Profile != profileSteady {
+			problemf("invalid_bytes is only supported with the %s profile", profileSteady)
+		}
+	}
+
+	if config.BlankLines != nil {
+		if config.BlankLines.Percent <= 0 || config.BlankLines.Percent > 100 {
+			problemf("blank_lines.percent must be between 1 and 100")
+		}
+		if config.BlankLines.Kind == "" {
+			config.BlankLines.Kind = blankLinesEmpty
+		}
+		switch config.BlankLines.Kind {
+		case blankLinesEmpty, blankLinesWhitespace:
+		default:
+			problemf("Unknown blank_lines.kind %q: must be %s or %s", config.BlankLines.Kind, blankLinesEmpty, blankLinesWhitespace)
+		}
+		if config.Profile != profileSteady {
+			problemf("blank_lines is only supported with the %s profile", profileSteady)
+		}
+	}
+
+	if config.DuplicateLines != nil {
+		if config.DuplicateLines.Percent <= 0 || config.DuplicateLines.Percent > 100 {
+			problemf("duplicate_lines.percent must be between 1 and 100")
+		}
+		if config.DuplicateLines.Scope == "" {
+			config.DuplicateLines.Scope = duplicateLinesPod
+		}
+		switch config.DuplicateLines.Scope {
+		case duplicateLinesPod:
+		case duplicateLinesRun:
+			if bytes := int(config.BytesPerLogLine) * duplicateRunLineCount; bytes > maxDuplicateRunBytes {
+				problemf("duplicate_lines.scope %s puts %d lines of bytes_per_log_line in the command of every pod, %d bytes; lower bytes_per_log_line to at most %d", duplicateLinesRun, duplicateRunLineCount, bytes, maxDuplicateRunBytes/duplicateRunLineCount)
+			}
+			if config.LineEnding == lineEndingMixed {
+				problemf("duplicate_lines.scope %s is not supported with line_ending %s", duplicateLinesRun, lineEndingMixed)
+			}
+			if usesLineTemplates(*config) {
+				problemf("duplicate_lines.scope %s is not supported with the %s and %s formats", duplicateLinesRun, formatTemplate, formatCombined)
+			}
+			if len(config.FakeFields) > 0 {
+				problemf("duplicate_lines.scope %s is not supported with fake_fields", duplicateLinesRun)
+			}
+			config.duplicateRunLines = generateDuplicateRunLines(*config)
+		default:
+			problemf("Unknown duplicate_lines.scope %q: must be %s or %s", config.DuplicateLines.Scope, duplicateLinesPod, duplicateLinesRun)
+		}
+		if config.Profile != profileSteady {
+			problemf("duplicate_lines is only supported with the %s profile", profileSteady)
+		}
+	}
+
+	if config.TraceIDs != nil {
+		if config.TraceIDs.LinesPerTrace == 0 {
+			config.TraceIDs.LinesPerTrace = defaultLinesPerTrace
+		}
+		if config.TraceIDs.LinesPerSpan == 0 {
+			config.TraceIDs.LinesPerSpan = config.TraceIDs.LinesPerTrace
+		}
+		if config.TraceIDs.LinesPerTrace < 0 || config.TraceIDs.LinesPerSpan < 0 {
+			problemf("trace_ids.lines_per_trace and trace_ids.lines_per_span must be positive")
+		}
+		if config.TraceIDs.LinesPerTrace%max(config.TraceIDs.LinesPerSpan, 1) != 0 {
+			problemf("trace_ids.lines_per_span must divide trace_ids.lines_per_trace, so no span is shared by two traces")
+		}
+		if config.Profile != profileSteady {
+			problemf("trace_ids is only supported with the %s profile", profileSteady)
+		}
+	}
+
+	if config.RequestFlows != nil {
+		if len(config.RequestFlows.Tiers) == 0 {
+			config.RequestFlows.Tiers = defaultRequestFlowTiers
+		}
+		for i, tier := range config.RequestFlows.Tiers {
+			if errs := validation.IsDNS1123Label(tier); len(errs) > 0 {
+				problemf("request_flows.tiers[%d] %q is not valid: %s", i, tier, strings.Join(errs, "; "))
+			}
+		}
+		if config.RequestFlows.LinesPerRequest == 0 {
+			config.RequestFlows.LinesPerRequest = 1
+		}
+		if config.RequestFlows.LinesPerRequest < 0 {
+			problemf("request_flows.lines_per_request must be positive")
+		}
+		if config.Profile != profileSteady || config.RestartsPerPod > 0 || len(config.LoggerContainers) > 0 || config.InitContainerLines > 0 {
+			problemf("request_flows is only supported with the %s profile without restarts_per_pod, logger_containers or init_container_lines", profileSteady)
+		}
+		if config.Mode == "cronjob" {
+			problemf("request_flows is not supported when mode is cronjob, the pods are not numbered")
+		}
+		config.requestFlowSeed = generateRequestFlowSeed()
+	}
+
+	for i := range config.Incidents {
+		incident := &config.Incidents[i]
+		if incident.StartMinute < 0 || incident.DurationMinutes <= 0 {
+			problemf("incidents[%d]: start_minute must not be negative and duration_minutes must be positive", i)
+		}
+		if incident.PodsPercent <= 0 || incident.PodsPercent > 100 {
+			problemf("incidents[%d].pods_percent must be between 1 and 100", i)
+		}
+		if incident.ErrorPercent == 0 {
+			incident.ErrorPercent = defaultIncidentErrorPercent
+		}
+		if incident.ErrorPercent < 0 || incident.ErrorPercent > 100 {
+			problemf("incidents[%d].error_percent must be between 1 and 100", i)
+		}
+	}
+	if len(config.Incidents) > 0 {
+		if config.Profile != profileSteady {
+			problemf("incidents is only supported with the %s profile", profileSteady)
+		}
+		if config.Mode == "cronjob" {
+			problemf("incidents is not supported when mode is cronjob, the pods are not numbered")
+		}
+	}
+
+	if config.Anomalies != nil {
+		if config.Anomalies.OneInLines == 0 {
+			config.Anomalies.OneInLines = defaultAnomalyOneInLines
+		}
+		if config.Anomalies.OneInLines < 0 {
+			problemf("anomalies.one_in_lines must be positive")
+		}
+		if config.Profile != profileSteady || config.RestartsPerPod > 0 || len(config.LoggerContainers) > 0 || config.InitContainerLines > 0 || config.OOMKill != nil || config.SigtermBehavior == sigtermLogUntilKilled {
+			problemf("anomalies is only supported with the %s profile without restarts_per_pod, logger_containers, init_container_lines, oom_kill or sigterm_behavior %s, so the ground truth holds every line printed", profileSteady, sigtermLogUntilKilled)
+		}
+		if config.Mode == "cronjob" {
+			problemf("anomalies is not supported when mode is cronjob, the pods are not numbered")
+		}
+	}
+
+	if config.OOMKill != nil {
+		if config.OOMKill.PodsPercent <= 0 || config.OOMKill.PodsPercent > 100 {
+			problemf("oom_kill.pods_percent must be between 1 and 100")
+		}
+		if config.OOMKill.MemoryLimit == "" {
+			config.OOMKill.MemoryLimit = defaultOOMKillMemoryLimit
+		}
+		if _, err := resource.ParseQuantity(config.OOMKill.MemoryLimit); err != nil {
+			problemf("oom_kill.memory_limit: %v", err)
+		}
+		if config.OOMKill.AtPercent == 0 {
+			config.OOMKill.AtPercent = defaultOOMKillAtPercent
+		}
+		if config.OOMKill.AtPercent < 0 || config.OOMKill.AtPercent > 100 {
+			problemf("oom_kill.at_percent must be between 1 and 100")
+		}
+		if config.Profile != profileSteady || config.RestartsPerPod > 0 {
+			problemf("oom_kill is only supported with the %s profile without restarts_per_pod", profileSteady)
+		}
+		if config.Mode == "cronjob" {
+			problemf("oom_kill is not supported when mode is cronjob")
+		}
+	}
+
+	if config.ChurnRate < 0 || config.ChurnRate > 1 {
+		problemf("churn_rate must be between 0 and 1")
+	}
+
+	if config.ChurnRate > 0 && config.Mode == "cronjob" {
+		problemf("churn_rate is not supported when mode is cronjob")
+	}
+
+	if config.NamespaceChurn != nil {
+		if config.NamespaceChurn.Namespaces <= 0 || config.NamespaceChurn.LifetimeSeconds <= 0 {
+			problemf("namespace_churn.namespaces and namespace_churn.lifetime_seconds must be positive")
+		}
+		if config.NamespaceChurn.PodsPerNamespace < 0 {
+			problemf("namespace_churn.pods_per_namespace must not be negative")
+		}
+		if config.NamespaceChurn.PodsPerNamespace == 0 {
+			config.NamespaceChurn.PodsPerNamespace = 1
+		}
+		if config.Mode == "cronjob" {
+			problemf("namespace_churn is not supported when mode is cronjob")
+		}
+	}
+
+	for i, condition := range config.StopConditions {
+		if condition.Name == "" || condition.PrometheusURL == "" || condition.Query == "" {
+			problemf("stop_conditions[%d] needs name, prometheus_url and query", i)
+		}
+	}
+	if len(config.StopConditions) > 0 && config.Mode == "cronjob" {
+		problemf("stop_conditions is not supported when mode is cronjob")
+	}
+
+	if config.PodConfig != nil {
+		if config.PodConfig.ConfigMapKeys < 0 || config.PodConfig.SecretKeys < 0 {
+			problemf("pod_config.config_map_keys and pod_config.secret_keys must not be negative")
+		}
+		if config.PodConfig.ConfigMapKeys == 0 && config.PodConfig.SecretKeys == 0 {
+			problemf("pod_config needs config_map_keys or secret_keys, e.g. config_map_keys: 5")
+		}
+		if config.PodConfig.ValueBytes == 0 {
+			config.PodConfig.ValueBytes = defaultPodConfigValueBytes
+		}
+		if config.PodConfig.ValueBytes < 0 {
+			problemf("pod_config.value_bytes must be positive")
+		}
+		if keys := max(config.PodConfig.ConfigMapKeys, config.PodConfig.SecretKeys); keys*config.PodConfig.ValueBytes > maxPodConfigBytes {
+			problemf("pod_config holds %d keys of %d bytes, more than the %d bytes a ConfigMap or Secret can hold; lower the keys or value_bytes", keys, config.PodConfig.ValueBytes, maxPodConfigBytes)
+		}
+	}
+
+	if config.MetricsTextfileIntervalSeconds == 0 {
+		config.MetricsTextfileIntervalSeconds = defaultMetricsTextfileIntervalSeconds
+	}
+
+	if config.MetricsTextfileIntervalSeconds < 0 {
+		problemf("metrics_textfile_interval_seconds must not be negative")
+	}
+
+	if config.MaxConsecutiveFailures == 0 {
+		config.MaxConsecutiveFailures = defaultMaxConsecutiveFailures
+	}
+
+	if config.MaxConsecutiveFailures < 0 {
+		problemf("max_consecutive_failures must not be negative")
+	}
+
+	if config.ClientQPS < 0 || config.ClientBurst < 0 {
+		problemf("client_qps and client_burst must not be negative")
+	}
+
+	clusterNames := make(map[string]bool)
+	for i := range config.Clusters {
+		cc := &config.Clusters[i]
+		if cc.Name == "" {
+			problemf("clusters[%d]: name is required", i)
+		}
+		if clusterNames[cc.Name] {
+			problemf("clusters[%d]: duplicate name %q", i, cc.Name)
+		}
+		clusterNames[cc.Name] = true
+
+		if cc.Share == 0 {
+			cc.Share = 1
+		}
+		if cc.Share < 0 {
+			problemf("clusters[%d]: share must not be negative", i)
+		}
+	}
+
+	// namespace_assignment predates placement and is kept as an alias.
+	if config.Placement == "" {
+		config.Placement = config.NamespaceAssignment
+	}
+
+	if config.Placement == "" {
+		config.Placement = placement.Random
+	}
+
+	if !slices.Contains(placement.Names(), config.Placement) {
+		problemf("Unknown placement %q: must be one of %s", config.Placement, strings.Join(placement.Names(), ", "))
+	}
+
+	if len(config.NamespaceWeights) > 0 && config.Placement != placement.Weighted {
+		problemf("namespace_weights is only used when placement is %s", placement.Weighted)
+	}
+
+	if config.ZipfExponent != nil && config.Placement != placement.Zipf {
+		problemf("zipf_exponent is only used when placement is %s", placement.Zipf)
+	}
+
+	if config.ZipfExponent != nil && *config.ZipfExponent < 0 {
+		problemf("zipf_exponent must not be negative")
+	}
+
+	if config.ZipfExponent == nil {
+		zipfExponent := 1.0
+		config.ZipfExponent = &zipfExponent
+	}
+
+	if len(config.NamespaceWeights) > 0 && len(config.NamespaceWeights) != config.NumK8sNamespaces {
+		problemf("namespace_weights has %d weights, need one per namespace (%d)", len(config.NamespaceWeights), config.NumK8sNamespaces)
+	}
+
+	groupNames := make(map[string]bool)
+	groupedNamespaces := 0
+	for i := range config.NamespaceGroups {
+		group := &config.NamespaceGroups[i]
+		if group.Name == "" {
+			problemf("namespace_groups[%d]: name is required", i)
+		}
+		if groupNames[group.Name] {
+			problemf("namespace_groups[%d]: duplicate name %q", i, group.Name)
+		}
+		groupNames[group.Name] = true
+
+		if group.Namespaces <= 0 {
+			problemf("namespace_groups[%d]: namespaces must be positive", i)
+		}
+		groupedNamespaces += group.Namespaces
+
+		if group.StartMinute < 0 || group.DurationMinutes <= 0 || group.StartMinute+group.DurationMinutes > config.RunDurationMinutes {
+			problemf("namespace_groups[%d]: start_minute must not be negative, duration_minutes must be positive, and the group must end within run_duration_minutes", i)
+		}
+
+		// By default, a group receives pods in proportion to its namespaces.
+		if group.Share == 0 {
+			group.Share = group.Namespaces
+		}
+		if group.Share < 0 {
+			problemf("namespace_groups[%d]: share must not be negative", i)
+		}
+	}
+
+	if len(config.NamespaceGroups) > 0 && groupedNamespaces != config.NumK8sNamespaces {
+		problemf("namespace_groups hold %d namespaces, must add up to num_k8s_namespaces (%d)", groupedNamespaces, config.NumK8sNamespaces)
+	}
+
+	sort.Slice(config.FreezeWindows, func(i, j int) bool {
+		return config.FreezeWindows[i].StartMinute < config.FreezeWindows[j].StartMinute
+	})
+	for _, window := range config.FreezeWindows {
+		if window.StartMinute < 0 || window.DurationMinutes <= 0 {
+			problemf("Invalid freeze window %+v: start_minute must not be negative and duration_minutes must be positive", window)
+		} else if window.DurationMinutes < minFreezeWindowMinutes {
+			problemf("Invalid freeze window %+v: duration_minutes must be at least %d, the kubelet takes up to about 90 seconds to pass the pause on to the loggers", window, minFreezeWindowMinutes)
+		}
+	}
+
+	if config.Mode == "" {
+		config.Mode = "loop"
+	}
+
+	switch config.Mode {
+	case "loop":
+	case "cronjob":
+		if config.CronSchedule == "" {
+			problemf("cron_schedule is required when mode is cronjob")
+		}
+		if len(config.FreezeWindows) > 0 {
+			problemf("freeze_windows is not supported when mode is cronjob")
+		}
+		if config.StateFile != "" {
+			problemf("state_file is not supported when mode is cronjob")
+		}
+		if len(config.NamespaceGroups) > 0 {
+			problemf("namespace_groups is not supported when mode is cronjob")
+		}
+		if config.TimelineFile != "" {
+			problemf("timeline_file is not supported when mode is cronjob")
+		}
+		if config.Expectations != nil {
+			problemf("expectations is not supported when mode is cronjob")
+		}
+		if config.TenantImpersonation {
+			problemf("tenant_impersonation is not supported when mode is cronjob")
+		}
+		if config.PodDisruptionBudget {
+			problemf("pod_disruption_budget is not supported when mode is cronjob")
+		}
+	default:
+		problemf("Unknown mode %q: must be loop or cronjob", config.Mode)
+	}
+
+	if _, err := parseResourceList(config.Resources.Requests); err != nil {
+		problemf("Invalid resources.requests: %v", err)
+	}
+
+	if _, err := parseResourceList(config.Resources.Limits); err != nil {
+		problemf("Invalid resources.limits: %v", err)
+	}
+
+	if config.Affinity != nil {
+		config.affinity = &v1.Affinity{}
+		if err := decodeKubeObject(config.Affinity, config.affinity); err != nil {
+			problemf("Invalid affinity: %v", err)
+		}
+	}
+
+	if config.Tolerations != nil {
+		if err := decodeKubeObject(config.Tolerations, &config.tolerations); err != nil {
+			problemf("Invalid tolerations: %v", err)
+		}
+	}
+
+	if config.TopologySpreadConstraints != nil {
+		if err := decodeKubeObject(config.TopologySpreadConstraints, &config.topologySpreadConstraints); err != nil {
+			problemf("Invalid topology_spread_constraints: %v", err)
+		}
+	}
+
+	if config.PodTemplateOverlay != nil {
+		overlay, err := decodePodSpecOverlay(config.PodTemplateOverlay)
+		if err != nil {
+			problemf("Invalid pod_template_overlay: %v", err)
+		}
+		config.podTemplateOverlay = overlay
+	}
+
+	if len(sizeProblems) == 0 {
+		problems = append(problems, validateSequenceMarker(*config)...)
+	}
+
+	return problems
+}
+
+func parseResourceList(quantities map[string]string) (v1.ResourceList, error) {
+	if len(quantities) == 0 {
+		return nil, nil
+	}
+
+	resources := make(v1.ResourceList, len(quantities))
+	for name, value := range quantities {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		resources[v1.ResourceName(name)] = quantity
+	}
+
+	return resources, nil
+}
+
+// decodeKubeObject converts a value decoded from the config file into a
+// Kubernetes API type, so that sections like affinity can be written exactly
+// as in a pod manifest.
+func decodeKubeObject(raw interface{}, out interface{}) error {
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	return sigsyaml.UnmarshalStrict(data, out)
+}
+
+// Values of size_accounting, the bytes of a line that count towards the sizes.
+const (
+	accountingMessage = "message"
+	accountingWire    = "wire"
+	accountingDisk    = "disk"
+)
+
+var sizeAccountings = map[string]plan.Accounting{
+	accountingMessage: plan.AccountMessage,
+	accountingWire:    plan.AccountWire,
+	accountingDisk:    plan.AccountDisk,
+}
+
+// planRun sizes the pods and lines of a run of config.
+func planRun(config Config) (plan.Plan, error) {
+	return plan.New(plan.Input{
+		BytesPerLine:    int64(config.BytesPerLogLine),
+		KilobytesPerPod: int64(config.KilobytesPerPodLog),
+		MegabytesTotal:  int64(config.MegabytesTotalLogSize),
+		Accounting:      sizeAccountings[config.SizeAccounting],
+	})
+}
+
+// validateSizes checks the settings that size the run, which plan.New and the
+// namespace names are computed from.
+func validateSizes(config Config) []string {
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	type setting struct {
+		name    string
+		value   int
+		example string
+	}
+	positive := []setting{
+		{"num_k8s_namespaces", config.NumK8sNamespaces, "num_k8s_namespaces: 10"},
+		{"bytes_per_log_line", int(config.BytesPerLogLine), "bytes_per_log_line: 512B"},
+		{"kilobytes_per_pod_log or pod_log_size", config.KilobytesPerPodLog, "pod_log_size: 200KiB"},
+		{"megabytes_total_log_size or total_log_size", config.MegabytesTotalLogSize, "total_log_size: 10GiB"},
+		{"concurrent_requests", config.ConcurrentRequests, "concurrent_requests: 10"},
+	}
+	if config.Mode != "cronjob" {
+		positive = append(positive, setting{"run_duration_minutes or run_duration", config.RunDurationMinutes, "run_duration: 30m"})
+	}
+	valid := true
+	for _, p := range positive {
+		if p.value <= 0 {
+			problemf("%s must be positive, e.g. %s", p.name, p.example)
+			valid = false
+		}
+	}
+	if !valid {
+		return problems
+	}
+
+	if int(config.BytesPerLogLine) > config.KilobytesPerPodLog*1024 {
+		problemf("bytes_per_log_line (%d) is more than kilobytes_per_pod_log (%d KiB), so every pod prints a single line larger than asked; lower bytes_per_log_line or raise kilobytes_per_pod_log to at least %d", config.BytesPerLogLine, config.KilobytesPerPodLog, (config.BytesPerLogLine+1023)/1024)
+	}
+
+	runPlan, err := planRun(config)
+	if err != nil {
+		problemf("The sizes cannot be planned: %v; lower megabytes_total_log_size or kilobytes_per_pod_log", err)
+	} else if int64(config.ConcurrentRequests) > runPlan.Pods {
+		problemf("concurrent_requests (%d) is more than the %d pods of the run, the extra workers never create a pod; lower concurrent_requests to at most %d", config.ConcurrentRequests, runPlan.Pods, runPlan.Pods)
+	}
+
+	if err == nil && int64(config.InitContainerLines) >= runPlan.LinesPerPod {
+		problemf("init_container_lines (%d) must be less than the %d lines of a pod", config.InitContainerLines, runPlan.LinesPerPod)
+	}
+
+	longestName := fmt.Sprintf("%s-%d", config.NamespacePrefix, config.NumK8sNamespaces)
+	if errs := validation.IsDNS1123Label(longestName); len(errs) > 0 {
+		problemf("namespace_prefix %q gives namespace names like %q, which are not valid: %s", config.NamespacePrefix, longestName, strings.Join(errs, "; "))
+	}
+
+	return problems
+}
+
+// validateSequenceMarker checks that the lines of config, whose sizes are
+// valid and whose other settings have their defaults, fit the sequence
+// marker of sequence_numbers.
+func validateSequenceMarker(config Config) []string {
+	runPlan, err := planRun(config)
+	if err != nil || !config.SequenceNumbers {
+		return nil
+	}
+
+	var problems []string
+	markerBytes := len(sequenceMarker(strings.Repeat("x", maxPodNameBytes), int(runPlan.LinesPerPod)))
+	for _, format := range formats(config) {
+		if minBytes := lineOverheadBytes(config, format) + markerBytes; int(config.BytesPerLogLine) <= minBytes {
+			problems = append(problems, fmt.Sprintf("bytes_per_log_line must be greater than %d for the %s format to fit the sequence marker of %d lines per pod", minBytes, format, runPlan.LinesPerPod))
+		}
+	}
+
+	return problems
+}
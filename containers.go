@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+)
+
+const (
+	loggerContainerName = "logger-container"
+	initContainerName   = "logger-init"
+)
+
+// LoggerContainer is one of several logger containers of a pod, each with
+// its own log stream.
+type LoggerContainer struct {
+	Name           string `yaml:"name"`
+	Format         string `yaml:"format"`
+	LinesPerSecond int    `yaml:"lines_per_second"`
+}
+
+// containerLines returns the lines the i-th of n logger containers prints
+// and the lines the containers before it print, so that together they print
+// the totalLogLines of the pod.
+func containerLines(totalLogLines, n, i int) (lines, before int) {
+	lines = totalLogLines / n
+	before = i*lines + min(i, totalLogLines%n)
+	if i < totalLogLines%n {
+		lines++
+	}
+
+	return lines, before
+}
+
+// containerConfig returns config as seen by the script of container: its
+// format, if set, replaces the format of the run and its format migration.
+func containerConfig(config Config, container LoggerContainer) Config {
+	local := config
+	if container.Format != "" {
+		local.Format = container.Format
+		local.FormatMigration = nil
+	}
+	local.linesPerSecond = container.LinesPerSecond
+
+	return local
+}
+
+// initContainerConfig returns config as seen by the script of the init
+// container, which prints the first init_container_lines lines of the pod
+// in one go, before any container starts.
+func initContainerConfig(config Config) Config {
+	local := config
+	local.FormatMigration = nil
+	local.FreezeWindows = nil
+	local.SigtermBehavior = ""
+	local.OOMKill = nil
+	local.StderrPercent = 0
+	local.PartialLines = nil
+	local.InvalidBytes = nil
+	local.BlankLines = nil
+	local.DuplicateLines = nil
+	local.SidecarTailer = false
+	local.sequenceOffset = 0
+	local.linesPerSecond = 0
+
+	return local
+}
+
+// buildInitContainer returns the init container of config, a copy of base
+// running the container_command rendered with the script of the first
+// init_container_lines lines of the pod.
+func buildInitContainer(config Config, base v1.Container) (v1.Container, error) {
+	command, err := renderContainerCommand(config.ContainerCommand, commandTemplateData{
+		TotalLogLines:   config.InitContainerLines,
+		BytesPerLogLine: int(config.BytesPerLogLine),
+		Script:          buildScript(initContainerConfig(config), config.InitContainerLines),
+	})
+	if err != nil {
+		return v1.Container{}, fmt.Errorf("container %s: %w", initContainerName, err)
+	}
+
+	container := *base.DeepCopy()
+	container.Name = initContainerName
+	container.Command = command
+	container.Lifecycle = nil
+
+	return container, nil
+}
+
+// podContainers returns the names of the containers printing the lines of a
+// pod, in the order they print them.
+func podContainers(config Config) []string {
+	var names []string
+	if config.InitContainerLines > 0 {
+		names = append(names, initContainerName)
+	}
+	if config.SidecarTailer {
+		return append(names, sidecarContainerName)
+	}
+	if len(config.LoggerContainers) == 0 {
+		return append(names, loggerContainerName)
+	}
+	for _, container := range config.LoggerContainers {
+		names = append(names, container.Name)
+	}
+
+	return names
+}
+
+// buildLoggerContainers returns the logger containers of config, copies of
+// base running the container_command rendered with their own script. The
+// containers share the totalLogLines lines after the first offset lines of
+// the pod and number their sequence markers on from each other.
+func buildLoggerContainers(config Config, totalLogLines, offset int, base v1.Container) ([]v1.Container, error) {
+	containers := make([]v1.Container, len(config.LoggerContainers))
+	for i, loggerContainer := range config.LoggerContainers {
+		lines, before := containerLines(totalLogLines, len(config.LoggerContainers), i)
+		local := containerConfig(config, loggerContainer)
+		local.sequenceOffset = offset + before
+
+		command, err := renderContainerCommand(config.ContainerCommand, commandTemplateData{
+			TotalLogLines:   lines,
+			BytesPerLogLine: int(config.BytesPerLogLine),
+			Script:          buildScript(local, lines),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %w", loggerContainer.Name, err)
+		}
+
+		container := *base.DeepCopy()
+		container.Name = loggerContainer.Name
+		container.Command = command
+		containers[i] = container
+	}
+
+	return containers, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	contentAlphanumeric = "alphanumeric"
+	contentUnicode      = "unicode"
+)
+
+// unicodeTokenBytes is the size of every token of the unicode content: four
+// characters of three bytes, or three emoji of four bytes.
+const unicodeTokenBytes = 12
+
+// unicodeTokens are the tokens of the unicode content, picked by the random
+// letters a, b, c, ... in turn.
+var unicodeTokens = []string{
+	"日本語版", "東京都庁", "中文测试", "漢字変換", "한국어로", "数据处理", "日志收集", "文字化け",
+	"🚀🔥🎉", "😀😂🥲", "🐳📦🧪", "🌏🌸🍣", "🐛💥🚨", "📈📉📊", "🔒🔑🧩", "🎵🎶🎧",
+}
+
+// payloadFunction defines payload, which prints $1 random bytes of the
+// content of config: alphanumerics, or with the unicode content, random
+// unicodeTokens followed by the alphanumerics left to fill the bytes, so a
+// line has fewer characters than bytes.
+func payloadFunction(config Config) string {
+	if config.Content != contentUnicode {
+		return `payload() { cat /dev/urandom | tr -dc 'a-zA-Z0-9' | head -c $1; }`
+	}
+
+	replacements := make([]string, len(unicodeTokens))
+	for i, token := range unicodeTokens {
+		replacements[i] = fmt.Sprintf("s/%c/%s/g", 'a'+i, token)
+	}
+
+	return fmt.Sprintf(`payload() { printf '%%s' "$(cat /dev/urandom | tr -dc 'a-%[1]c' | head -c $(($1 / %[2]d)) | sed '%[3]s')"; cat /dev/urandom | tr -dc 'a-zA-Z0-9' | head -c $(($1 %% %[2]d)); }`,
+		'a'+len(unicodeTokens)-1, unicodeTokenBytes, strings.Join(replacements, "; "))
+}
+
+// checkPayload verifies that payload, the random part of a plain line, has
+// the content of config.
+func checkPayload(config Config, payload string) error {
+	if config.Content == contentUnicode {
+		tokens := strings.TrimRight(payload, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+		if !utf8.ValidString(tokens) || len(payload)-len(tokens) >= unicodeTokenBytes {
+			return fmt.Errorf("not unicode tokens")
+		}
+		for _, token := range unicodeTokens {
+			tokens = strings.ReplaceAll(tokens, token, "")
+		}
+		if tokens != "" {
+			return fmt.Errorf("not unicode tokens")
+		}
+		return nil
+	}
+
+	for _, c := range payload {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return fmt.Errorf("not alphanumeric")
+		}
+	}
+
+	return nil
+}
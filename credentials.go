@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// readCredential returns the credential ref points to:
+//
+//   - env:NAME reads the environment variable NAME,
+//   - file:PATH reads the file PATH, without its trailing newline,
+//   - secret:NAMESPACE/NAME/KEY reads KEY of the Secret NAME with clientset.
+//
+// Errors name ref but never the credential, so they can be logged.
+func readCredential(ref string, clientset *kubernetes.Clientset) (string, error) {
+	source, location, ok := strings.Cut(ref, ":")
+	if !ok {
+		return "", fmt.Errorf("credential %q: must be env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY", ref)
+	}
+
+	switch source {
+	case "env":
+		value, ok := os.LookupEnv(location)
+		if !ok {
+			return "", fmt.Errorf("credential %q: environment variable not set", ref)
+		}
+		return value, nil
+	case "file":
+		data, err := os.ReadFile(location)
+		if err != nil {
+			return "", fmt.Errorf("credential %q: %w", ref, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "secret":
+		parts := strings.Split(location, "/")
+		if len(parts) != 3 {
+			return "", fmt.Errorf("credential %q: must be secret:NAMESPACE/NAME/KEY", ref)
+		}
+		secret, err := clientset.CoreV1().Secrets(parts[0]).Get(context.TODO(), parts[1], metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("credential %q: %w", ref, err)
+		}
+		value, ok := secret.Data[parts[2]]
+		if !ok {
+			return "", fmt.Errorf("credential %q: no key %s in the Secret", ref, parts[2])
+		}
+		return string(value), nil
+	default:
+		return "", fmt.Errorf("credential %q: unknown source %q, must be env, file or secret", ref, source)
+	}
+}
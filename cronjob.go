@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/plan"
+)
+
+func createCronJob(clientset *kubernetes.Clientset, namespace, schedule string, podsPerBurst int64, totalLogLines int, labels map[string]string, podSpec v1.PodSpec) {
+	cronJobName := "logger-cronjob"
+	parallelism := int32(podsPerBurst)
+	backoffLimit := int32(0)
+
+	_, err := clientset.BatchV1().CronJobs(namespace).Create(context.TODO(), &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: cronJobName,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:          schedule,
+			ConcurrencyPolicy: batchv1.ForbidConcurrent,
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Parallelism:  &parallelism,
+					Completions:  &parallelism,
+					BackoffLimit: &backoffLimit,
+					Template: v1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels:      labels,
+							Annotations: buildPodAnnotations(totalLogLines),
+						},
+						Spec: podSpec,
+					},
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		fatal("Failed to create CronJob", "cronjob", cronJobName, "namespace", namespace, "error", err)
+	}
+}
+
+func installCronJobs(clientset *kubernetes.Clientset, namespaces []string, schedule string, totalPods, totalLogLines int, labels map[string]string, podSpec v1.PodSpec) {
+	podsPerBurst, err := plan.PodsPerNamespace(int64(totalPods), int64(len(namespaces)))
+	if err != nil {
+		fatal("Failed to plan pods per namespace", "error", err)
+	}
+
+	for _, ns := range namespaces {
+		createCronJob(clientset, ns, schedule, podsPerBurst, totalLogLines, labels, podSpec)
+		slog.Info("CronJob created", "namespace", ns, "schedule", schedule, "pods_per_burst", podsPerBurst)
+	}
+}
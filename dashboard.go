@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/lifecycle"
+)
+
+const (
+	dashboardRefreshInterval = 2 * time.Second
+	dashboardLogLines        = 8
+	dashboardErrorLines      = 5
+	dashboardMaxNamespaces   = 20
+)
+
+// logRing keeps the last lines written to it, and separately the last lines
+// reporting a failure, for the dashboard to show in place of the log.
+type logRing struct {
+	mu     sync.Mutex
+	lines  []string
+	errors []string
+
+	// onError is called after a failure is written. The dashboard redraws
+	// at once, so a failure that aborts the run is on screen when the
+	// program exits.
+	onError func()
+}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	failed := false
+
+	r.mu.Lock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		r.lines = appendLast(r.lines, line, dashboardLogLines)
+		if strings.HasPrefix(line, "level=WARN") || strings.HasPrefix(line, "level=ERROR") {
+			r.errors = appendLast(r.errors, line, dashboardErrorLines)
+			failed = true
+		}
+	}
+	onError := r.onError
+	r.mu.Unlock()
+
+	if failed && onError != nil {
+		onError()
+	}
+
+	return len(p), nil
+}
+
+func appendLast(lines []string, line string, n int) []string {
+	lines = append(lines, line)
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// dashboard redraws the progress of the run in the terminal instead of
+// scrolling log lines.
+type dashboard struct {
+	out         io.Writer
+	ring        *logRing
+	lc          *lifecycle.Run
+	summaries   []*clusterSummary
+	totalPods   int
+	bytesPerPod int64
+	startTime   time.Time
+	duration    time.Duration
+
+	drawing sync.Mutex
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+// stdoutIsTerminal reports whether the dashboard can be drawn on stdout.
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// start redraws the dashboard until stop is called.
+func (d *dashboard) start() {
+	d.stopped = make(chan struct{})
+	d.done = make(chan struct{})
+
+	d.ring.mu.Lock()
+	d.ring.onError = d.draw
+	d.ring.mu.Unlock()
+
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(dashboardRefreshInterval)
+		defer ticker.Stop()
+		for {
+			d.draw()
+			select {
+			case <-d.stopped:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stop draws the dashboard a last time and stops redrawing it.
+func (d *dashboard) stop() {
+	close(d.stopped)
+	<-d.done
+	d.draw()
+}
+
+func (d *dashboard) draw() {
+	d.drawing.Lock()
+	defer d.drawing.Unlock()
+
+	var b bytes.Buffer
+
+	// Move the cursor home and clear the screen.
+	b.WriteString("\x1b[H\x1b[2J")
+
+	elapsed := time.Since(d.startTime).Round(time.Second)
+	remaining := (d.duration - elapsed).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	fmt.Fprintf(&b, "Run %s: %s   elapsed %s   remaining %s\n\n", d.lc.ID(), d.lc.State(), elapsed, remaining)
+
+	created := 0
+	for _, s := range d.summaries {
+		created += s.createdPods()
+	}
+	fmt.Fprintf(&b, "Pods created: %d (target %d running)   Generated: %.1f MB (estimated)\n\n",
+		created, d.totalPods, float64(int64(created)*d.bytesPerPod)/(1024*1024))
+
+	for _, s := range d.summaries {
+		running := s.runningPerNamespace()
+		if running == nil {
+			continue
+		}
+		if s.Name != "" {
+			fmt.Fprintf(&b, "Cluster %s\n", s.Name)
+		}
+
+		namespaces := make([]string, 0, len(running))
+		total := 0
+		for ns, n := range running {
+			namespaces = append(namespaces, ns)
+			total += n
+		}
+		sort.Strings(namespaces)
+		fmt.Fprintf(&b, "  Running pods: %d\n", total)
+		for i, ns := range namespaces {
+			if i == dashboardMaxNamespaces {
+				fmt.Fprintf(&b, "    ... and %d more namespaces\n", len(namespaces)-dashboardMaxNamespaces)
+				break
+			}
+			fmt.Fprintf(&b, "    %-30s %d\n", ns, running[ns])
+		}
+		b.WriteString("\n")
+	}
+
+	d.ring.mu.Lock()
+	b.WriteString("Recent errors:\n")
+	for _, line := range d.ring.errors {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	b.WriteString("\nRecent log:\n")
+	for _, line := range d.ring.lines {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	d.ring.mu.Unlock()
+
+	d.out.Write(b.Bytes())
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/lifecycle"
+)
+
+const (
+	deadlineCleanupNone             = "none"
+	deadlineCleanupDeleteNamespaces = "delete-namespaces"
+)
+
+// defaultHardDeadlineMarginMinutes is added to run_duration_minutes when
+// hard_deadline_minutes is not set, leaving room for namespace setup and the
+// final report.
+const defaultHardDeadlineMarginMinutes = 10
+
+// exitDeadlineExceeded is the exit code of a run stopped by the hard
+// deadline, distinct from the 1 of fatal.
+const exitDeadlineExceeded = 3
+
+// deadlineCleanupTimeout bounds the cleanup, so a wedged API server cannot
+// keep the process alive past the deadline either.
+const deadlineCleanupTimeout = 1 * time.Minute
+
+// runHardDeadline stops the process at deadline no matter what the main loop
+// is waiting on: it stops pod creation, cleans up according to cleanup and
+// exits with exitDeadlineExceeded.
+func runHardDeadline(clusters []cluster, numK8sNamespaces int, namespacePrefix, cleanup string, deadline time.Time, lc *lifecycle.Run, exceeded *atomic.Bool) {
+	time.Sleep(time.Until(deadline))
+	exceeded.Store(true)
+	transition(lc, lifecycle.Failed, "hard deadline exceeded")
+	slog.Error("Hard deadline exceeded, stopping pod creation", "deadline", deadline.Format(time.RFC3339))
+
+	if cleanup == deadlineCleanupDeleteNamespaces {
+		ctx, cancel := context.WithTimeout(context.Background(), deadlineCleanupTimeout)
+
+		// The namespaces may not all exist yet if setup is what hung.
+		for _, c := range clusters {
+			for _, namespaceName := range append(namespaceNames(numK8sNamespaces, namespacePrefix), c.churned.list()...) {
+				err := c.clientset.CoreV1().Namespaces().Delete(ctx, namespaceName, metav1.DeleteOptions{})
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				if err != nil {
+					slog.Warn("Failed to delete namespace", "namespace", namespaceName, "error", err)
+					continue
+				}
+				slog.Info("Deleted namespace", "namespace", namespaceName)
+			}
+		}
+		cancel()
+	}
+
+	os.Exit(exitDeadlineExceeded)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/lifecycle"
+)
+
+// serveDebug exposes the profiles of net/http/pprof at /debug/pprof/ and the
+// health of the run at /healthz on address. It returns only if the server
+// fails.
+func serveDebug(address string, lc *lifecycle.Run) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// A failed run is not healthy, so a liveness probe restarts a
+	// generator stuck after its hard deadline.
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		state := lc.State()
+		if state == lifecycle.Failed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintf(w, "%s\n", state)
+	})
+
+	return http.ListenAndServe(address, mux)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/plan"
+)
+
+// printDryRun writes what a run of config would do to w: the namespaces and
+// pods of every cluster, the size of the pods, the log volume and the
+// duration. It does not connect to any cluster.
+func printDryRun(w io.Writer, config Config, runPlan plan.Plan) {
+	bytesPerPod := runPlan.LinesPerPod * int64(config.BytesPerLogLine+1)
+
+	fmt.Fprintf(w, "Mode: %s, profile: %s, format: %s\n", config.Mode, config.Profile, config.Format)
+	if config.FormatMigration != nil {
+		fmt.Fprintf(w, "Format switches to %s after %d minutes\n", config.FormatMigration.To, config.FormatMigration.AfterMinutes)
+	}
+	fmt.Fprintf(w, "Per pod: %d lines of %d bytes, %s with newlines\n", runPlan.LinesPerPod, config.BytesPerLogLine, formatBytes(bytesPerPod))
+
+	clusterConfigs, pods := clusterPods(config, int(runPlan.Pods))
+	totalPods := 0
+	for i, cc := range clusterConfigs {
+		totalPods += pods[i]
+
+		name := cc.Name
+		if name == "" {
+			name = "(kubeconfig_path)"
+		}
+		fmt.Fprintf(w, "Cluster %s: %d pods, %s\n", name, pods[i], formatBytes(int64(pods[i])*bytesPerPod))
+
+		namespaces := namespaceNames(config.NumK8sNamespaces, config.NamespacePrefix)
+		var start time.Time
+		for _, group := range buildNamespaceGroups(config, namespaces, pods[i], start) {
+			label := "Namespaces"
+			if group.name != "" {
+				label = "Namespace group " + group.name
+			}
+			fmt.Fprintf(w, "  %s: %s, %d pods from minute %d to %d\n", label, namespaceRange(group.namespaces), group.totalPods,
+				int(group.startTime.Sub(start).Minutes()), int(group.stopTime.Sub(start).Minutes()))
+		}
+	}
+
+	fmt.Fprintf(w, "Total: %d pods, %s", totalPods, formatBytes(int64(totalPods)*bytesPerPod))
+	if runPlan.Total(sizeAccountings[config.SizeAccounting]) != runPlan.RequestedBytes {
+		fmt.Fprintf(w, " (%d %s bytes requested, rounded up to whole lines and pods)", runPlan.RequestedBytes, config.SizeAccounting)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Bytes: %d of messages, %d with newlines, up to %d on the nodes\n", runPlan.TotalBytes, runPlan.WireTotalBytes, runPlan.DiskTotalBytes)
+
+	if config.Mode == "cronjob" {
+		fmt.Fprintf(w, "Every scheduled run creates the pods above\n")
+		return
+	}
+	fmt.Fprintf(w, "Duration: %d minutes, hard deadline after %d minutes\n", config.RunDurationMinutes, config.HardDeadlineMinutes)
+}
+
+// namespaceRange abbreviates namespaces to its first and last names.
+func namespaceRange(namespaces []string) string {
+	if len(namespaces) <= 2 {
+		return strings.Join(namespaces, ", ")
+	}
+
+	return fmt.Sprintf("%s .. %s (%d)", namespaces[0], namespaces[len(namespaces)-1], len(namespaces))
+}
+
+// formatBytes returns n in bytes and in the largest binary unit below it.
+func formatBytes(n int64) string {
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	value := float64(n)
+	unit := ""
+	for _, u := range units {
+		if value < 1024 {
+			break
+		}
+		value /= 1024
+		unit = u
+	}
+	if unit == "" {
+		return fmt.Sprintf("%d bytes", n)
+	}
+
+	return fmt.Sprintf("%d bytes (%.1f %s)", n, value, unit)
+}
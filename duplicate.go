@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+const (
+	duplicateLinesPod = "pod"
+	duplicateLinesRun = "run"
+)
+
+const (
+	// duplicateRunLineCount is the number of lines of the run scope of
+	// duplicate_lines, which every pod prints in turn.
+	duplicateRunLineCount = 8
+
+	// maxDuplicateRunBytes bounds the bytes of the lines of the run scope,
+	// which are part of the script in the command of every pod.
+	maxDuplicateRunBytes = 64 * 1024
+)
+
+// DuplicateLines prints a verbatim copy of a share of the lines, so the
+// deduplication of a pipeline can be measured: every copy it keeps counts
+// as a duplicated line in verify.
+type DuplicateLines struct {
+	Percent int    `yaml:"percent"`
+	Scope   string `yaml:"scope"`
+}
+
+// copyCommand returns emit, the command printing a line, printing Percent
+// percent of the lines, spread evenly over the lines of the pod, twice.
+func (d *DuplicateLines) copyCommand(emit string) string {
+	return fmt.Sprintf(`duplicates=$((duplicates + 1)); if %[1]s; then line=$(%[2]s); printf '%%s\n%%s' "$line" "$line"; [ -n "$hold" ] || echo; else %[2]s; fi`,
+		spreadCondition("duplicates", d.Percent), emit)
+}
+
+// runLineCommand returns the shell command printing the next of lines, the
+// lines shared by the pods of the run, after Percent percent of the lines,
+// spread evenly over the lines of the pod.
+func (d *DuplicateLines) runLineCommand(lines []string) string {
+	cases := make([]string, len(lines))
+	for i, line := range lines {
+		cases[i] = fmt.Sprintf(`%d) printf '%%s%%s\n' '%s' "$cr";;`, i, line)
+	}
+
+	return fmt.Sprintf(`duplicates=$((duplicates + 1)); if %s; then case $((duplicates %% %d)) in %s esac; fi`,
+		spreadCondition("duplicates", d.Percent), len(lines), strings.Join(cases, " "))
+}
+
+// generateDuplicateRunLines returns the lines of the run scope of
+// duplicate_lines: random alphanumeric lines of the format and line size of
+// config, without markers, ended by the carriage return of crlf.
+func generateDuplicateRunLines(config Config) []string {
+	const alphanumerics = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	payloadBytes := int(config.BytesPerLogLine) - formatOverheadBytes(config.Format)
+	if config.LineEnding == lineEndingCRLF {
+		payloadBytes--
+	}
+
+	lines := make([]string, duplicateRunLineCount)
+	for i := range lines {
+		payload := make([]byte, payloadBytes)
+		for j := range payload {
+			payload[j] = alphanumerics[rand.Intn(len(alphanumerics))]
+		}
+		lines[i] = string(payload)
+		if config.Format == formatJSON {
+			lines[i] = `{"level":"info","msg":"` + lines[i] + `"}`
+		}
+	}
+
+	return lines
+}
+
+// cutDuplicates removes the copies of the scope from lines and returns the
+// others and the number removed: with the pod scope, the lines equal to the
+// line before them, and with the run scope, the lines of runLines.
+func (d *DuplicateLines) cutDuplicates(lines, runLines []string) ([]string, int) {
+	var kept []string
+	for i, line := range lines {
+		if d.Scope == duplicateLinesPod && i > 0 && line == lines[i-1] {
+			continue
+		}
+		if d.Scope == duplicateLinesRun && slices.Contains(runLines, strings.TrimSuffix(line, "\r")) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	return kept, len(lines) - len(kept)
+}
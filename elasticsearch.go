@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// elasticsearchPageSize is the number of pods counted per search request.
+const elasticsearchPageSize = 1000
+
+// elasticsearchClient searches an Elasticsearch or OpenSearch index. The
+// credentials are only ever sent in the headers of the requests.
+type elasticsearchClient struct {
+	addr     string
+	index    string
+	username string
+	password string
+	apiKey   string
+	client   *http.Client
+}
+
+type elasticsearchResponse struct {
+	Hits struct {
+		Hits []struct {
+			Fields map[string][]interface{} `json:"fields"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations struct {
+		Pods struct {
+			AfterKey map[string]string `json:"after_key"`
+			Buckets  []struct {
+				Key      map[string]string `json:"key"`
+				DocCount int64             `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"pods"`
+	} `json:"aggregations"`
+}
+
+// elasticsearchFlags are the flags of the commands reading from
+// Elasticsearch or OpenSearch.
+type elasticsearchFlags struct {
+	addr           string
+	index          string
+	username       string
+	passwordFrom   string
+	apiKeyFrom     string
+	runIDField     string
+	namespaceField string
+	podField       string
+}
+
+func (f *elasticsearchFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.addr, "addr", "", "address of the cluster, such as https://elasticsearch.logging:9200")
+	fs.StringVar(&f.index, "index", "", "index, alias or pattern holding the lines, such as logs-*")
+	fs.StringVar(&f.username, "username", "", "user name for basic authentication")
+	fs.StringVar(&f.passwordFrom, "password-from", "", "password for basic authentication: env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY")
+	fs.StringVar(&f.apiKeyFrom, "api-key-from", "", "encoded API key: env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY")
+	fs.StringVar(&f.runIDField, "run-id-field", "kubernetes.labels.k8s-pod-log-generator/run-id.keyword", "keyword field holding the run-id label of the pod")
+	fs.StringVar(&f.namespaceField, "namespace-field", "kubernetes.namespace_name.keyword", "keyword field holding the namespace")
+	fs.StringVar(&f.podField, "pod-field", "kubernetes.pod_name.keyword", "keyword field holding the pod name")
+}
+
+// check returns the problem with the flags, if any.
+func (f *elasticsearchFlags) check() error {
+	if f.addr == "" || f.index == "" {
+		return fmt.Errorf("--addr and --index are required")
+	}
+	if f.passwordFrom != "" && f.apiKeyFrom != "" {
+		return fmt.Errorf("--password-from and --api-key-from cannot be used together")
+	}
+	return nil
+}
+
+// credentialRefs returns the credentials the flags refer to.
+func (f *elasticsearchFlags) credentialRefs() []string {
+	return []string{f.passwordFrom, f.apiKeyFrom}
+}
+
+// client returns the client of the flags, reading Secrets with clientset.
+func (f *elasticsearchFlags) client(clientset *kubernetes.Clientset, backend string) *elasticsearchClient {
+	client := &elasticsearchClient{addr: f.addr, index: f.index, username: f.username, client: &http.Client{}}
+
+	var err error
+	if f.passwordFrom != "" {
+		if client.password, err = readCredential(f.passwordFrom, clientset); err != nil {
+			fatal("Failed to read the password", "backend", backend, "error", err)
+		}
+	}
+	if f.apiKeyFrom != "" {
+		if client.apiKey, err = readCredential(f.apiKeyFrom, clientset); err != nil {
+			fatal("Failed to read the API key", "backend", backend, "error", err)
+		}
+	}
+
+	return client
+}
+
+// countLines returns the number of documents of the index per pod whose
+// runIDField is runID, grouped by namespaceField and podField, searching
+// through queries. The fields must be keyword fields.
+func (c *elasticsearchClient) countLines(ctx context.Context, queries *backendQueries, runID, runIDField, namespaceField, podField string) (map[podRef]int64, error) {
+	counts := make(map[podRef]int64)
+
+	var after map[string]string
+	for {
+		composite := map[string]interface{}{
+			"size": elasticsearchPageSize,
+			"sources": []interface{}{
+				map[string]interface{}{"namespace": map[string]interface{}{"terms": map[string]string{"field": namespaceField}}},
+				map[string]interface{}{"pod": map[string]interface{}{"terms": map[string]string{"field": podField}}},
+			},
+		}
+		if after != nil {
+			composite["after"] = after
+		}
+		search := map[string]interface{}{
+			"size":  0,
+			"query": map[string]interface{}{"term": map[string]string{runIDField: runID}},
+			"aggs":  map[string]interface{}{"pods": map[string]interface{}{"composite": composite}},
+		}
+
+		var resp elasticsearchResponse
+		err := queries.do(ctx, "search of index "+c.index, func() error {
+			resp = elasticsearchResponse{}
+			return c.search(ctx, search, &resp)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, bucket := range resp.Aggregations.Pods.Buckets {
+			counts[podRef{Namespace: bucket.Key["namespace"], Name: bucket.Key["pod"]}] += bucket.DocCount
+		}
+		if len(resp.Aggregations.Pods.Buckets) < elasticsearchPageSize || resp.Aggregations.Pods.AfterKey == nil {
+			return counts, nil
+		}
+		after = resp.Aggregations.Pods.AfterKey
+	}
+}
+
+// recentLines returns messageField of the newest limit documents whose
+// runIDField is runID, by timestampField since the given time.
+func (c *elasticsearchClient) recentLines(ctx context.Context, runID, runIDField, messageField, timestampField string, since time.Time, limit int) ([]string, error) {
+	search := map[string]interface{}{
+		"size":    limit,
+		"_source": false,
+		"fields":  []string{messageField},
+		"sort":    []interface{}{map[string]string{timestampField: "desc"}},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]string{runIDField: runID}},
+					map[string]interface{}{"range": map[string]interface{}{timestampField: map[string]string{"gte": since.UTC().Format(time.RFC3339Nano)}}},
+				},
+			},
+		},
+	}
+
+	var resp elasticsearchResponse
+	if err := c.search(ctx, search, &resp); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, hit := range resp.Hits.Hits {
+		for _, value := range hit.Fields[messageField] {
+			if line, ok := value.(string); ok {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines, nil
+}
+
+func (c *elasticsearchClient) search(ctx context.Context, search interface{}, result interface{}) error {
+	body, err := json.Marshal(search)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.addr, "/")+"/"+url.PathEscape(c.index)+"/_search", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+c.apiKey)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("search of index %s: %w", c.index, responseError(resp, data))
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("search of index %s: %w", c.index, err)
+	}
+	return nil
+}
+
+// verifyElasticsearch implements verify elasticsearch and verify
+// opensearch, which share the search API; backend names the one verified.
+func verifyElasticsearch(configFile, backend string, args []string) int {
+	var options verifyOptions
+	var es elasticsearchFlags
+	fs := flag.NewFlagSet("verify "+strings.ToLower(backend), flag.ContinueOnError)
+	options.register(fs)
+	es.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := es.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := options.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	clientsets, generated := verifyClusters(configFile, options.runID)
+	client := es.client(clientsets[0], backend)
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.timeout)
+	defer cancel()
+
+	received, err := client.countLines(ctx, newBackendQueries(backend, options), options.runID, es.runIDField, es.namespaceField, es.podField)
+	if err != nil {
+		fatal("Failed to search the index", "backend", backend, "addr", es.addr, "error", err)
+	}
+	slog.Debug("Searched the index", "backend", backend, "index", es.index, "pods", len(received))
+
+	return reportVerification(backend, compareLines(generated, received), options)
+}
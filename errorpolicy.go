@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	errorPolicyFailFast = "fail-fast"
+	errorPolicySkip     = "skip"
+	errorPolicyBudget   = "budget"
+)
+
+// Operations the error policy applies to.
+const (
+	operationNamespaceCreation = "namespace creation"
+	operationPodCreation       = "pod creation"
+)
+
+// maxErrorExamples caps the failures of each error class that are logged in
+// full, during the run and in the final report.
+const maxErrorExamples = 3
+
+type skippedOperation struct {
+	what string
+	err  error
+}
+
+// errorClass groups the failures of an operation with the same cause.
+type errorClass struct {
+	name     string
+	count    int
+	examples []skippedOperation
+}
+
+// errorPolicy decides whether a failed operation aborts the run or is
+// skipped, and remembers what was skipped for the final report.
+type errorPolicy struct {
+	policy        string
+	budgetPercent float64
+
+	// planned is the number of operations of each kind the run intends to
+	// make; budget percentages are relative to it.
+	planned map[string]int
+
+	mu      sync.Mutex
+	failed  map[string]int
+	classes map[string]map[string]*errorClass
+}
+
+func newErrorPolicy(policy string, budgetPercent float64, planned map[string]int) *errorPolicy {
+	return &errorPolicy{
+		policy:        policy,
+		budgetPercent: budgetPercent,
+		planned:       planned,
+		failed:        make(map[string]int),
+		classes:       make(map[string]map[string]*errorClass),
+	}
+}
+
+// classifyError returns the class of a failure: the reason of an API error,
+// such as Forbidden or TooManyRequests, or the kind of a client-side error.
+func classifyError(err error) string {
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		if reason := status.Status().Reason; reason != metav1.StatusReasonUnknown {
+			return string(reason)
+		}
+		return fmt.Sprintf("HTTP %d", status.Status().Code)
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "DeadlineExceeded"
+	case errors.As(err, &netErr):
+		return "NetworkError"
+	}
+
+	return "Other"
+}
+
+// fail handles the failure of operation on what. It returns when the
+// operation is to be skipped and aborts the run otherwise. Only the first
+// failures of each error class are logged; the others are counted for the
+// final report.
+func (p *errorPolicy) fail(operation, what string, err error) {
+	if p.policy == errorPolicyFailFast {
+		fatal("Failed "+operation, "object", what, "error", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failed[operation]++
+	failed := p.failed[operation]
+
+	if p.classes[operation] == nil {
+		p.classes[operation] = make(map[string]*errorClass)
+	}
+	name := classifyError(err)
+	class := p.classes[operation][name]
+	if class == nil {
+		class = &errorClass{name: name}
+		p.classes[operation][name] = class
+	}
+	class.count++
+	if len(class.examples) < maxErrorExamples {
+		class.examples = append(class.examples, skippedOperation{what: what, err: err})
+		slog.Warn("Skipping failed "+operation, "object", what, "class", name, "error", err)
+		if len(class.examples) == maxErrorExamples {
+			slog.Warn("Further failures of the class are summarized at the end of the run", "operation", operation, "class", name)
+		}
+	}
+
+	planned := p.planned[operation]
+	if p.policy == errorPolicyBudget && float64(failed)*100 > p.budgetPercent*float64(planned) {
+		p.reportLocked()
+		fatal("Aborting, the error budget is exceeded", "operation", operation, "failed", failed, "planned", planned, "budget_percent", p.budgetPercent)
+	}
+}
+
+// operationErrors counts the failures of an operation, by error class.
+type operationErrors struct {
+	Failed  int            `json:"failed"`
+	Classes map[string]int `json:"classes,omitempty"`
+}
+
+// counts returns the failures of every operation.
+func (p *errorPolicy) counts() map[string]operationErrors {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	counts := make(map[string]operationErrors)
+	for _, operation := range []string{operationNamespaceCreation, operationPodCreation} {
+		errs := operationErrors{Failed: p.failed[operation], Classes: make(map[string]int)}
+		for name, class := range p.classes[operation] {
+			errs.Classes[name] = class.count
+		}
+		counts[operation] = errs
+	}
+
+	return counts
+}
+
+// report logs what was skipped during the run, by error class from the most
+// frequent, with a few examples of each.
+func (p *errorPolicy) report() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reportLocked()
+}
+
+func (p *errorPolicy) reportLocked() {
+	for _, operation := range []string{operationNamespaceCreation, operationPodCreation} {
+		if p.failed[operation] == 0 {
+			continue
+		}
+
+		classes := make([]*errorClass, 0, len(p.classes[operation]))
+		for _, class := range p.classes[operation] {
+			classes = append(classes, class)
+		}
+		sort.Slice(classes, func(i, j int) bool {
+			if classes[i].count != classes[j].count {
+				return classes[i].count > classes[j].count
+			}
+			return classes[i].name < classes[j].name
+		})
+
+		slog.Warn("Skipped failed operations", "operation", operation, "failed", p.failed[operation])
+		for _, class := range classes {
+			slog.Warn("Skipped failed operations of a class", "operation", operation, "class", class.name, "failed", class.count)
+			for _, s := range class.examples {
+				slog.Warn("Skipped failed operation", "operation", operation, "class", class.name, "object", s.what, "error", s.err)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// exitExpectationsFailed is the exit code of a run that completed but did
+// not meet its expectations.
+const exitExpectationsFailed = 4
+
+// Expectations are the thresholds a completed run must meet, for gating CI
+// pipelines on the logging stack under test.
+type Expectations struct {
+	MinPodsCreated               int      `yaml:"min_pods_created"`
+	MinBytesScheduled            ByteSize `yaml:"min_bytes_scheduled"`
+	MaxPodErrorRatePercent       *float64 `yaml:"max_pod_error_rate_percent"`
+	MaxNamespaceCreationFailures *int     `yaml:"max_namespace_creation_failures"`
+}
+
+type expectationResult struct {
+	name    string
+	failure string
+}
+
+// checkExpectations checks the outcome of a run against e and returns the
+// result of every expectation set.
+func checkExpectations(e Expectations, podsCreated int, bytesScheduled int64, errs map[string]operationErrors) []expectationResult {
+	var results []expectationResult
+	check := func(name string, ok bool, format string, args ...interface{}) {
+		result := expectationResult{name: name}
+		if !ok {
+			result.failure = fmt.Sprintf(format, args...)
+		}
+		results = append(results, result)
+	}
+
+	if e.MinPodsCreated > 0 {
+		check("min_pods_created", podsCreated >= e.MinPodsCreated,
+			"%d pods created, expected at least %d", podsCreated, e.MinPodsCreated)
+	}
+	if e.MinBytesScheduled > 0 {
+		check("min_bytes_scheduled", bytesScheduled >= int64(e.MinBytesScheduled),
+			"%d bytes scheduled, expected at least %d", bytesScheduled, e.MinBytesScheduled)
+	}
+	if e.MaxPodErrorRatePercent != nil {
+		failed := errs[operationPodCreation].Failed
+		rate := 0.0
+		if attempted := podsCreated + failed; attempted > 0 {
+			rate = float64(failed) * 100 / float64(attempted)
+		}
+		check("max_pod_error_rate_percent", rate <= *e.MaxPodErrorRatePercent,
+			"%.2f%% of pod creations failed (%d), expected at most %g%%", rate, failed, *e.MaxPodErrorRatePercent)
+	}
+	if e.MaxNamespaceCreationFailures != nil {
+		failed := errs[operationNamespaceCreation].Failed
+		check("max_namespace_creation_failures", failed <= *e.MaxNamespaceCreationFailures,
+			"%d namespace creations failed, expected at most %d", failed, *e.MaxNamespaceCreationFailures)
+	}
+
+	return results
+}
+
+// reportExpectations logs the results and reports whether all of them
+// passed.
+func reportExpectations(results []expectationResult) bool {
+	passed := true
+	for _, r := range results {
+		if r.failure != "" {
+			slog.Error("Expectation failed", "expectation", r.name, "failure", r.failure)
+			passed = false
+		} else {
+			slog.Info("Expectation passed", "expectation", r.name)
+		}
+	}
+
+	return passed
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit writes the results to path as a JUnit XML test suite named
+// after the run, one test case per expectation.
+func writeJUnit(path, runID string, results []expectationResult) error {
+	suite := junitTestSuite{
+		Name:      "k8s-pod-log-generator " + runID,
+		Tests:     len(results),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, r := range results {
+		tc := junitTestCase{Name: r.name, ClassName: "expectations"}
+		if r.failure != "" {
+			tc.Failure = &junitFailure{Message: r.failure}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append([]byte(xml.Header), data...), 0o644)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Word lists of the fake values, kept free of quotes and backslashes so the
+// values need no escaping in json lines.
+var (
+	fakeFirstNames = []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi", "ivan", "judy", "mallory", "oscar", "peggy", "rupert", "sybil", "trent", "victor", "walter"}
+	fakeLastNames  = []string{"smith", "johnson", "garcia", "miller", "davis", "martinez", "lopez", "wilson", "tanaka", "suzuki", "kim", "nguyen", "schmidt", "rossi", "dubois", "silva"}
+	fakeDomains    = []string{"example.com", "example.org", "example.net", "mail.example.com", "shop.example.com", "api.example.io"}
+	fakeURLPaths   = []string{"api/v1/users", "api/v1/orders", "api/v2/search", "cart", "checkout", "products", "static/js", "login", "health"}
+	fakeUserAgents = []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+		"curl/8.7.1",
+		"python-requests/2.31.0",
+		"Go-http-client/1.1",
+		"kube-probe/1.30",
+	}
+)
+
+// fakeValue is a kind of fake value: the json field of fake_fields and the
+// line_template variable printing it, the shell function generating it in
+// the pod, the most bytes it takes and the pattern matching it.
+type fakeValue struct {
+	field    string
+	variable string
+	function string
+	bytes    int
+	pattern  string
+}
+
+// fakeValues are the kinds of fake values, in the order of their fields in
+// json lines.
+var fakeValues = []fakeValue{
+	{
+		field:    "ip",
+		variable: "IP",
+		function: `fake_ip() { od -An -tu1 -N4 /dev/urandom | awk '{ printf "%s.%s.%s.%s", $1, $2, $3, $4 }'; }`,
+		bytes:    len("255.255.255.255"),
+		pattern:  `[0-9]{1,3}(?:\.[0-9]{1,3}){3}`,
+	},
+	{
+		field:    "user_agent",
+		variable: "UserAgent",
+		function: fmt.Sprintf(`fake_user_agent() { pick %s; }`, shellWords(fakeUserAgents)),
+		bytes:    longestWord(fakeUserAgents),
+		pattern:  `[A-Za-z][-A-Za-z0-9/.;:,_() ]*`,
+	},
+	{
+		field:    "email",
+		variable: "Email",
+		function: fmt.Sprintf(`fake_email() { printf '%%s.%%s%%d@%%s' "$(pick %s)" "$(pick %s)" $(($(od -An -tu2 -N2 /dev/urandom) %% 100)) "$(pick %s)"; }`,
+			shellWords(fakeFirstNames), shellWords(fakeLastNames), shellWords(fakeDomains)),
+		bytes:   longestWord(fakeFirstNames) + len(".") + longestWord(fakeLastNames) + len("99@") + longestWord(fakeDomains),
+		pattern: `[a-z]+\.[a-z]+[0-9]{1,2}@[a-z.]+`,
+	},
+	{
+		field:    "uuid",
+		variable: "UUID",
+		function: `fake_uuid() { od -An -tx1 -N16 /dev/urandom | tr -d ' \n' | sed 's/^\(.\{8\}\)\(.\{4\}\).\(.\{3\}\).\(.\{3\}\)/\1-\2-4\3-8\4-/'; }`,
+		bytes:    36,
+		pattern:  `[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-8[0-9a-f]{3}-[0-9a-f]{12}`,
+	},
+	{
+		field:    "url",
+		variable: "URL",
+		function: fmt.Sprintf(`fake_url() { printf 'https://%%s/%%s/%%d' "$(pick %s)" "$(pick %s)" $(od -An -tu2 -N2 /dev/urandom); }`,
+			shellWords(fakeDomains), shellWords(fakeURLPaths)),
+		bytes:   len("https://") + longestWord(fakeDomains) + len("/") + longestWord(fakeURLPaths) + len("/65535"),
+		pattern: `https://[a-z.]+/[a-z0-9/]+/[0-9]{1,5}`,
+	},
+}
+
+// pickFunction defines pick, which prints one of its arguments at random.
+const pickFunction = `pick() { shift $(($(od -An -tu2 -N2 /dev/urandom) % $#)); printf '%s' "$1"; }`
+
+// fakeValueOf returns the kind of fake value of the json field or template
+// variable name.
+func fakeValueOf(name string) (fakeValue, bool) {
+	for _, value := range fakeValues {
+		if value.field == name || value.variable == name {
+			return value, true
+		}
+	}
+
+	return fakeValue{}, false
+}
+
+// fakeFieldNames returns the json fields of the kinds of fake values.
+func fakeFieldNames() []string {
+	names := make([]string, len(fakeValues))
+	for i, value := range fakeValues {
+		names[i] = value.field
+	}
+
+	return names
+}
+
+// fakeFunctions defines pick and the fake_<field> function of every kind of
+// fake value.
+func fakeFunctions() string {
+	functions := []string{pickFunction}
+	for _, value := range fakeValues {
+		functions = append(functions, value.function)
+	}
+
+	return strings.Join(functions, "; ")
+}
+
+// usesFakeValues reports whether the lines of config print fake values.
+func usesFakeValues(config Config) bool {
+	return len(config.FakeFields) > 0 || usesLineTemplates(config)
+}
+
+// fakeFieldsBytes returns the most bytes the fake fields add to a json line.
+func fakeFieldsBytes(fields []string) int {
+	bytes := 0
+	for _, field := range fields {
+		value, _ := fakeValueOf(field)
+		bytes += len(fmt.Sprintf(`"%s":"",`, field)) + value.bytes
+	}
+
+	return bytes
+}
+
+// fakeFieldsWord returns the fake fields as a double-quoted shell word
+// generating them, each followed by a comma.
+func fakeFieldsWord(fields []string) string {
+	var word strings.Builder
+	for _, field := range fields {
+		fmt.Fprintf(&word, `\"%s\":\"$(fake_%s)\",`, field, field)
+	}
+
+	return `"` + word.String() + `"`
+}
+
+// checkFakeFields verifies that the fields of a json line hold fake values
+// of their kind.
+func checkFakeFields(fields map[string]any, names []string) error {
+	for _, name := range names {
+		value, _ := fakeValueOf(name)
+		got, ok := fields[name].(string)
+		if !ok || !regexp.MustCompile(`^`+value.pattern+`$`).MatchString(got) {
+			return fmt.Errorf("no fake %s field", name)
+		}
+	}
+
+	return nil
+}
+
+// shellWords returns words as single-quoted shell words.
+func shellWords(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = "'" + word + "'"
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// longestWord returns the length of the longest of words.
+func longestWord(words []string) int {
+	longest := 0
+	for _, word := range words {
+		longest = max(longest, len(word))
+	}
+
+	return longest
+}
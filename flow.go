@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+// defaultRequestFlowTiers are the tiers of request_flows, in the order a
+// request goes through them.
+var defaultRequestFlowTiers = []string{"gateway", "service", "db"}
+
+// requestIDBytes is the length of a request ID: the seed of the run, the
+// number of the flow and the number of the request, each of eight hex
+// digits.
+const requestIDBytes = 3*8 + 2
+
+// RequestFlows makes consecutive pods play the tiers of a service, each
+// group of them logging the same synthetic requests under shared request
+// IDs, so queries correlating logs across pods and namespaces have data.
+type RequestFlows struct {
+	Tiers           []string `yaml:"tiers"`
+	LinesPerRequest int      `yaml:"lines_per_request"`
+}
+
+// generateRequestFlowSeed returns the first part of the request IDs of a
+// run, which keeps them apart from those of other runs.
+func generateRequestFlowSeed() string {
+	return fmt.Sprintf("%08x", rand.Uint32())
+}
+
+// markerBytes returns the most bytes the request marker adds to a line.
+func (f *RequestFlows) markerBytes() int {
+	// The sizes are checked before the tiers are defaulted.
+	tiers := f.Tiers
+	if len(tiers) == 0 {
+		tiers = defaultRequestFlowTiers
+	}
+	longest := 0
+	for _, tier := range tiers {
+		longest = max(longest, len(tier))
+	}
+
+	return len("request_id=") + requestIDBytes + len(" tier=") + longest + 1
+}
+
+// flowCommand returns the shell command setting $flow, the request ID
+// prefix of the flow of the pod, and $tier, its tier, from the number ending
+// its name in $HOSTNAME: pod n plays tier n mod len(Tiers) of flow n div
+// len(Tiers).
+func (f *RequestFlows) flowCommand(seed string) string {
+	cases := make([]string, len(f.Tiers))
+	for i, tier := range f.Tiers {
+		cases[i] = fmt.Sprintf(`%d) tier=%s;;`, i, tier)
+	}
+
+	return fmt.Sprintf(`flow=%s-$(printf %%08x $((${HOSTNAME##*-} / %[2]d))); case $((${HOSTNAME##*-} %% %[2]d)) in %[3]s esac`,
+		seed, len(f.Tiers), strings.Join(cases, " "))
+}
+
+// markerCommand returns the shell command appending the request marker of
+// the line to the markers in $2: every LinesPerRequest lines of a pod belong
+// to the next request of its flow.
+func (f *RequestFlows) markerCommand() string {
+	return fmt.Sprintf(`requests=$((requests + 1)); set -- "$1" "${2}request_id=$flow-$(printf %%08x $(((requests - 1) / %d + 1))) tier=$tier "`, f.LinesPerRequest)
+}
+
+// cutRequestMarker verifies that message starts with the marker of a
+// request of seed and returns the rest.
+func (f *RequestFlows) cutRequestMarker(message, seed string) (string, error) {
+	requestID, rest, ok := strings.Cut(strings.TrimPrefix(message, "request_id="), " ")
+	parts := strings.Split(requestID, "-")
+	if !ok || !strings.HasPrefix(message, "request_id=") || len(parts) != 3 || parts[0] != seed || !isHex(parts[1], 8) || !isHex(parts[2], 8) {
+		return "", fmt.Errorf("no request ID")
+	}
+	tier, rest, ok := strings.Cut(strings.TrimPrefix(rest, "tier="), " ")
+	if !ok || !slices.Contains(f.Tiers, tier) {
+		return "", fmt.Errorf("no request tier")
+	}
+
+	return rest, nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatPlain = "plain"
+	formatJSON  = "json"
+)
+
+const (
+	lineEndingLF    = "lf"
+	lineEndingCRLF  = "crlf"
+	lineEndingMixed = "mixed"
+)
+
+// jsonFormatOverheadBytes is the length of the {"level":"info","msg":""}
+// envelope of json lines.
+const jsonFormatOverheadBytes = 25
+
+type FormatMigration struct {
+	AfterMinutes int    `yaml:"after_minutes"`
+	To           string `yaml:"to"`
+}
+
+// formatOverheadBytes returns the bytes a line of format adds around its
+// random payload.
+func formatOverheadBytes(format string) int {
+	if format == formatJSON {
+		return jsonFormatOverheadBytes
+	}
+
+	return 0
+}
+
+// lineOverheadBytes returns the most bytes the options of config add around
+// the random payload of a line of format, before any sequence marker.
+func lineOverheadBytes(config Config, format string) int {
+	overhead := formatOverheadBytes(format)
+	if format == formatJSON {
+		overhead += fakeFieldsBytes(config.FakeFields)
+		if len(config.Incidents) > 0 {
+			overhead += len("error") - len("info")
+		}
+	}
+	if slices.Contains(templatedFormats, format) {
+		overhead += lineTemplateBytes(lineTemplateOf(config, format))
+	}
+	if config.LineEnding == lineEndingCRLF || config.LineEnding == lineEndingMixed {
+		overhead++
+	}
+	if config.RestartsPerPod > 0 {
+		overhead += len(fmt.Sprintf("restart=%d ", config.RestartsPerPod))
+	}
+	if config.Profile == profileCatchUp {
+		overhead += catchUpTimestampBytes
+	}
+	if config.EmissionTimestamps {
+		overhead += emissionTimestampBytes
+	}
+	if config.ANSIColors {
+		overhead += ansiOverheadBytes(format)
+	}
+	if config.TimestampPrefix != nil {
+		overhead += config.TimestampPrefix.prefixBytes()
+	}
+	if config.TraceIDs != nil {
+		overhead += traceMarkerBytes
+	}
+	if len(config.Incidents) > 0 {
+		overhead += incidentMarkerBytes()
+	}
+	if config.RequestFlows != nil {
+		overhead += config.RequestFlows.markerBytes()
+	}
+	if config.Anomalies != nil {
+		overhead += anomalyMarkerBytes()
+	}
+
+	return overhead
+}
+
+// formats returns every format printed during the run.
+func formats(config Config) []string {
+	formats := []string{config.Format}
+	if config.FormatMigration != nil {
+		formats = append(formats, config.FormatMigration.To)
+	}
+	for _, container := range config.LoggerContainers {
+		if container.Format != "" && !slices.Contains(formats, container.Format) {
+			formats = append(formats, container.Format)
+		}
+	}
+
+	return formats
+}
+
+// emitFunctions defines payload, the fake_<field> and status functions the
+// lines need, emit_<format> for every format of the run and emit_line, which
+// prints a line in the format current at the time of the call.
+//
+// emit_<format> prints one line of $1 bytes, its message starting with the
+// optional $2 and ending with the optional $sfx, then the carriage return in
+// $cr and, unless $hold is set, the newline. emit_line wraps it in the
+// commands of the options of config, documented on the helpers building
+// them.
+func emitFunctions(config Config) string {
+	functions := []string{payloadFunction(config)}
+	if usesFakeValues(config) {
+		functions = append(functions, fakeFunctions())
+	} else if len(config.Incidents) > 0 {
+		functions = append(functions, pickFunction)
+	}
+	if usesLineTemplates(config) {
+		functions = append(functions, statusFunction(config.StatusCodes))
+	}
+	switch config.LineEnding {
+	case lineEndingCRLF:
+		functions = append(functions, `cr=$(printf '\r')`)
+	case lineEndingMixed:
+		functions = append(functions, `crlf=$(printf '\r')`)
+	}
+	if config.ANSIColors {
+		functions = append(functions, `esc=$(printf '\033')`)
+	}
+	if config.RequestFlows != nil {
+		functions = append(functions, config.RequestFlows.flowCommand(config.requestFlowSeed))
+	}
+	if config.TimestampPrefix != nil && config.TimestampPrefix.ClockSkewSeconds > 0 {
+		functions = append(functions, config.TimestampPrefix.skewCommand())
+	}
+	if len(config.Incidents) > 0 {
+		functions = append(functions, incidentFlagsCommand(config.Incidents))
+	}
+	for _, format := range formats(config) {
+		switch format {
+		case formatJSON:
+			functions = append(functions, jsonFunction(config))
+		case formatTemplate, formatCombined:
+			functions = append(functions, templateFunction(format, lineTemplateOf(config, format)))
+		default:
+			functions = append(functions, `emit_plain() { printf '%s' "$2"; payload $(($1 - ${#2} - ${#sfx} - ${#cr})); printf '%s%s' "$sfx" "$cr"; [ -n "$hold" ] || echo; }`)
+		}
+	}
+
+	emit := switchFormat(config, func(format string) string {
+		if config.ANSIColors {
+			reset, start := ansiColorArgs(format)
+			return fmt.Sprintf(`%s; emit_%s "$1" "$2"%s`, reset, format, start)
+		}
+		return fmt.Sprintf(`emit_%s "$1" "$2"`, format)
+	})
+	if config.TimestampPrefix != nil {
+		emit = config.TimestampPrefix.prefixCommand() + "; " + emit
+	}
+	if config.DuplicateLines != nil && config.DuplicateLines.Scope == duplicateLinesPod {
+		emit = config.DuplicateLines.copyCommand(emit)
+	}
+	if config.PartialLines != nil {
+		emit = config.PartialLines.partialLineCommand(emit)
+	}
+	if slices.ContainsFunc(config.Incidents, func(incident Incident) bool { return incident.StackTraces }) {
+		emit += "; " + stackTraceCommand()
+	}
+	if config.InvalidBytes != nil {
+		emit = config.InvalidBytes.injectCommand() + "; " + emit
+	}
+	if config.Anomalies != nil {
+		emit = config.Anomalies.markerCommand() + "; " + emit
+	}
+	if len(config.Incidents) > 0 {
+		emit = incidentErrorCommand(config.Incidents) + "; " + emit
+	}
+	if config.RequestFlows != nil {
+		emit = config.RequestFlows.markerCommand() + "; " + emit
+	}
+	if config.TraceIDs != nil {
+		emit = config.TraceIDs.markerCommand() + "; " + emit
+	}
+	if config.ANSIColors {
+		// Every line takes the next color.
+		emit = fmt.Sprintf(`color=$((color %% %d + 1)); `, ansiColors) + emit
+	}
+	if config.LineEnding == lineEndingMixed {
+		// Every other line, starting with the first, ends with a carriage return.
+		emit = `if [ -n "$cr" ]; then cr=; else cr=$crlf; fi; ` + emit
+	}
+	if config.StderrPercent > 0 {
+		// stderr_percent of the lines, spread evenly, go to standard error.
+		emit = fmt.Sprintf(`emitted=$((emitted + 1)); if %s; then { %s; } >&2; else %s; fi`, spreadCondition("emitted", config.StderrPercent), emit, emit)
+	}
+	if config.DuplicateLines != nil && config.DuplicateLines.Scope == duplicateLinesRun {
+		emit += "; " + config.DuplicateLines.runLineCommand(config.duplicateRunLines)
+	}
+	if config.BlankLines != nil {
+		emit = config.BlankLines.blankLineCommand() + "; " + emit
+	}
+	if config.TimestampPrefix != nil {
+		emit = config.TimestampPrefix.clockCommand() + "; " + emit
+	}
+	functions = append(functions, fmt.Sprintf(`emit_line() { %s; }`, emit))
+
+	return strings.Join(functions, "; ")
+}
+
+// jsonFunction returns emit_json, printing the json lines with the fake
+// fields of config and, with incidents, the level in $level.
+func jsonFunction(config Config) string {
+	level, levelArg, overhead := "info", "", strconv.Itoa(jsonFormatOverheadBytes)
+	if len(config.Incidents) > 0 {
+		level, levelArg, overhead = "%s", ` "$level"`, fmt.Sprintf(`%d - ${#level}`, jsonFormatOverheadBytes-len("info"))
+	}
+	setup, fields, fieldsArg := "", "", ""
+	if len(config.FakeFields) > 0 {
+		setup, fields, fieldsArg = "fields="+fakeFieldsWord(config.FakeFields)+"; ", "%s", ` "$fields"`
+		overhead += " - ${#fields}"
+	}
+
+	return fmt.Sprintf(`emit_json() { %sprintf '{"level":"%s",%s"msg":"%%s%%s%%s"}%%s'%s%s "$2" "$(payload $(($1 - %s - ${#2} - ${#sfx} - ${#cr})))" "$sfx" "$cr"; [ -n "$hold" ] || echo; }`,
+		setup, level, fields, levelArg, fieldsArg, overhead)
+}
+
+// switchFormat returns the shell command built by command for the format
+// current at the time it runs. Without a migration, it is the command of the
+// configured format; otherwise the pod compares its clock with the cutover.
+func switchFormat(config Config, command func(format string) string) string {
+	if config.FormatMigration == nil {
+		return command(config.Format)
+	}
+
+	return fmt.Sprintf(`if [ "$(date +%%s)" -lt %d ]; then %s; else %s; fi`,
+		config.formatCutover.Unix(), command(config.Format), command(config.FormatMigration.To))
+}
+
+// formatCutover returns when the format migration takes effect, measured
+// from now.
+func formatCutover(migration FormatMigration) time.Time {
+	return time.Now().Add(time.Duration(migration.AfterMinutes) * time.Minute).Truncate(time.Second)
+}
+
+// spreadCondition returns the shell test that holds for percent percent of
+// the successive values of the counter variable, spread evenly.
+func spreadCondition(counter string, percent int) string {
+	return fmt.Sprintf(`[ $((%[1]s * %[2]d / 100)) -gt $(((%[1]s - 1) * %[2]d / 100)) ]`, counter, percent)
+}
+
+// spreadSelected reports whether the n-th value of a counter passes the
+// spreadCondition of percent.
+func spreadSelected(n, percent int) bool {
+	return n*percent/100 > (n-1)*percent/100
+}
+
+// spreadCount returns how many of the first n values of a counter pass the
+// spreadCondition of percent.
+func spreadCount(n, percent int) int {
+	return n * percent / 100
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	controlConfigMapName = "logger-control"
+	controlMountPath     = "/etc/logger-control"
+)
+
+// minFreezeWindowMinutes is the shortest freeze window. The kubelet updates
+// mounted ConfigMaps every sync period plus the TTL of its cache, about 60 to
+// 90 seconds by default, so the loggers may not see a shorter window at all.
+const minFreezeWindowMinutes = 2
+
+type FreezeWindow struct {
+	StartMinute     int `yaml:"start_minute"`
+	DurationMinutes int `yaml:"duration_minutes"`
+}
+
+// waitIfPausedFunction is prepended to the script when freeze windows are
+// configured. Loggers call it before every line and block while the control
+// ConfigMap says they are paused.
+const waitIfPausedFunction = `wait_if_paused() { while [ "$(cat ` + controlMountPath + `/paused 2>/dev/null)" = "true" ]; do sleep 1; done; }`
+
+func createControlConfigMap(clientset *kubernetes.Clientset, namespace string) {
+	_, err := clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: controlConfigMapName,
+		},
+		Data: map[string]string{
+			"paused": "false",
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		fatal("Failed to create ConfigMap", "configmap", controlConfigMapName, "namespace", namespace, "error", err)
+	}
+}
+
+func setPaused(clientset *kubernetes.Clientset, namespaces []string, paused bool) {
+	for _, ns := range namespaces {
+		configMap, err := clientset.CoreV1().ConfigMaps(ns).Get(context.TODO(), controlConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			fatal("Failed to get ConfigMap", "configmap", controlConfigMapName, "namespace", ns, "error", err)
+		}
+
+		configMap.Data["paused"] = strconv.FormatBool(paused)
+		_, err = clientset.CoreV1().ConfigMaps(ns).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+		if err != nil {
+			fatal("Failed to update ConfigMap", "configmap", controlConfigMapName, "namespace", ns, "error", err)
+		}
+	}
+}
+
+// runFreezeWindows pauses every logger, those of the churned namespaces
+// included, and pod creation during the configured windows, measured from
+// startTime.
+func runFreezeWindows(clientset *kubernetes.Clientset, namespaces []string, churned *churnedNamespaces, windows []FreezeWindow, startTime time.Time, frozen *atomic.Bool) {
+	for _, window := range windows {
+		start := startTime.Add(time.Duration(window.StartMinute) * time.Minute)
+		end := start.Add(time.Duration(window.DurationMinutes) * time.Minute)
+
+		time.Sleep(time.Until(start))
+		frozen.Store(true)
+		churned.pause(true, func(churnedNamespaces []string) {
+			setPaused(clientset, append(slices.Clone(namespaces), churnedNamespaces...), true)
+		})
+		slog.Info("Freeze started", "resumes_at", end.Format(time.RFC3339))
+
+		time.Sleep(time.Until(end))
+		churned.pause(false, func(churnedNamespaces []string) {
+			setPaused(clientset, append(slices.Clone(namespaces), churnedNamespaces...), false)
+		})
+		frozen.Store(false)
+		slog.Info("Freeze ended")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/plan"
+)
+
+// NamespaceGroup is a set of consecutive namespaces of the run with its own
+// schedule and share of the pods.
+type NamespaceGroup struct {
+	Name            string `yaml:"name"`
+	Namespaces      int    `yaml:"namespaces"`
+	StartMinute     int    `yaml:"start_minute"`
+	DurationMinutes int    `yaml:"duration_minutes"`
+	Share           int    `yaml:"share"`
+}
+
+type namespaceGroup struct {
+	name       string
+	namespaces []string
+	weights    []float64
+	totalPods  int
+	startTime  time.Time
+	stopTime   time.Time
+}
+
+// buildNamespaceGroups assigns the namespaces of the run to the configured
+// groups in order and splits totalPods between the groups by share.
+// Namespaces missing from created, because their creation was skipped, are
+// left out. Without groups, every namespace belongs to a single group running
+// for the whole run.
+func buildNamespaceGroups(config Config, created []string, totalPods int, startTime time.Time) []namespaceGroup {
+	groupConfigs := config.NamespaceGroups
+	if len(groupConfigs) == 0 {
+		groupConfigs = []NamespaceGroup{{
+			Namespaces:      config.NumK8sNamespaces,
+			DurationMinutes: config.RunDurationMinutes,
+			Share:           1,
+		}}
+	}
+
+	isCreated := make(map[string]bool, len(created))
+	for _, ns := range created {
+		isCreated[ns] = true
+	}
+
+	totalShares := 0
+	for _, gc := range groupConfigs {
+		totalShares += gc.Share
+	}
+
+	names := namespaceNames(config.NumK8sNamespaces, config.NamespacePrefix)
+	groups := make([]namespaceGroup, 0, len(groupConfigs))
+	first := 0
+	for _, gc := range groupConfigs {
+		group := namespaceGroup{
+			name:      gc.Name,
+			startTime: startTime.Add(time.Duration(gc.StartMinute) * time.Minute),
+		}
+		group.stopTime = group.startTime.Add(time.Duration(gc.DurationMinutes) * time.Minute)
+
+		for i := first; i < first+gc.Namespaces; i++ {
+			if !isCreated[names[i]] {
+				continue
+			}
+			group.namespaces = append(group.namespaces, names[i])
+			if len(config.NamespaceWeights) > 0 {
+				group.weights = append(group.weights, config.NamespaceWeights[i])
+			}
+		}
+		first += gc.Namespaces
+
+		if len(group.namespaces) == 0 {
+			slog.Warn("Namespace group has no namespace left and is skipped", "group", gc.Name)
+			continue
+		}
+
+		pods, err := plan.CeilDiv(int64(totalPods)*int64(gc.Share), int64(totalShares))
+		if err != nil {
+			fatal("Failed to plan pods of namespace group", "group", gc.Name, "error", err)
+		}
+		group.totalPods = int(pods)
+
+		groups = append(groups, group)
+	}
+
+	return groups
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+const (
+	defaultIncidentErrorPercent = 80
+
+	// runStartEnv holds the start of the run on the cluster of a pod, in
+	// Unix seconds, which the windows of incidents are measured from.
+	runStartEnv = "LOGGER_RUN_START"
+)
+
+// incidentErrors are the exceptions the error lines of incidents report, one
+// picked at random per line.
+var incidentErrors = []string{
+	"java.lang.IllegalStateException: Connection pool exhausted",
+	"java.net.SocketTimeoutException: Read timed out",
+	"java.lang.NullPointerException: order.customer is null",
+	"org.postgresql.util.PSQLException: FATAL: too many clients already",
+	"io.grpc.StatusRuntimeException: UNAVAILABLE: upstream connect error",
+}
+
+// incidentStackFrames are the frames of the stack trace following every
+// error line of incidents with stack_traces, each printed on a line of its
+// own after a tab and "at ".
+var incidentStackFrames = []string{
+	"com.example.orders.OrderRepository.save(OrderRepository.java:87)",
+	"com.example.orders.OrderService.place(OrderService.java:142)",
+	"com.example.orders.OrderController.create(OrderController.java:58)",
+	"org.springframework.web.servlet.FrameworkServlet.service(FrameworkServlet.java:897)",
+	"java.base/java.lang.Thread.run(Thread.java:1583)",
+}
+
+// Incident turns a share of the pods to error-heavy output for a window of
+// the run, as an outage would, so alert rules can be rehearsed against it.
+type Incident struct {
+	StartMinute     int  `yaml:"start_minute"`
+	DurationMinutes int  `yaml:"duration_minutes"`
+	PodsPercent     int  `yaml:"pods_percent"`
+	ErrorPercent    int  `yaml:"error_percent"`
+	StackTraces     bool `yaml:"stack_traces"`
+}
+
+// window returns the start and end of the incident on the clock of the
+// nodes, for a run started at startTime.
+func (i *Incident) window(startTime time.Time) (start, end time.Time) {
+	start = startTime.Truncate(time.Second).Add(time.Duration(i.StartMinute) * time.Minute)
+	return start, start.Add(time.Duration(i.DurationMinutes) * time.Minute)
+}
+
+// withRunStart returns podSpec with runStartEnv set to startTime in every
+// container, so the pods measure the windows of incidents from it.
+func withRunStart(podSpec v1.PodSpec, startTime time.Time) v1.PodSpec {
+	spec := *podSpec.DeepCopy()
+	env := v1.EnvVar{Name: runStartEnv, Value: strconv.FormatInt(startTime.Unix(), 10)}
+	for i := range spec.InitContainers {
+		spec.InitContainers[i].Env = append(spec.InitContainers[i].Env, env)
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].Env = append(spec.Containers[i].Env, env)
+	}
+
+	return spec
+}
+
+// affected reports whether the pod numbered podNumber is one of the
+// PodsPercent percent of the pods taking part in the incident, spread evenly
+// over the run.
+func (i *Incident) affected(podNumber int) bool {
+	return (podNumber+1)*i.PodsPercent/100 > podNumber*i.PodsPercent/100
+}
+
+// incidentMarkerBytes returns the most bytes the error marker of incidents
+// adds to a line.
+func incidentMarkerBytes() int {
+	return len("ERROR ") + longestWord(incidentErrors) + len(" ")
+}
+
+// incidentFlagsCommand returns the shell command setting $incident<n> when
+// the pod takes part in incident n, as affected decides from the number
+// ending its name in $HOSTNAME, and $incidents when it takes part in any.
+func incidentFlagsCommand(incidents []Incident) string {
+	commands := make([]string, len(incidents))
+	for n, incident := range incidents {
+		commands[n] = fmt.Sprintf(`if [ $(((${HOSTNAME##*-} + 1) * %[2]d / 100)) -gt $((${HOSTNAME##*-} * %[2]d / 100)) ]; then incident%[1]d=1; incidents=1; fi`, n, incident.PodsPercent)
+	}
+
+	return strings.Join(commands, "; ")
+}
+
+// incidentErrorCommand returns the shell command turning ErrorPercent
+// percent of the lines of the pods of an incident printed during its window,
+// measured from the start of the run in runStartEnv, spread evenly, into
+// error lines: it sets $erred, and $stack with stack_traces, sets $level to
+// error and appends the error marker to the markers in $2. Other lines get
+// the info level.
+func incidentErrorCommand(incidents []Incident) string {
+	checks := make([]string, len(incidents))
+	for n, incident := range incidents {
+		stack := ""
+		if incident.StackTraces {
+			stack = " stack=1;"
+		}
+		checks[n] = fmt.Sprintf(`if [ -n "$incident%[1]d" ] && [ $elapsed -ge %[2]d ] && [ $elapsed -lt %[3]d ]; then errors%[1]d=$((errors%[1]d + 1)); if %[4]s; then erred=1;%[5]s fi; fi`,
+			n, incident.StartMinute*60, (incident.StartMinute+incident.DurationMinutes)*60, spreadCondition(fmt.Sprintf("errors%d", n), incident.ErrorPercent), stack)
+	}
+
+	return fmt.Sprintf(`erred=; stack=; level=info; if [ -n "$incidents" ]; then elapsed=$(($(date +%%s) - $%s)); %s; fi; if [ -n "$erred" ]; then level=error; set -- "$1" "${2}ERROR $(pick %s) "; fi`,
+		runStartEnv, strings.Join(checks, "; "), shellWords(incidentErrors))
+}
+
+// stackTraceCommand returns the shell command printing a stack trace after
+// the error lines setting $stack.
+func stackTraceCommand() string {
+	return fmt.Sprintf(`[ -z "$stack" ] || printf '\tat %%s\n' %s`, shellWords(incidentStackFrames))
+}
+
+// cutStackTraces removes the lines of the stack traces of incidents from
+// lines and returns the others and the number of stack traces removed.
+func cutStackTraces(lines []string) ([]string, int) {
+	var kept []string
+	frames := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "\tat ") {
+			frames++
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	return kept, frames / len(incidentStackFrames)
+}
+
+// cutErrorMarker verifies that message starts with the error marker of
+// incidents and returns the rest.
+func cutErrorMarker(message string) (string, error) {
+	for _, incidentError := range incidentErrors {
+		if rest, ok := strings.CutPrefix(message, "ERROR "+incidentError+" "); ok {
+			return rest, nil
+		}
+	}
+
+	return "", fmt.Errorf("no error marker")
+}
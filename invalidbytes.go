@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+const (
+	invalidBytesUTF8    = "utf8"
+	invalidBytesControl = "control"
+)
+
+// invalidByteRanges holds the first and last byte injected for every kind of
+// invalid_bytes: bytes that never occur in valid UTF-8, and the control
+// characters before the tab, which no line ending or whitespace rule takes
+// care of.
+var invalidByteRanges = map[string][2]byte{
+	invalidBytesUTF8:    {0xf5, 0xff},
+	invalidBytesControl: {0x01, 0x08},
+}
+
+// InvalidBytes starts the payload of a share of the lines with a byte that
+// is not valid UTF-8 or is a raw control character, to test the pipelines
+// and backends that expect valid UTF-8 text.
+type InvalidBytes struct {
+	Percent int    `yaml:"percent"`
+	Kind    string `yaml:"kind"`
+}
+
+// injectCommand returns the shell command appending one of the bytes of the
+// kind to the markers in $2 of Percent percent of the lines, spread evenly
+// over the lines of the pod, so the byte takes the place of the first byte
+// of the payload. The bytes are used in turn.
+func (b *InvalidBytes) injectCommand() string {
+	first, last := invalidByteRanges[b.Kind][0], invalidByteRanges[b.Kind][1]
+
+	return fmt.Sprintf(`invalids=$((invalids + 1)); if %s; then set -- "$1" "$2$(printf "\\$(printf %%o $((%d + invalids %% %d)))")"; fi`,
+		spreadCondition("invalids", b.Percent), first, last-first+1)
+}
+
+// cutInvalidByte removes the single invalid byte of the kind from line,
+// failing if line holds none or more than one.
+func (b *InvalidBytes) cutInvalidByte(line string) (string, error) {
+	first, last := invalidByteRanges[b.Kind][0], invalidByteRanges[b.Kind][1]
+	i := -1
+	for j := 0; j < len(line); j++ {
+		if first <= line[j] && line[j] <= last {
+			if i >= 0 {
+				return "", fmt.Errorf("more than one invalid byte")
+			}
+			i = j
+		}
+	}
+	if i < 0 {
+		return "", fmt.Errorf("no invalid byte")
+	}
+
+	return line[:i] + line[i+1:], nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Content types of the Kafka REST Proxy v2 API.
+const (
+	kafkaRESTContentType = "application/vnd.kafka.v2+json"
+	kafkaRESTJSONRecords = "application/vnd.kafka.json.v2+json"
+)
+
+// kafkaConsumer consumes a topic from the beginning through the consumer
+// API of a Kafka REST Proxy, as a consumer instance of its own group. The
+// credentials are only ever sent in the headers of the requests.
+type kafkaConsumer struct {
+	addr     string
+	username string
+	password string
+	client   *http.Client
+
+	// base is the URL of the consumer instance once created.
+	base string
+}
+
+type kafkaRecord struct {
+	Value json.RawMessage `json:"value"`
+}
+
+func (c *kafkaConsumer) do(ctx context.Context, method, rawURL string, body interface{}, accept string, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaRESTContentType)
+	req.Header.Set("Accept", accept)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %w", method, rawURL, responseError(resp, data))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// subscribe creates a consumer instance of group reading topic from its
+// earliest offset, without committing offsets.
+func (c *kafkaConsumer) subscribe(ctx context.Context, group, topic string) error {
+	var instance struct {
+		InstanceID string `json:"instance_id"`
+	}
+	err := c.do(ctx, http.MethodPost, strings.TrimRight(c.addr, "/")+"/consumers/"+url.PathEscape(group), map[string]string{
+		"name":               "verify",
+		"format":             "json",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	}, kafkaRESTContentType, &instance)
+	if err != nil {
+		return fmt.Errorf("creating the consumer: %w", err)
+	}
+	c.base = strings.TrimRight(c.addr, "/") + "/consumers/" + url.PathEscape(group) + "/instances/" + url.PathEscape(instance.InstanceID)
+
+	if err := c.do(ctx, http.MethodPost, c.base+"/subscription", map[string][]string{"topics": {topic}}, kafkaRESTContentType, nil); err != nil {
+		return fmt.Errorf("subscribing to topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+// records returns the next records of the topic, fetched through queries.
+func (c *kafkaConsumer) records(ctx context.Context, queries *backendQueries) ([]kafkaRecord, error) {
+	var records []kafkaRecord
+	err := queries.do(ctx, "fetching records", func() error {
+		records = nil
+		return c.do(ctx, http.MethodGet, c.base+"/records?timeout=1000", nil, kafkaRESTJSONRecords, &records)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching records: %w", err)
+	}
+	return records, nil
+}
+
+// close deletes the consumer instance.
+func (c *kafkaConsumer) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.do(ctx, http.MethodDelete, c.base, nil, kafkaRESTContentType, nil); err != nil {
+		slog.Warn("Failed to delete the Kafka consumer", "error", err)
+	}
+}
+
+// jsonField returns the string at the dotted path in value, such as
+// kubernetes.pod_name.
+func jsonField(value map[string]interface{}, path string) (string, bool) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := value[key].(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		value = next
+	}
+
+	s, ok := value[keys[len(keys)-1]].(string)
+	return s, ok
+}
+
+// verifyKafka implements verify kafka: it consumes a topic from the
+// beginning until it stays idle, and counts the records of every pod whose
+// run ID is that of the run.
+func verifyKafka(configFile string, args []string) int {
+	var options verifyOptions
+	fs := flag.NewFlagSet("verify kafka", flag.ContinueOnError)
+	options.register(fs)
+	addr := fs.String("addr", "", "address of the Kafka REST Proxy, such as http://kafka-rest.logging:8082")
+	topic := fs.String("topic", "", "topic holding the lines")
+	username := fs.String("username", "", "user name for basic authentication")
+	passwordFrom := fs.String("password-from", "", "password for basic authentication: env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY")
+	runIDField := fs.String("run-id-field", "kubernetes.labels.k8s-pod-log-generator/run-id", "dotted path of the run-id label of the pod in the JSON records")
+	namespaceField := fs.String("namespace-field", "kubernetes.namespace_name", "dotted path of the namespace in the JSON records")
+	podField := fs.String("pod-field", "kubernetes.pod_name", "dotted path of the pod name in the JSON records")
+	idle := fs.Duration("idle", 10*time.Second, "how long the topic must have no new record for the consumption to end")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *addr == "" || *topic == "" || options.runID == "" {
+		fmt.Fprintln(os.Stderr, "verify kafka needs --addr, --topic and --run-id")
+		return 2
+	}
+	if err := options.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	clientsets, generated := verifyClusters(configFile, options.runID)
+
+	consumer := &kafkaConsumer{addr: *addr, username: *username, client: &http.Client{}}
+	if *passwordFrom != "" {
+		var err error
+		if consumer.password, err = readCredential(*passwordFrom, clientsets[0]); err != nil {
+			fatal("Failed to read the Kafka password", "error", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.timeout)
+	defer cancel()
+
+	// A group of its own makes every verification read the topic from the
+	// beginning.
+	group := fmt.Sprintf("k8s-pod-log-generator-verify-%s-%d", options.runID, time.Now().Unix())
+	if err := consumer.subscribe(ctx, group, *topic); err != nil {
+		fatal("Failed to consume the Kafka topic", "topic", *topic, "error", err)
+	}
+	defer consumer.close()
+
+	queries := newBackendQueries("Kafka", options)
+	received := make(map[podRef]int64)
+	var consumed, unreadable int64
+	lastRecord := time.Now()
+	for time.Since(lastRecord) < *idle {
+		records, err := consumer.records(ctx, queries)
+		if err != nil {
+			consumer.close()
+			fatal("Failed to consume the Kafka topic", "topic", *topic, "error", err)
+		}
+		if len(records) > 0 {
+			lastRecord = time.Now()
+		}
+
+		for _, record := range records {
+			consumed++
+			var value map[string]interface{}
+			if err := json.Unmarshal(record.Value, &value); err != nil {
+				unreadable++
+				continue
+			}
+			if runID, ok := jsonField(value, *runIDField); !ok || runID != options.runID {
+				continue
+			}
+			namespace, _ := jsonField(value, *namespaceField)
+			pod, _ := jsonField(value, *podField)
+			received[podRef{Namespace: namespace, Name: pod}]++
+		}
+		slog.Debug("Consumed Kafka records", "topic", *topic, "records", len(records), "total", consumed)
+	}
+	if unreadable > 0 {
+		slog.Warn("Records are not JSON objects and were left out", "topic", *topic, "records", unreadable)
+	}
+
+	return reportVerification("Kafka", compareLines(generated, received), options)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// emissionTimestampKey starts the emission timestamp of a line. The random
+// payload never contains it, as it has no "=".
+const emissionTimestampKey = "ts="
+
+// emissionTimestampBytes is the length of the "ts=<Unix milliseconds> "
+// marker, thirteen digits until the year 2286.
+const emissionTimestampBytes = len("ts=1700000000000 ")
+
+// emissionTimestampMarker prints the marker of the time the shell expands
+// it, with the %N of date.
+const emissionTimestampMarker = emissionTimestampKey + `$(($(date +%s%N) / 1000000)) `
+
+// parseEmissionTimestamp returns the emission timestamp anywhere in line, so
+// that lines wrapped by a collector are read too.
+func parseEmissionTimestamp(line string) (time.Time, bool) {
+	i := strings.Index(line, emissionTimestampKey)
+	if i < 0 {
+		return time.Time{}, false
+	}
+	digits, _, ok := strings.Cut(line[i+len(emissionTimestampKey):], " ")
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.UnixMilli(ms), true
+}
+
+// latencyOptions are the flags common to every backend of latency.
+type latencyOptions struct {
+	duration time.Duration
+	interval time.Duration
+	lookback time.Duration
+	samples  int
+}
+
+func (o *latencyOptions) register(fs *flag.FlagSet) {
+	fs.DurationVar(&o.duration, "duration", 0, "how long to sample, until interrupted if 0")
+	fs.DurationVar(&o.interval, "interval", 5*time.Second, "time between two samples, the resolution of the latencies")
+	fs.DurationVar(&o.lookback, "lookback", 5*time.Minute, "how far back every sample looks, more than the highest latency expected")
+	fs.IntVar(&o.samples, "samples", 100, "newest lines read per sample")
+}
+
+// latencySampler measures the latency of every line the first time it is
+// seen: the time it was seen minus its emission timestamp.
+type latencySampler struct {
+	// seen are the emission timestamps of the lines seen within the
+	// lookback, so that no line is measured twice.
+	seen      map[string]time.Time
+	latencies []time.Duration
+}
+
+func newLatencySampler() *latencySampler {
+	return &latencySampler{seen: make(map[string]time.Time)}
+}
+
+// observe measures the lines seen at the given time, and returns the number
+// of lines measured.
+func (s *latencySampler) observe(lines []string, at time.Time) int {
+	measured := 0
+	for _, line := range lines {
+		if _, ok := s.seen[line]; ok {
+			continue
+		}
+		emitted, ok := parseEmissionTimestamp(line)
+		if !ok {
+			continue
+		}
+		s.seen[line] = emitted
+		s.latencies = append(s.latencies, at.Sub(emitted))
+		measured++
+	}
+
+	return measured
+}
+
+// forget drops the lines emitted before the given time, which the samples
+// no longer return.
+func (s *latencySampler) forget(before time.Time) {
+	for line, emitted := range s.seen {
+		if emitted.Before(before) {
+			delete(s.seen, line)
+		}
+	}
+}
+
+// percentile returns the p-th percentile of sorted by the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(float64(len(sorted))*p/100+0.999999) - 1
+	return sorted[max(0, min(rank, len(sorted)-1))]
+}
+
+// print writes the percentiles of the latencies measured to w.
+func (s *latencySampler) print(w io.Writer, backend string, elapsed time.Duration) {
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	fmt.Fprintf(w, "%s: %d lines sampled over %s\n", backend, len(sorted), elapsed.Round(time.Second))
+	fmt.Fprintf(w, "Ingestion latency: p50 %s, p95 %s, p99 %s, max %s\n",
+		percentile(sorted, 50).Round(time.Millisecond), percentile(sorted, 95).Round(time.Millisecond),
+		percentile(sorted, 99).Round(time.Millisecond), sorted[len(sorted)-1].Round(time.Millisecond))
+}
+
+// measureLatency samples the newest lines with sample every interval until
+// the duration elapses or the program is interrupted, and prints the
+// latencies measured.
+func measureLatency(backend string, options latencyOptions, sample func(ctx context.Context, since time.Time) ([]string, error)) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if options.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.duration)
+		defer cancel()
+	}
+
+	start := time.Now()
+	sampler := newLatencySampler()
+	ticker := time.NewTicker(options.interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		lines, err := sample(ctx, now.Add(-options.lookback))
+		switch {
+		case ctx.Err() != nil:
+		case err != nil:
+			slog.Warn("Failed to sample the recent lines", "backend", backend, "error", err)
+		default:
+			measured := sampler.observe(lines, time.Now())
+			sampler.forget(now.Add(-2 * options.lookback))
+			slog.Debug("Sampled the recent lines", "backend", backend, "lines", len(lines), "measured", measured, "total", len(sampler.latencies))
+		}
+
+		select {
+		case <-ctx.Done():
+			if len(sampler.latencies) == 0 {
+				slog.Error("No line with an emission timestamp sampled", "backend", backend)
+				return 1
+			}
+			sampler.print(os.Stdout, backend, time.Since(start))
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// latencyCommand implements latency: while a run with emission_timestamps
+// prints, it samples the newest lines a log backend holds and reports the
+// percentiles of the time they took to become visible there.
+func latencyCommand(configFile string, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "latency needs a backend: loki, elasticsearch, opensearch, splunk or victorialogs")
+		return 2
+	}
+
+	switch args[0] {
+	case "loki":
+		return latencyLoki(configFile, args[1:])
+	case "elasticsearch":
+		return latencyElasticsearch(configFile, "Elasticsearch", args[1:])
+	case "opensearch":
+		return latencyElasticsearch(configFile, "OpenSearch", args[1:])
+	case "splunk":
+		return latencySplunk(configFile, args[1:])
+	case "victorialogs":
+		return latencyVictoriaLogs(configFile, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown latency backend %q: must be loki, elasticsearch, opensearch, splunk or victorialogs\n", args[0])
+		return 2
+	}
+}
+
+// secretClient connects to the first cluster of config if a credential of
+// refs is read from a Secret, and returns nil otherwise, so that latency can
+// run without access to the clusters.
+func secretClient(config Config, refs []string) *kubernetes.Clientset {
+	for _, ref := range refs {
+		if strings.HasPrefix(ref, "secret:") {
+			clusterConfigs, _ := clusterPods(config, 0)
+			_, clientset := connectCluster(config, clusterConfigs[0])
+			return clientset
+		}
+	}
+
+	return nil
+}
+
+func latencyLoki(configFile string, args []string) int {
+	var options latencyOptions
+	var loki lokiFlags
+	fs := flag.NewFlagSet("latency loki", flag.ContinueOnError)
+	options.register(fs)
+	loki.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := loki.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	config := loadConfig(configFile)
+	client := loki.client(secretClient(config, loki.credentialRefs()))
+	selector := fmt.Sprintf(`{%s=~%q}`, loki.namespaceLabel, config.NamespacePrefix+"-[0-9]+")
+
+	return measureLatency("Loki", options, func(ctx context.Context, since time.Time) ([]string, error) {
+		return client.recentLines(ctx, selector, since, options.samples)
+	})
+}
+
+func latencyElasticsearch(configFile, backend string, args []string) int {
+	var options latencyOptions
+	var es elasticsearchFlags
+	fs := flag.NewFlagSet("latency "+strings.ToLower(backend), flag.ContinueOnError)
+	options.register(fs)
+	es.register(fs)
+	runID := fs.String("run-id", "", "ID of the run to sample, as logged when it started")
+	messageField := fs.String("message-field", "log", "field holding the line")
+	timestampField := fs.String("timestamp-field", "@timestamp", "field holding the time of the line, to sort by")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := es.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *runID == "" {
+		fmt.Fprintln(os.Stderr, "--run-id is required")
+		return 2
+	}
+
+	config := loadConfig(configFile)
+	client := es.client(secretClient(config, es.credentialRefs()), backend)
+
+	return measureLatency(backend, options, func(ctx context.Context, since time.Time) ([]string, error) {
+		return client.recentLines(ctx, *runID, es.runIDField, *messageField, *timestampField, since, options.samples)
+	})
+}
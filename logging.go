@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Values of --log-format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// levelTrace is below debug, for the decisions taken for every pod.
+const levelTrace = slog.LevelDebug - 4
+
+// logLevel is the lowest level logged.
+var logLevel = new(slog.LevelVar)
+
+// verbosityLevel returns the lowest level logged with -v verbosity, or with
+// --quiet: info by default, debug from 1, trace from 2, and only warnings
+// and errors when quiet.
+func verbosityLevel(verbosity int, quiet bool) (slog.Level, error) {
+	switch {
+	case quiet && verbosity > 0:
+		return 0, fmt.Errorf("-v and --quiet cannot be used together")
+	case quiet:
+		return slog.LevelWarn, nil
+	case verbosity >= 2:
+		return levelTrace, nil
+	case verbosity == 1:
+		return slog.LevelDebug, nil
+	default:
+		return slog.LevelInfo, nil
+	}
+}
+
+// replaceLevel names levelTrace TRACE instead of DEBUG-4.
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.LevelKey && a.Value.Any() == levelTrace {
+		return slog.String(slog.LevelKey, "TRACE")
+	}
+	return a
+}
+
+// setupLogging makes the default slog logger write to standard error in
+// format, text or json, from level.
+func setupLogging(format string, level slog.Level) error {
+	logLevel.Set(level)
+	opts := &slog.HandlerOptions{Level: logLevel, ReplaceAttr: replaceLevel}
+
+	var handler slog.Handler
+	switch format {
+	case logFormatText:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q: must be %s or %s", format, logFormatText, logFormatJSON)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
+
+// logToDashboard makes the default logger write text lines without the time
+// to ring, and returns a function restoring the previous logger.
+func logToDashboard(ring *logRing) func() {
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(ring, &slog.HandlerOptions{
+		Level: logLevel,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return replaceLevel(groups, a)
+		},
+	})))
+
+	return func() { slog.SetDefault(previous) }
+}
+
+// fatal logs msg with args at the error level and exits with status 1.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// lokiClient queries the Loki HTTP API. The credentials are only ever sent
+// in the headers of the requests.
+type lokiClient struct {
+	addr     string
+	tenant   string
+	username string
+	password string
+	token    string
+	client   *http.Client
+}
+
+type lokiResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+	Error string `json:"error"`
+}
+
+// lokiFlags are the flags of the commands reading from Loki.
+type lokiFlags struct {
+	addr           string
+	tenant         string
+	username       string
+	passwordFrom   string
+	tokenFrom      string
+	namespaceLabel string
+	podLabel       string
+}
+
+func (f *lokiFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.addr, "addr", "", "address of Loki, such as http://loki.monitoring:3100")
+	fs.StringVar(&f.tenant, "tenant", "", "tenant sent as X-Scope-OrgID")
+	fs.StringVar(&f.username, "username", "", "user name for basic authentication")
+	fs.StringVar(&f.passwordFrom, "password-from", "", "password for basic authentication: env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY")
+	fs.StringVar(&f.tokenFrom, "token-from", "", "bearer token: env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY")
+	fs.StringVar(&f.namespaceLabel, "namespace-label", "namespace", "label of the streams holding the namespace")
+	fs.StringVar(&f.podLabel, "pod-label", "pod", "label of the streams holding the pod name")
+}
+
+// check returns the problem with the flags, if any.
+func (f *lokiFlags) check() error {
+	if f.addr == "" {
+		return fmt.Errorf("--addr is required")
+	}
+	if f.passwordFrom != "" && f.tokenFrom != "" {
+		return fmt.Errorf("--password-from and --token-from cannot be used together")
+	}
+	return nil
+}
+
+// credentialRefs returns the credentials the flags refer to.
+func (f *lokiFlags) credentialRefs() []string {
+	return []string{f.passwordFrom, f.tokenFrom}
+}
+
+// client returns the client of the flags, reading Secrets with clientset.
+func (f *lokiFlags) client(clientset *kubernetes.Clientset) *lokiClient {
+	client := &lokiClient{addr: f.addr, tenant: f.tenant, username: f.username, client: &http.Client{}}
+
+	var err error
+	if f.passwordFrom != "" {
+		if client.password, err = readCredential(f.passwordFrom, clientset); err != nil {
+			fatal("Failed to read the Loki password", "error", err)
+		}
+	}
+	if f.tokenFrom != "" {
+		if client.token, err = readCredential(f.tokenFrom, clientset); err != nil {
+			fatal("Failed to read the Loki token", "error", err)
+		}
+	}
+
+	return client
+}
+
+// get sends a query to path and decodes the response into result, which
+// must be of resultType.
+func (c *lokiClient) get(ctx context.Context, path string, params url.Values, resultType string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(c.addr, "/")+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if c.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", c.tenant)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp, body)
+	}
+
+	var parsed lokiResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return err
+	}
+	if parsed.Status != "success" {
+		return fmt.Errorf("%s", parsed.Error)
+	}
+	if parsed.Data.ResultType != resultType {
+		return fmt.Errorf("unexpected result type %q", parsed.Data.ResultType)
+	}
+
+	return json.Unmarshal(parsed.Data.Result, result)
+}
+
+// countLines returns the number of lines Loki holds per pod of namespace,
+// received since the given time, querying through queries. Streams are
+// matched on the labels namespaceLabel and podLabel.
+func (c *lokiClient) countLines(ctx context.Context, queries *backendQueries, namespace, namespaceLabel, podLabel string, since time.Time) (map[podRef]int64, error) {
+	now := time.Now()
+	window := int64(now.Sub(since.Add(-verifyQueryMargin)).Seconds()) + 1
+
+	params := url.Values{}
+	params.Set("query", fmt.Sprintf(`sum by (%s, %s) (count_over_time({%s=%q}[%ds]))`, namespaceLabel, podLabel, namespaceLabel, namespace, window))
+	params.Set("time", strconv.FormatInt(now.UnixNano(), 10))
+
+	var samples []struct {
+		Metric map[string]string `json:"metric"`
+		Value  [2]interface{}    `json:"value"`
+	}
+	err := queries.do(ctx, "namespace "+namespace, func() error {
+		return c.get(ctx, "/loki/api/v1/query", params, "vector", &samples)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query for namespace %s: %w", namespace, err)
+	}
+
+	counts := make(map[podRef]int64)
+	for _, sample := range samples {
+		value, ok := sample.Value[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("query for namespace %s: unexpected sample value %v", namespace, sample.Value[1])
+		}
+		count, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("query for namespace %s: %w", namespace, err)
+		}
+		pod := podRef{Namespace: sample.Metric[namespaceLabel], Name: sample.Metric[podLabel]}
+		counts[pod] += int64(count)
+	}
+
+	return counts, nil
+}
+
+// recentLines returns the newest limit lines of the streams matching
+// selector that carry an emission timestamp, since the given time.
+func (c *lokiClient) recentLines(ctx context.Context, selector string, since time.Time, limit int) ([]string, error) {
+	params := url.Values{}
+	params.Set("query", selector+` |= "`+emissionTimestampKey+`"`)
+	params.Set("start", strconv.FormatInt(since.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(time.Now().UnixNano(), 10))
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("direction", "backward")
+
+	var streams []struct {
+		Values [][2]string `json:"values"`
+	}
+	if err := c.get(ctx, "/loki/api/v1/query_range", params, "streams", &streams); err != nil {
+		return nil, fmt.Errorf("query of the recent lines: %w", err)
+	}
+
+	var lines []string
+	for _, stream := range streams {
+		for _, value := range stream.Values {
+			lines = append(lines, value[1])
+		}
+	}
+	return lines, nil
+}
+
+// verifyLoki implements verify loki.
+func verifyLoki(configFile string, args []string) int {
+	var options verifyOptions
+	var loki lokiFlags
+	fs := flag.NewFlagSet("verify loki", flag.ContinueOnError)
+	options.register(fs)
+	loki.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := loki.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := options.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	clientsets, generated := verifyClusters(configFile, options.runID)
+	client := loki.client(clientsets[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.timeout)
+	defer cancel()
+
+	// The namespaces are queried concurrently.
+	queries := newBackendQueries("Loki", options)
+	var mu sync.Mutex
+	received := make(map[podRef]int64)
+	err := queries.each(ctx, len(generated.namespaces), func(ctx context.Context, i int) error {
+		ns := generated.namespaces[i]
+		counts, err := client.countLines(ctx, queries, ns, loki.namespaceLabel, loki.podLabel, generated.since)
+		if err != nil {
+			return err
+		}
+		slog.Debug("Queried Loki", "namespace", ns, "pods", len(counts))
+
+		mu.Lock()
+		defer mu.Unlock()
+		for pod, count := range counts {
+			received[pod] += count
+		}
+		return nil
+	})
+	if err != nil {
+		fatal("Failed to query Loki", "addr", loki.addr, "error", err)
+	}
+
+	return reportVerification("Loki", compareLines(generated, received), options)
+}
@@ -2,94 +2,252 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
-	"math"
+	"log/slog"
 	"math/rand"
 	"os"
-	"path/filepath"
+	"os/exec"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"gopkg.in/yaml.v2"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/lifecycle"
+	"github.com/zinrai/k8s-pod-log-generator/pkg/placement"
+	"github.com/zinrai/k8s-pod-log-generator/pkg/plan"
 )
 
-type Config struct {
-	KubeconfigPath        string `yaml:"kubeconfig_path"`
-	NumK8sNamespaces      int    `yaml:"num_k8s_namespaces"`
-	BytesPerLogLine       int    `yaml:"bytes_per_log_line"`
-	KilobytesPerPodLog    int    `yaml:"kilobytes_per_pod_log"`
-	MegabytesTotalLogSize int    `yaml:"megabytes_total_log_size"`
-	RunDurationMinutes    int    `yaml:"run_duration_minutes"`
-	NamespacePrefix       string `yaml:"namespace_prefix"`
-	ConcurrentRequests    int    `yaml:"concurrent_requests"`
+const runIDLabel = "k8s-pod-log-generator/run-id"
+
+// totalLogLinesAnnotation holds the number of lines a logger pod prints.
+const totalLogLinesAnnotation = "total_log_lines"
+
+func buildPodAnnotations(totalLogLines int) map[string]string {
+	return map[string]string{
+		"app":                   "k8s-pod-log-generator",
+		totalLogLinesAnnotation: strconv.Itoa(totalLogLines),
+	}
+}
+
+func buildPodLabels(config Config, runID string) map[string]string {
+	labels := make(map[string]string, len(config.PodLabels)+4)
+	for key, value := range config.PodLabels {
+		labels[key] = value
+	}
+
+	labels["app"] = "k8s-pod-log-generator"
+	labels["app.kubernetes.io/managed-by"] = "k8s-pod-log-generator"
+	labels["profile"] = config.Profile
+	labels[runIDLabel] = runID
+
+	return labels
 }
 
-func calculateTotalLogLines(bytesPerLine int, kilobytesPerLog int) int {
-	bytesPerKilobyte := 1024
-	return int(math.Ceil(float64(kilobytesPerLog*bytesPerKilobyte) / float64(bytesPerLine)))
+func buildPodSpec(config Config, command []string) v1.PodSpec {
+	requests, _ := parseResourceList(config.Resources.Requests)
+	limits, _ := parseResourceList(config.Resources.Limits)
+
+	imagePullSecrets := make([]v1.LocalObjectReference, 0, len(config.ImagePullSecrets))
+	for _, name := range config.ImagePullSecrets {
+		imagePullSecrets = append(imagePullSecrets, v1.LocalObjectReference{Name: name})
+	}
+
+	var lifecycle *v1.Lifecycle
+	if config.PreStopSleepSeconds > 0 {
+		lifecycle = &v1.Lifecycle{
+			PreStop: &v1.LifecycleHandler{
+				Exec: &v1.ExecAction{
+					Command: []string{"sleep", strconv.Itoa(config.PreStopSleepSeconds)},
+				},
+			},
+		}
+	}
+
+	// Constraints without a labelSelector spread the logger pods themselves.
+	topologySpreadConstraints := make([]v1.TopologySpreadConstraint, len(config.topologySpreadConstraints))
+	for i, constraint := range config.topologySpreadConstraints {
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "k8s-pod-log-generator"},
+			}
+		}
+		topologySpreadConstraints[i] = constraint
+	}
+
+	var volumes []v1.Volume
+	var volumeMounts []v1.VolumeMount
+	if config.PodSecurityStandard == podSecurityRestricted {
+		// The root filesystem is read-only, so scripts that buffer output
+		// need a writable /tmp.
+		volumes = append(volumes, v1.Volume{
+			Name: "tmp",
+			VolumeSource: v1.VolumeSource{
+				EmptyDir: &v1.EmptyDirVolumeSource{},
+			},
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      "tmp",
+			MountPath: "/tmp",
+		})
+	}
+	if len(config.FreezeWindows) > 0 {
+		optional := true
+		volumes = append(volumes, v1.Volume{
+			Name: controlConfigMapName,
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: controlConfigMapName},
+					Optional:             &optional,
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      controlConfigMapName,
+			MountPath: controlMountPath,
+			ReadOnly:  true,
+		})
+	}
+
+	var env []v1.EnvVar
+	if config.PodConfig != nil {
+		configVolumes, configVolumeMounts, configEnv := podConfigVolumes(*config.PodConfig)
+		volumes = append(volumes, configVolumes...)
+		volumeMounts = append(volumeMounts, configVolumeMounts...)
+		env = configEnv
+	}
+
+	restartPolicy := v1.RestartPolicyNever
+	if config.RestartsPerPod > 0 {
+		restartPolicy = v1.RestartPolicyOnFailure
+		volume, volumeMount := restartStateVolume()
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, volumeMount)
+	}
+
+	return v1.PodSpec{
+		RestartPolicy:                 restartPolicy,
+		SecurityContext:               buildPodSecurityContext(config.PodSecurityStandard),
+		TerminationGracePeriodSeconds: config.TerminationGracePeriodSeconds,
+		ImagePullSecrets:              imagePullSecrets,
+		NodeSelector:                  config.NodeSelector,
+		Affinity:                      config.affinity,
+		Tolerations:                   config.tolerations,
+		TopologySpreadConstraints:     topologySpreadConstraints,
+		PriorityClassName:             config.PriorityClassName,
+		Volumes:                       volumes,
+		Containers: []v1.Container{
+			{
+				Name:            loggerContainerName,
+				Image:           config.ContainerImage,
+				ImagePullPolicy: v1.PullPolicy(config.ImagePullPolicy),
+				Command:         command,
+				Env:             env,
+				Lifecycle:       lifecycle,
+				VolumeMounts:    volumeMounts,
+				SecurityContext: buildContainerSecurityContext(config.PodSecurityStandard),
+				Resources: v1.ResourceRequirements{
+					Requests: requests,
+					Limits:   limits,
+				},
+			},
+		},
+	}
 }
 
-func calculateTotalPods(megabytesTotalLogSize, kilobytesPerPodLog int) int {
-	kilobytesPerMegabyte := 1024
-	totalKilobytes := megabytesTotalLogSize * kilobytesPerMegabyte
-	return int(math.Ceil(float64(totalKilobytes) / float64(kilobytesPerPodLog)))
+// runningInCluster reports whether the process runs in a pod, where the
+// kubelet injects the address of the API server.
+func runningInCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
 }
 
-func createPod(clientset *kubernetes.Clientset, namespace, podName string, totalLogLines, bytesPerLine int) {
-	annotations := map[string]string{
-		"app":             "k8s-pod-log-generator",
-		"total_log_lines": strconv.Itoa(totalLogLines),
+// buildRestConfig loads kubeconfigPath using kubeContext, or its current
+// context if kubeContext is empty. It returns the in-cluster configuration if
+// kubeconfigPath is empty.
+func buildRestConfig(kubeconfigPath, kubeContext string) (*rest.Config, error) {
+	if kubeconfigPath == "" {
+		slog.Info("Using in-cluster configuration")
+		return rest.InClusterConfig()
 	}
 
-	_, err := clientset.CoreV1().Pods(namespace).Create(context.TODO(), &v1.Pod{
+	kubeconfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", kubeconfigPath, err)
+	}
+
+	return kubeconfig, nil
+}
+
+func createPod(clientset *kubernetes.Clientset, namespace, podName string, totalLogLines int, labels map[string]string, podSpec v1.PodSpec) error {
+	_, err := clientset.CoreV1().Pods(namespace).Create(context.TODO(), buildPod(podName, totalLogLines, labels, podSpec), metav1.CreateOptions{})
+	return err
+}
+
+// dryRunPod sends the creation of a logger pod to the API server without
+// persisting it, so admission webhooks, quotas and Pod Security Admission
+// reject a pod that would fail the run before the run starts.
+func dryRunPod(clientset *kubernetes.Clientset, namespace string, totalLogLines int, labels map[string]string, podSpec v1.PodSpec) error {
+	_, err := clientset.CoreV1().Pods(namespace).Create(context.TODO(), buildPod("logger-pod-dry-run", totalLogLines, labels, podSpec), metav1.CreateOptions{
+		DryRun: []string{metav1.DryRunAll},
+	})
+	return err
+}
+
+func buildPod(podName string, totalLogLines int, labels map[string]string, podSpec v1.PodSpec) *v1.Pod {
+	return &v1.Pod{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Pod",
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        podName,
-			Annotations: annotations,
-		},
-		Spec: v1.PodSpec{
-			RestartPolicy: v1.RestartPolicyNever,
-			Containers: []v1.Container{
-				{
-					Name:  "logger-container",
-					Image: "busybox:1.36.1-uclibc",
-					Command: []string{
-						"/bin/sh",
-						"-c",
-						fmt.Sprintf("for i in $(seq 1 %d); do cat /dev/urandom | tr -dc 'a-zA-Z0-9' | head -c %d; echo; done", totalLogLines, bytesPerLine),
-					},
-				},
-			},
+			Labels:      labels,
+			Annotations: buildPodAnnotations(totalLogLines),
 		},
-	}, metav1.CreateOptions{})
-	if err != nil {
-		log.Fatalf("Failed to create Pod %s in namespace %s: %v", podName, namespace, err)
+		Spec: podSpec,
+	}
+}
+
+func buildNamespaceLabels(config Config) map[string]string {
+	labels := buildNamespaceSecurityLabels(config.PodSecurityStandard)
+	for key, value := range config.NamespaceLabels {
+		labels[key] = value
 	}
+
+	return labels
 }
 
-func createNamespaces(clientset *kubernetes.Clientset, numK8sNamespaces int, namespacePrefix string) []string {
-	namespaces := make([]string, numK8sNamespaces)
+func namespaceNames(numK8sNamespaces int, namespacePrefix string) []string {
+	names := make([]string, numK8sNamespaces)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", namespacePrefix, i+1)
+	}
+
+	return names
+}
 
-	for i := 1; i <= numK8sNamespaces; i++ {
-		namespaceName := fmt.Sprintf("%s-%d", namespacePrefix, i)
+func createNamespaces(clientset *kubernetes.Clientset, numK8sNamespaces int, namespacePrefix string, labels, annotations map[string]string, errPolicy *errorPolicy) []string {
+	var namespaces []string
 
+	for _, namespaceName := range namespaceNames(numK8sNamespaces, namespacePrefix) {
 		_, err := clientset.CoreV1().Namespaces().Get(context.TODO(), namespaceName, metav1.GetOptions{})
 		if err == nil {
 			err = clientset.CoreV1().Namespaces().Delete(context.TODO(), namespaceName, metav1.DeleteOptions{})
 			if err != nil {
-				log.Fatalf("Failed to delete existing namespace %s: %v", namespaceName, err)
+				errPolicy.fail(operationNamespaceCreation, namespaceName, fmt.Errorf("deleting the existing namespace: %w", err))
+				continue
 			}
-			log.Printf("Deleted existing namespace %s", namespaceName)
+			slog.Info("Deleted existing namespace", "namespace", namespaceName)
 
 			for {
 				_, err = clientset.CoreV1().Namespaces().Get(context.TODO(), namespaceName, metav1.GetOptions{})
@@ -102,118 +260,818 @@ func createNamespaces(clientset *kubernetes.Clientset, numK8sNamespaces int, nam
 
 		_, err = clientset.CoreV1().Namespaces().Create(context.TODO(), &v1.Namespace{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: namespaceName,
+				Name:        namespaceName,
+				Labels:      labels,
+				Annotations: annotations,
 			},
 		}, metav1.CreateOptions{})
 		if err != nil {
-			log.Fatalf("Failed to create namespace %s: %v", namespaceName, err)
+			errPolicy.fail(operationNamespaceCreation, namespaceName, err)
+			continue
 		}
-		log.Printf("Namespace %s created", namespaceName)
-		namespaces[i-1] = namespaceName
+		slog.Info("Namespace created", "namespace", namespaceName)
+		namespaces = append(namespaces, namespaceName)
+	}
+
+	if len(namespaces) == 0 {
+		fatal("No namespace could be created")
 	}
 
 	return namespaces
 }
 
-func getRunningPodCount(clientset *kubernetes.Clientset, namespace string) int {
-	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
-		FieldSelector: "status.phase!=Succeeded,status.phase!=Failed",
+// setUpNamespace creates what the logger pods of namespace need besides the
+// namespace itself.
+func setUpNamespace(clientset *kubernetes.Clientset, config Config, namespace, runID string) {
+	copySecrets(clientset, config.ImagePullSecretsFrom, namespace, config.ImagePullSecrets)
+	if config.PodDisruptionBudget {
+		createPodDisruptionBudget(clientset, namespace, runID)
+	}
+	if len(config.FreezeWindows) > 0 {
+		createControlConfigMap(clientset, namespace)
+	}
+	if config.PodConfig != nil {
+		createPodConfig(clientset, namespace, *config.PodConfig)
+	}
+	if config.TenantImpersonation {
+		createTenant(clientset, namespace)
+	}
+}
+
+func copySecrets(clientset *kubernetes.Clientset, sourceNamespace, targetNamespace string, secretNames []string) {
+	for _, name := range secretNames {
+		secret, err := clientset.CoreV1().Secrets(sourceNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			fatal("Failed to get secret", "secret", name, "namespace", sourceNamespace, "error", err)
+		}
+
+		_, err = clientset.CoreV1().Secrets(targetNamespace).Create(context.TODO(), &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Type: secret.Type,
+			Data: secret.Data,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			fatal("Failed to copy secret", "secret", name, "namespace", targetNamespace, "error", err)
+		}
+		slog.Info("Secret copied", "secret", name, "from_namespace", sourceNamespace, "namespace", targetNamespace)
+	}
+}
+
+// listPlacementNodes returns the schedulable nodes matching nodeSelector,
+// which are the nodes the per-node and per-zone placements spread pods over.
+func listPlacementNodes(clientset *kubernetes.Clientset, nodeSelector map[string]string) []placement.Node {
+	nodeList, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(nodeSelector).String(),
 	})
 	if err != nil {
-		log.Fatalf("Failed to list pods in namespace %s: %v", namespace, err)
+		fatal("Failed to list nodes", "error", err)
 	}
 
-	runningPodCount := 0
-	for _, pod := range pods.Items {
-		if pod.Name != "" && pod.Namespace != "" {
-			runningPodCount++
+	var nodes []placement.Node
+	for _, node := range nodeList.Items {
+		if node.Spec.Unschedulable {
+			continue
 		}
+		nodes = append(nodes, placement.Node{Name: node.Name, Labels: node.Labels})
 	}
 
-	return runningPodCount
+	return nodes
+}
+
+// placePodSpec returns a copy of podSpec with nodeSelector merged into its
+// node selector.
+func placePodSpec(podSpec v1.PodSpec, nodeSelector map[string]string) v1.PodSpec {
+	if len(nodeSelector) == 0 {
+		return podSpec
+	}
+
+	merged := make(map[string]string, len(podSpec.NodeSelector)+len(nodeSelector))
+	for k, v := range podSpec.NodeSelector {
+		merged[k] = v
+	}
+	for k, v := range nodeSelector {
+		merged[k] = v
+	}
+	podSpec.NodeSelector = merged
+
+	return podSpec
 }
 
 func main() {
+	showDashboard := flag.Bool("dashboard", false, "show the progress of the run in a dashboard refreshed in place instead of log lines")
+	junitOut := flag.String("junit-out", "", "write the results of the expectations as JUnit XML to this file when the run completes")
+	reportOut := flag.String("report-out", "", "write a JSON summary of the run to this file when it completes")
+	dryRun := flag.Bool("dry-run", false, "print the planned namespaces, pods and log volume, and exit without touching the cluster")
+	logFormat := flag.String("log-format", logFormatText, "format of the log written to standard error: text or json")
+	verbosity := flag.Int("v", 0, "log verbosity: 1 adds every created pod and retry, 2 also where every pod is placed")
+	quiet := flag.Bool("quiet", false, "log only warnings and errors")
+	flag.Parse()
+
+	level, err := verbosityLevel(*verbosity, *quiet)
+	if err == nil {
+		err = setupLogging(*logFormat, level)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	configFile := "config.yaml"
 
-	configFileData, err := os.Open(configFile)
+	switch flag.Arg(0) {
+	case "":
+	case "validate":
+		os.Exit(validateCommand(configFile))
+	case "generate-stream":
+	case "verify":
+		os.Exit(verifyCommand(configFile, flag.Args()[1:]))
+	case "latency":
+		os.Exit(latencyCommand(configFile, flag.Args()[1:]))
+	default:
+		fatal("Unknown command: must be validate, generate-stream, verify or latency", "command", flag.Arg(0))
+	}
+
+	config := loadConfig(configFile)
+
+	runPlan, err := planRun(config)
 	if err != nil {
-		log.Fatalf("Failed to open config file: %v", err)
+		fatal("Failed to plan the run", "error", err)
+	}
+	accounted := runPlan.Total(sizeAccountings[config.SizeAccounting])
+	if accounted != runPlan.RequestedBytes {
+		slog.Info("Rounding up to whole lines and pods", "size_accounting", config.SizeAccounting, "planned_bytes", accounted, "requested_bytes", runPlan.RequestedBytes)
+	}
+	slog.Info("Planned log volume", "message_bytes", runPlan.TotalBytes, "wire_bytes", runPlan.WireTotalBytes, "max_disk_bytes", runPlan.DiskTotalBytes)
+	if partialLines := plan.CRIPartialLines(int64(config.BytesPerLogLine)); partialLines > 1 {
+		slog.Info("Lines are longer than the CRI limit, the container runtime splits each into partial lines", "bytes_per_log_line", config.BytesPerLogLine, "max_line_bytes", plan.CRIMaxLineBytes, "partial_lines", partialLines)
 	}
-	defer configFileData.Close()
 
-	var config Config
-	decoder := yaml.NewDecoder(configFileData)
-	err = decoder.Decode(&config)
+	totalPods := int(runPlan.Pods)
+
+	totalLogLines := int(runPlan.LinesPerPod)
+
+	// The init container prints the first lines of the pod.
+	mainConfig := config
+	mainConfig.sequenceOffset = config.InitContainerLines
+	mainLines := totalLogLines - config.InitContainerLines
+
+	containerCommand, err := renderContainerCommand(config.ContainerCommand, commandTemplateData{
+		TotalLogLines:   mainLines,
+		BytesPerLogLine: int(config.BytesPerLogLine),
+		Script:          buildScript(mainConfig, mainLines),
+	})
 	if err != nil {
-		log.Fatalf("Failed to parse config file: %v", err)
+		fatal("Failed to render container_command", "error", err)
+	}
+
+	if flag.Arg(0) == "generate-stream" {
+		if err := generateStream(config, totalLogLines, totalPods, os.Stdout); err != nil {
+			fatal("Failed to generate the stream", "error", err)
+		}
+		return
+	}
+
+	if *config.SelfCheck {
+		if _, err := exec.LookPath("sh"); err != nil {
+			slog.Warn("Skipping the self-check, no sh found", "error", err)
+		} else if err := selfCheck(config); err != nil {
+			fatal("Self-check failed", "error", err)
+		}
+	}
+
+	podSpec := buildPodSpec(config, containerCommand)
+	if len(config.LoggerContainers) > 0 {
+		podSpec.Containers, err = buildLoggerContainers(config, mainLines, config.InitContainerLines, podSpec.Containers[0])
+		if err != nil {
+			fatal("Failed to render container_command", "error", err)
+		}
+	}
+	if config.SidecarTailer {
+		addSidecarTailer(&podSpec)
+	}
+	if config.InitContainerLines > 0 {
+		initContainer, err := buildInitContainer(config, podSpec.Containers[0])
+		if err != nil {
+			fatal("Failed to render container_command", "error", err)
+		}
+		podSpec.InitContainers = append(podSpec.InitContainers, initContainer)
+	}
+	if config.podTemplateOverlay != nil {
+		podSpec, err = applyPodSpecOverlay(podSpec, config.podTemplateOverlay)
+		if err != nil {
+			fatal("Failed to apply pod_template_overlay", "error", err)
+		}
+	}
+
+	if *dryRun {
+		printDryRun(os.Stdout, config, runPlan)
+		return
+	}
+
+	runID := time.Now().UTC().Format("20060102-150405")
+
+	var state *stateFile
+	if config.StateFile != "" {
+		state, err = openState(config.StateFile, config, totalLogLines, runID)
+		if err != nil {
+			fatal("Failed to open state_file", "error", err)
+		}
+		runID = state.runID()
+	}
+
+	var truth *groundTruth
+	if config.Anomalies != nil && config.Anomalies.GroundTruthFile != "" {
+		truth, err = openGroundTruth(*config.Anomalies, runID)
+		if err != nil {
+			fatal("Failed to open ground_truth_file", "error", err)
+		}
+	}
+
+	slog.Info("Run started", "run_id", runID, "tags", config.Tags)
+	lc := lifecycle.New(runID)
+	lc.OnTransition(func(e lifecycle.Event) {
+		slog.Info("Run state changed", "run_id", runID, "from", e.From, "to", e.To, "reason", e.Reason)
+	})
+	if config.FormatMigration != nil {
+		slog.Info("Log format switches", "from", config.Format, "to", config.FormatMigration.To, "at", config.formatCutover.UTC().Format(time.RFC3339))
+	}
+	if config.Anomalies != nil {
+		slog.Info("Anomalies injected", "one_in_lines", config.Anomalies.OneInLines, "patterns", len(anomalyPatterns), "ground_truth_file", config.Anomalies.GroundTruthFile)
+	}
+	podLabels := buildPodLabels(config, runID)
+
+	m := newMetrics(runID, config.Tags)
+	if config.MetricsTextfile != "" {
+		go runMetricsTextfile(m, config.MetricsTextfile, time.Duration(config.MetricsTextfileIntervalSeconds)*time.Second)
+	}
+	if config.DebugAddress != "" {
+		go func() {
+			fatal("Failed to serve the debug endpoints", "address", config.DebugAddress, "error", serveDebug(config.DebugAddress, lc))
+		}()
+	}
+	if config.MetricsAddress != "" {
+		go func() {
+			fatal("Failed to serve metrics", "address", config.MetricsAddress, "error", m.serve(config.MetricsAddress))
+		}()
+	}
+
+	clusters := connectClusters(config, totalPods)
+
+	var deadlineExceeded atomic.Bool
+	deadline := time.Now().Add(time.Duration(config.HardDeadlineMinutes) * time.Minute)
+	go runHardDeadline(clusters, config.NumK8sNamespaces, config.NamespacePrefix, config.HardDeadlineCleanup, deadline, lc, &deadlineExceeded)
+
+	errPolicy := newErrorPolicy(config.ErrorPolicy, config.ErrorBudgetPercent, map[string]int{
+		operationNamespaceCreation: config.NumK8sNamespaces * len(clusters),
+		operationPodCreation:       totalPods,
+	})
+
+	bytesPerPod := int64(totalLogLines) * int64(config.BytesPerLogLine+1)
+	timelines := make([]*clusterTimeline, len(clusters))
+	summaries := make([]*clusterSummary, len(clusters))
+	runStart := time.Now()
+	transition(lc, lifecycle.Creating, "creating namespaces and pods")
+
+	for i, c := range clusters {
+		timelines[i] = newClusterTimeline(c.name, config.RunDurationMinutes, bytesPerPod)
+		summaries[i] = newClusterSummary(c.name)
+	}
+
+	var dash *dashboard
+	var restoreLogs func()
+	if *showDashboard {
+		if stdoutIsTerminal() {
+			ring := &logRing{}
+			restoreLogs = logToDashboard(ring)
+			dash = &dashboard{
+				out:         os.Stdout,
+				ring:        ring,
+				lc:          lc,
+				summaries:   summaries,
+				totalPods:   totalPods,
+				bytesPerPod: bytesPerPod,
+				startTime:   runStart,
+				duration:    time.Duration(config.RunDurationMinutes) * time.Minute,
+			}
+			dash.start()
+		} else {
+			slog.Warn("Not showing the dashboard, stdout is not a terminal")
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range clusters {
+
+		wg.Add(1)
+		go func(c cluster, timeline *clusterTimeline, summary *clusterSummary) {
+			defer wg.Done()
+			runCluster(c, config, totalLogLines, podLabels, podSpec, state, truth, errPolicy, m, timeline, summary, lc, &deadlineExceeded)
+		}(c, timelines[i], summaries[i])
+	}
+	wg.Wait()
+
+	if dash != nil {
+		dash.stop()
+		restoreLogs()
+	}
+
+	errPolicy.report()
+	if config.MetricsTextfile != "" {
+		m.writeTextfile(config.MetricsTextfile)
+	}
+	if config.TimelineFile != "" {
+		if err := writeTimeline(config.TimelineFile, runID, config.Tags, bytesPerPod, timelines); err != nil {
+			slog.Error("Failed to write timeline_file", "error", err)
+		}
+	}
+
+	var results []expectationResult
+	if config.Expectations != nil {
+		transition(lc, lifecycle.Verifying, "checking expectations")
+		podsCreated := 0
+		for _, s := range summaries {
+			podsCreated += s.PodsCreated
+		}
+		results = checkExpectations(*config.Expectations, podsCreated, int64(podsCreated)*bytesPerPod, errPolicy.counts())
+	}
+	passed := reportExpectations(results)
+	if passed {
+		transition(lc, lifecycle.Complete, "run finished")
+	} else {
+		transition(lc, lifecycle.Failed, "expectations not met")
+	}
+
+	if *junitOut != "" {
+		if err := writeJUnit(*junitOut, runID, results); err != nil {
+			slog.Error("Failed to write --junit-out", "error", err)
+		}
+	}
+	if *reportOut != "" {
+		summary := runSummary{
+			RunID:       runID,
+			Tags:        config.Tags,
+			StartTime:   runStart,
+			EndTime:     time.Now(),
+			State:       lc.State(),
+			Transitions: lc.History(),
+			Clusters:    summaries,
+			Errors:      errPolicy.counts(),
+		}
+		if err := writeSummary(*reportOut, summary, runPlan); err != nil {
+			slog.Error("Failed to write --report-out", "error", err)
+		}
+	}
+
+	state.complete()
+	truth.close()
+
+	if !passed {
+		os.Exit(exitExpectationsFailed)
+	}
+}
+
+// transition moves lc to state to, logging a transition the lifecycle does
+// not allow instead of aborting the run over it.
+func transition(lc *lifecycle.Run, to lifecycle.State, reason string) {
+	if err := lc.Transition(to, reason); err != nil {
+		slog.Warn("Invalid run state transition", "error", err)
 	}
+}
+
+// runCluster creates the namespaces of the run in cluster c and keeps
+// c.totalPods logger pods running until the run duration elapses.
+func runCluster(c cluster, config Config, totalLogLines int, podLabels map[string]string, podSpec v1.PodSpec, state *stateFile, truth *groundTruth, errPolicy *errorPolicy, m *metrics, timeline *clusterTimeline, summary *clusterSummary, lc *lifecycle.Run, deadlineExceeded *atomic.Bool) {
+	clientset := c.clientset
+	totalPods := c.totalPods
 
-	if config.KubeconfigPath == "" {
-		config.KubeconfigPath = filepath.Join(homedir.HomeDir(), ".kube", "config")
+	progress, resumed := state.cluster(c.name)
+
+	var namespaces []string
+	if resumed {
+		// The namespaces and everything in them were set up by the run
+		// being resumed.
+		namespaces = namespaceNames(config.NumK8sNamespaces, config.NamespacePrefix)
+	} else {
+		if config.CreatePriorityClass {
+			createPriorityClass(clientset, config.PriorityClassName, *config.PriorityClassValue)
+		}
+
+		namespaces = createNamespaces(clientset, config.NumK8sNamespaces, config.NamespacePrefix, buildNamespaceLabels(config), config.NamespaceAnnotations, errPolicy)
+
+		for _, ns := range namespaces {
+			setUpNamespace(clientset, config, ns, podLabels[runIDLabel])
+		}
+
+		progress = clusterState{StartTime: time.Now(), NextPodIndex: 1}
+		state.update(c.name, progress)
+	}
+
+	var podClients map[string]*kubernetes.Clientset
+	if config.TenantImpersonation {
+		var err error
+		podClients, err = tenantClients(c.restConfig, namespaces)
+		if err != nil {
+			fatal("Failed to create the tenant clients", "error", err)
+		}
 	}
 
-	if config.NamespacePrefix == "" {
-		config.NamespacePrefix = "logger-ns"
+	if *config.ServerDryRun && len(namespaces) > 0 {
+		dryRunClient := clientset
+		if client, ok := podClients[namespaces[0]]; ok {
+			dryRunClient = client
+		}
+		what := fmt.Sprintf("dry run of a logger pod in namespace %s", namespaces[0])
+		err := retryCreate(newFailureTracker(config.MaxConsecutiveFailures), what, func() error {
+			return dryRunPod(dryRunClient, namespaces[0], totalLogLines, podLabels, podSpec)
+		})
+		if err != nil {
+			fatal("Server-side dry run of a logger pod failed", "namespace", namespaces[0], "error", err)
+		}
 	}
 
-	totalPods := calculateTotalPods(config.MegabytesTotalLogSize, config.KilobytesPerPodLog)
+	if config.Mode == "cronjob" {
+		installCronJobs(clientset, namespaces, config.CronSchedule, totalPods, totalLogLines, podLabels, podSpec)
+		transition(lc, lifecycle.Draining, "CronJobs installed")
+		return
+	}
 
-	totalLogLines := calculateTotalLogLines(config.BytesPerLogLine, config.KilobytesPerPodLog)
+	startTime := progress.StartTime
+	if len(config.Incidents) > 0 {
+		// The incidents are measured from the start of the run, like the
+		// freeze windows, so a resumed run keeps them.
+		for _, incident := range config.Incidents {
+			start, end := incident.window(startTime)
+			slog.Info("Incident scheduled", "cluster", c.name, "start", start.UTC().Format(time.RFC3339), "end", end.UTC().Format(time.RFC3339), "pods_percent", incident.PodsPercent, "error_percent", incident.ErrorPercent)
+		}
+		podSpec = withRunStart(podSpec, startTime)
+	}
 
-	kubeconfig, err := clientcmd.BuildConfigFromFlags("", config.KubeconfigPath)
+	stop := make(chan struct{})
+	defer close(stop)
+	tracker, err := startPodTracker(clientset, podLabels[runIDLabel], func(pod *v1.Pod, reason string) {
+		slog.Warn("Pod disrupted", "cluster", c.name, "namespace", pod.Namespace, "pod", pod.Name, "node", pod.Spec.NodeName, "reason", reason)
+		m.podDisrupted(c.name, reason)
+		summary.podDisrupted(reason)
+	}, stop)
 	if err != nil {
-		log.Fatalf("Error building kubeconfig from %s: %v", config.KubeconfigPath, err)
+		fatal("Failed to watch pods", "error", err)
 	}
 
-	clientset, err := kubernetes.NewForConfig(kubeconfig)
+	run := &clusterRun{
+		cluster:          c,
+		config:           config,
+		totalLogLines:    totalLogLines,
+		podLabels:        podLabels,
+		podSpec:          podSpec,
+		namespaces:       namespaces,
+		nodes:            listPlacementNodes(clientset, config.NodeSelector),
+		state:            state,
+		truth:            truth,
+		errPolicy:        errPolicy,
+		m:                m,
+		deadlineExceeded: deadlineExceeded,
+		startTime:        startTime,
+		tracker:          tracker,
+		failures:         newFailureTracker(config.MaxConsecutiveFailures),
+		timeline:         timeline,
+		summary:          summary,
+		lc:               lc,
+		reader:           newLogReader(clientset, c.name, config.LogReadBackPercent, m),
+		podClients:       podClients,
+	}
+	if config.OOMKill != nil {
+		run.oomKillPodSpec = buildOOMKillPodSpec(podSpec, *config.OOMKill, totalLogLines)
+	}
+	run.podIndex.Store(int64(progress.NextPodIndex))
+	summary.track(tracker, namespaces)
+
+	run.budget, err = newLoadBudget(clientset, config.LoadCap, podLabels[runIDLabel], totalPods)
 	if err != nil {
-		log.Fatalf("Error creating Kubernetes client: %v", err)
+		fatal("Failed to claim pods of the load cap", "error", err)
+	}
+	run.budget.start(func() int { return tracker.runningPods(namespaces) }, run.podIndex.Load)
+	defer run.budget.stop()
+
+	if config.ClosedLoop != nil {
+		var token string
+		if config.ClosedLoop.TokenFrom != "" {
+			if token, err = readCredential(config.ClosedLoop.TokenFrom, clientset); err != nil {
+				fatal("Failed to read the closed loop token", "error", err)
+			}
+		}
+		run.loop = newLoadController(config.ClosedLoop, token, totalPods, int64(totalLogLines)*int64(config.BytesPerLogLine+1), summary.createdPods)
+		run.loop.start()
+	}
+
+	go runFreezeWindows(clientset, namespaces, c.churned, config.FreezeWindows, startTime, &run.frozen)
+	go watchStopConditions(clientset, config.StopConditions, &run.halted, summary.halt, stop)
+
+	churner := startNamespaceChurn(run, clientset, config.NamespaceChurn)
+	go runPodChurn(clientset, tracker, namespaces, config.ChurnRate, summary.podChurned, stop)
+
+	groups := buildNamespaceGroups(config, namespaces, totalPods, startTime)
+	timeline.plan(groups, startTime)
+
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group namespaceGroup) {
+			defer wg.Done()
+			run.runGroup(group)
+		}(group)
+	}
+	wg.Wait()
+	churner.stop()
+	transition(lc, lifecycle.Draining, "run duration elapsed")
+
+	if run.loop != nil {
+		pods, bytesPerSecond, saturated := run.loop.stop()
+		slog.Info("Maximum sustainable load", "cluster", c.name, "running_pods", pods, "bytes_per_second", int64(bytesPerSecond), "saturated", saturated)
+		summary.setMaxSustainableLoad(sustainableLoad{RunningPods: pods, BytesPerSecond: bytesPerSecond, Saturated: saturated})
 	}
 
-	namespaces := createNamespaces(clientset, config.NumK8sNamespaces, config.NamespacePrefix)
+	tags := config.Tags
+	if c.name != "" {
+		tags = make(map[string]string, len(config.Tags)+1)
+		for k, v := range config.Tags {
+			tags[k] = v
+		}
+		tags["cluster"] = c.name
+	}
+
+	run.reader.stop(tags)
+	reportPerNodeLoad(clientset, namespaces, int64(totalLogLines)*int64(config.BytesPerLogLine+1), tags)
+}
+
+// clusterRun is the state shared by the namespace groups of a cluster.
+type clusterRun struct {
+	cluster          cluster
+	config           Config
+	totalLogLines    int
+	podLabels        map[string]string
+	podSpec          v1.PodSpec
+	namespaces       []string
+	nodes            []placement.Node
+	state            *stateFile
+	truth            *groundTruth
+	errPolicy        *errorPolicy
+	m                *metrics
+	deadlineExceeded *atomic.Bool
+	startTime        time.Time
+	tracker          *podTracker
+	failures         *failureTracker
+	timeline         *clusterTimeline
+	summary          *clusterSummary
+	lc               *lifecycle.Run
+	reader           *logReader
+	budget           *loadBudget
+	loop             *loadController
+	frozen           atomic.Bool
+	halted           atomic.Bool
+
+	// oomKillPodSpec is the spec of the pods of oom_kill.
+	oomKillPodSpec v1.PodSpec
+
+	// podClients creates the pods of every namespace as its tenant with
+	// tenant_impersonation.
+	podClients map[string]*kubernetes.Clientset
+
+	// inFlight is the number of pods of all groups handed to a worker and
+	// not created yet.
+	inFlight atomic.Int64
+
+	// podIndex is the index of the next pod, shared by the groups so that
+	// pod names stay unique across the cluster.
+	podIndex atomic.Int64
+}
+
+// podClient returns the client creating the pods of namespace: the client of
+// its tenant with tenant_impersonation, the client of the cluster otherwise.
+func (r *clusterRun) podClient(namespace string) *kubernetes.Clientset {
+	if client, ok := r.podClients[namespace]; ok {
+		return client
+	}
+
+	return r.cluster.clientset
+}
+
+// runGroup keeps group.totalPods logger pods running in the namespaces of
+// group between its start and stop times.
+func (r *clusterRun) runGroup(group namespaceGroup) {
+	config := r.config
+	totalPods := group.totalPods
+
+	logger := slog.Default()
+	if group.name != "" {
+		logger = logger.With("group", group.name)
+	}
 
 	source := rand.NewSource(time.Now().UnixNano())
 	rnd := rand.New(source)
-	stopTime := time.Now().Add(time.Duration(config.RunDurationMinutes) * time.Minute)
-	podIndex := 1
 
+	strategy, err := placement.New(config.Placement, placement.Cluster{
+		Namespaces:   group.namespaces,
+		Weights:      group.weights,
+		ZipfExponent: *config.ZipfExponent,
+		Nodes:        r.nodes,
+		Seed:         rnd.Int63(),
+	})
+	if err != nil {
+		fatal("Failed to set up placement", "group", group.name, "error", err)
+	}
+
+	if wait := time.Until(group.startTime); wait > 0 {
+		logger.Info("Waiting to start", "at", group.startTime.Format(time.RFC3339))
+		time.Sleep(wait)
+	}
+
+	targetReachedInterval := 5 * time.Second
+	if config.Profile == profileEphemeralBurst {
+		targetReachedInterval = 1 * time.Second
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), group.stopTime)
+	defer cancel()
+
+	// Workers live for the whole group and pick up pods as soon as they are
+	// free, so a slow creation does not hold back the others.
+	var pending atomic.Int64
+	jobs := make(chan struct{})
 	var wg sync.WaitGroup
-	jobQueue := make(chan int, config.ConcurrentRequests)
+	for i := 0; i < config.ConcurrentRequests; i++ {
+		wg.Add(1)
+		go func(rnd *rand.Rand) {
+			defer wg.Done()
+			for range jobs {
+				r.createLoggerPod(ctx, rnd, strategy)
+				pending.Add(-1)
+				r.inFlight.Add(-1)
+			}
+		}(rand.New(rand.NewSource(rnd.Int63())))
+	}
 
-	for time.Now().Before(stopTime) {
-		totalRunningPods := 0
-		for _, ns := range namespaces {
-			totalRunningPods += getRunningPodCount(clientset, ns)
+	// The hold reasons are logged once when the run starts holding, and
+	// at every check with -v.
+	atTarget, atLoadCap, atLoopLimit, atHalt := false, false, false, false
+	lastSave := time.Now()
+	for ctx.Err() == nil {
+		if r.deadlineExceeded.Load() {
+			cancel()
+			break
+		}
+
+		if time.Since(lastSave) >= stateSaveInterval {
+			r.saveProgress()
+			lastSave = time.Now()
+		}
+
+		if r.frozen.Load() {
+			sleepContext(ctx, 1*time.Second)
+			continue
 		}
 
-		if totalRunningPods+config.ConcurrentRequests >= totalPods {
-			time.Sleep(5 * time.Second)
-			log.Printf("Total running pods reached the target: %d", totalPods)
+		if r.halted.Load() {
+			holdLog(logger, !atHalt, "Pod creation halted by a stop condition")
+			atHalt = true
+			sleepContext(ctx, targetReachedInterval)
 			continue
 		}
 
-		for i := 0; i < config.ConcurrentRequests; i++ {
-			jobQueue <- podIndex
-			podIndex++
+		clusterRunningPods, succeeded, failed := r.tracker.podPhases(r.namespaces)
+		r.m.runningPods.WithLabelValues(r.cluster.name).Set(float64(clusterRunningPods))
+		r.m.completedPods.WithLabelValues(r.cluster.name, string(v1.PodSucceeded)).Set(float64(succeeded))
+		r.m.completedPods.WithLabelValues(r.cluster.name, string(v1.PodFailed)).Set(float64(failed))
+		r.timeline.runningPods(time.Now(), clusterRunningPods)
+
+		// Pods handed to a worker are not in the cache yet.
+		totalRunningPods := r.tracker.runningPods(group.namespaces) + int(pending.Load())
+		if totalRunningPods >= totalPods {
+			holdLog(logger, !atTarget, "Total running pods reached the target", "pods", totalPods)
+			atTarget = true
+			transition(r.lc, lifecycle.Steady, "running pods reached the target")
+			sleepContext(ctx, targetReachedInterval)
+			continue
 		}
 
-		for i := 0; i < config.ConcurrentRequests; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
+		atTarget = false
+
+		if allowed := r.budget.allowed(); clusterRunningPods+int(r.inFlight.Load()) >= allowed {
+			holdLog(logger, !atLoadCap, "Running pods held at the pods claimed of the load cap", "pods", allowed)
+			atLoadCap = true
+			sleepContext(ctx, targetReachedInterval)
+			continue
+		}
+		atLoadCap = false
+
+		if allowed := r.loop.allowed(); clusterRunningPods+int(r.inFlight.Load()) >= allowed {
+			holdLog(logger, !atLoopLimit, "Running pods held at the limit of the closed loop", "pods", allowed)
+			atLoopLimit = true
+			sleepContext(ctx, targetReachedInterval)
+			continue
+		}
+		atLoopLimit = false
+
+		pending.Add(1)
+		r.inFlight.Add(1)
+		select {
+		case jobs <- struct{}{}:
+		case <-ctx.Done():
+			pending.Add(-1)
+			r.inFlight.Add(-1)
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	r.saveProgress()
+}
+
+// holdLog logs why pod creation holds: at the info level when it starts
+// holding, at the debug level at every further check.
+func holdLog(logger *slog.Logger, started bool, msg string, args ...any) {
+	level := slog.LevelDebug
+	if started {
+		level = slog.LevelInfo
+	}
+	logger.Log(context.Background(), level, msg, args...)
+}
 
-				sleepTime := rnd.Intn(3) + 1
-				time.Sleep(time.Duration(sleepTime) * time.Second)
+// createLoggerPod creates the next pod where strategy places it, unless ctx
+// is done first.
+func (r *clusterRun) createLoggerPod(ctx context.Context, rnd *rand.Rand, strategy placement.Strategy) {
+	// Ephemeral pods are created back to back to maximize churn.
+	if r.config.Profile != profileEphemeralBurst {
+		sleepTime := rnd.Intn(3) + 1
+		if !sleepContext(ctx, time.Duration(sleepTime)*time.Second) {
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
 
-				podNumber := <-jobQueue
-				randomNamespace := namespaces[rnd.Intn(len(namespaces))]
-				podName := fmt.Sprintf("logger-pod-%d", podNumber)
-				createPod(clientset, randomNamespace, podName, totalLogLines, config.BytesPerLogLine)
-				log.Printf("Pod %s in namespace %s created", podName, randomNamespace)
-			}()
+	// The index is taken only once the pod is about to be created, so a
+	// job dropped at the end of the group leaves no gap. A creation that
+	// fails keeps its index: the pod may exist despite the error, and a
+	// later pod must not reuse its name.
+	podNumber := int(r.podIndex.Add(1) - 1)
+	target := strategy.Place(podNumber)
+	podName := fmt.Sprintf("logger-pod-%d", podNumber)
+	slog.Log(ctx, levelTrace, "Pod placed", "namespace", target.Namespace, "pod", podName, "node_selector", target.NodeSelector)
+	what := fmt.Sprintf("Pod %s in namespace %s", podName, target.Namespace)
+	podSpec := r.podSpec
+	if r.config.OOMKill.oomKilled(podNumber) {
+		podSpec = r.oomKillPodSpec
+		slog.Debug("Pod will be OOMKilled", "namespace", target.Namespace, "pod", podName)
+	}
+	for i, incident := range r.config.Incidents {
+		if incident.affected(podNumber) {
+			slog.Debug("Pod will take part in incident", "namespace", target.Namespace, "pod", podName, "incident", i)
 		}
+	}
+	if skew := r.config.TimestampPrefix.clockSkewSeconds(podNumber); skew != 0 {
+		slog.Debug("Pod clock will be skewed", "namespace", target.Namespace, "pod", podName, "skew_seconds", skew)
+	}
+	err := retryCreate(r.failures, what, func() error {
+		start := time.Now()
+		err := createPod(r.podClient(target.Namespace), target.Namespace, podName, r.totalLogLines, r.podLabels, placePodSpec(podSpec, target.NodeSelector))
+		r.m.podCreationDuration.WithLabelValues(r.cluster.name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			r.m.podCreationFailed(r.cluster.name, err)
+		}
+		return err
+	})
+	if err != nil {
+		r.errPolicy.fail(operationPodCreation, what, err)
+		return
+	}
+	r.m.podCreated(r.cluster.name, r.totalLogLines, int(r.config.BytesPerLogLine))
+	r.timeline.podCreated(time.Now())
+	r.summary.podCreated(target.Namespace)
+	slog.Debug("Pod created", "namespace", target.Namespace, "pod", podName)
+	r.truth.record(r.cluster.name, target.Namespace, podNumber, r.totalLogLines)
+
+	if r.reader.sampled(podNumber) {
+		r.reader.follow(target.Namespace, podName)
+	}
+}
+
+func (r *clusterRun) saveProgress() {
+	r.state.update(r.cluster.name, clusterState{StartTime: r.startTime, NextPodIndex: int(r.podIndex.Load())})
+}
+
+// sleepContext sleeps for d and reports whether it did so before ctx was
+// done.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-		wg.Wait()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "k8s_pod_log_generator"
+
+const defaultMetricsTextfileIntervalSeconds = 15
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// metrics accounts for the pods created and the log volume they are expected
+// to print, per cluster.
+type metrics struct {
+	registry *prometheus.Registry
+
+	podsCreated         *prometheus.CounterVec
+	podCreationFailures *prometheus.CounterVec
+	logLines            *prometheus.CounterVec
+	logBytes            *prometheus.CounterVec
+	runningPods         *prometheus.GaugeVec
+	completedPods       *prometheus.GaugeVec
+	apiErrors           *prometheus.CounterVec
+	podCreationDuration *prometheus.HistogramVec
+	podDisruptions      *prometheus.CounterVec
+
+	logReadBackStreams  *prometheus.GaugeVec
+	logReadBackFailures *prometheus.CounterVec
+	logReadBackLines    *prometheus.CounterVec
+	logReadBackBytes    *prometheus.CounterVec
+}
+
+// newMetrics registers the metrics of the run. The run ID and the tags are
+// exposed as labels of the info metric, each tag as tag_<key>.
+func newMetrics(runID string, tags map[string]string) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		podsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "pods_created_total",
+			Help:      "Logger pods created.",
+		}, []string{"cluster"}),
+		podCreationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "pod_creation_failures_total",
+			Help:      "Failed attempts to create a logger pod, including attempts that were retried.",
+		}, []string{"cluster"}),
+		logLines: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "log_lines_total",
+			Help:      "Log lines the created logger pods print.",
+		}, []string{"cluster"}),
+		logBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "log_bytes_total",
+			Help:      "Log bytes, including newlines, the created logger pods print.",
+		}, []string{"cluster"}),
+		runningPods: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "running_pods",
+			Help:      "Logger pods that have not completed yet.",
+		}, []string{"cluster"}),
+		completedPods: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "completed_pods",
+			Help:      "Logger pods that have completed, by phase (Succeeded or Failed).",
+		}, []string{"cluster", "phase"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_errors_total",
+			Help:      "Failed requests to the API server, by operation and error class.",
+		}, []string{"cluster", "operation", "class"}),
+		podCreationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "pod_creation_duration_seconds",
+			Help:      "Latency of pod creation requests, including failed ones.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+		}, []string{"cluster"}),
+		podDisruptions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "pod_disruptions_total",
+			Help:      "Logger pods evicted, preempted or otherwise disrupted, by reason.",
+		}, []string{"cluster", "reason"}),
+		logReadBackStreams: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "log_read_back_streams",
+			Help:      "Log streams of logger pods open through the API server.",
+		}, []string{"cluster"}),
+		logReadBackFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "log_read_back_failures_total",
+			Help:      "Log streams of logger pods that could not be opened or broke off.",
+		}, []string{"cluster"}),
+		logReadBackLines: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "log_read_back_lines_total",
+			Help:      "Log lines read back through the API server.",
+		}, []string{"cluster"}),
+		logReadBackBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "log_read_back_bytes_total",
+			Help:      "Log bytes, including newlines, read back through the API server.",
+		}, []string{"cluster"}),
+	}
+
+	infoLabels := prometheus.Labels{"run_id": runID}
+	for key, value := range tags {
+		infoLabels["tag_"+invalidLabelChars.ReplaceAllString(key, "_")] = value
+	}
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   metricsNamespace,
+		Name:        "info",
+		Help:        "Run ID and tags of the run.",
+		ConstLabels: infoLabels,
+	})
+	info.Set(1)
+
+	m.registry.MustRegister(info, m.podsCreated, m.podCreationFailures, m.logLines, m.logBytes, m.runningPods,
+		m.completedPods, m.apiErrors, m.podCreationDuration, m.podDisruptions,
+		m.logReadBackStreams, m.logReadBackFailures, m.logReadBackLines, m.logReadBackBytes)
+
+	return m
+}
+
+// podCreated accounts for a pod printing lines lines of bytesPerLine bytes.
+func (m *metrics) podCreated(cluster string, lines, bytesPerLine int) {
+	m.podsCreated.WithLabelValues(cluster).Inc()
+	m.logLines.WithLabelValues(cluster).Add(float64(lines))
+	m.logBytes.WithLabelValues(cluster).Add(float64(lines) * float64(bytesPerLine+1))
+}
+
+func (m *metrics) podDisrupted(cluster, reason string) {
+	m.podDisruptions.WithLabelValues(cluster, reason).Inc()
+}
+
+func (m *metrics) podCreationFailed(cluster string, err error) {
+	m.podCreationFailures.WithLabelValues(cluster).Inc()
+	m.apiError(cluster, operationPodCreation, err)
+}
+
+// apiError accounts for a failed request of operation, by the class of err.
+func (m *metrics) apiError(cluster, operation string, err error) {
+	m.apiErrors.WithLabelValues(cluster, operation, classifyError(err)).Inc()
+}
+
+// serve exposes the metrics on address at /metrics. It returns only if the
+// server fails.
+func (m *metrics) serve(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	return http.ListenAndServe(address, mux)
+}
+
+func (m *metrics) logReadBack(cluster string, lines, bytes int) {
+	m.logReadBackLines.WithLabelValues(cluster).Add(float64(lines))
+	m.logReadBackBytes.WithLabelValues(cluster).Add(float64(bytes))
+}
+
+func (m *metrics) logReadBackFailed(cluster string) {
+	m.logReadBackFailures.WithLabelValues(cluster).Inc()
+}
+
+// writeTextfile writes the metrics to path in the format of the node
+// exporter textfile collector. The file is replaced atomically, so the
+// collector never reads a partial file.
+func (m *metrics) writeTextfile(path string) {
+	if err := prometheus.WriteToTextfile(path, m.registry); err != nil {
+		slog.Error("Failed to write metrics", "path", path, "error", err)
+	}
+}
+
+// runMetricsTextfile rewrites path every interval.
+func runMetricsTextfile(m *metrics, path string, interval time.Duration) {
+	for range time.Tick(interval) {
+		m.writeTextfile(path)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	defaultOOMKillMemoryLimit = "16Mi"
+	defaultOOMKillAtPercent   = 50
+
+	// oomKillAtLineEnv holds the line after which the steady script of a
+	// pod of the OOMKill scenario allocates memory until it is killed. The
+	// script of the other pods never sees it.
+	oomKillAtLineEnv = "LOGGER_OOM_KILL_AT_LINE"
+)
+
+// OOMKill makes a share of the logger pods allocate memory past a small
+// limit part way through their payload, so the kernel kills them and their
+// logs end abruptly.
+type OOMKill struct {
+	PodsPercent int    `yaml:"pods_percent"`
+	MemoryLimit string `yaml:"memory_limit"`
+	AtPercent   int    `yaml:"at_percent"`
+}
+
+// oomKillCheck returns the command ending every line of the steady script
+// when OOMKill is set: past the line of oomKillAtLineEnv, tail buffers
+// /dev/zero, which has no newline, until the container is OOMKilled.
+func oomKillCheck(config Config) string {
+	if config.OOMKill == nil {
+		return ""
+	}
+
+	return fmt.Sprintf(`; [ "$i" != "${%s:-0}" ] || tail /dev/zero`, oomKillAtLineEnv)
+}
+
+// oomKilled reports whether the pod numbered podNumber is one of the
+// PodsPercent percent of the pods OOMKilled, spread evenly over the run.
+func (o *OOMKill) oomKilled(podNumber int) bool {
+	if o == nil {
+		return false
+	}
+
+	return (podNumber+1)*o.PodsPercent/100 > podNumber*o.PodsPercent/100
+}
+
+// buildOOMKillPodSpec returns podSpec with the memory limit of the OOMKill
+// scenario and the line its pods are killed after.
+func buildOOMKillPodSpec(podSpec v1.PodSpec, oomKill OOMKill, totalLogLines int) v1.PodSpec {
+	spec := *podSpec.DeepCopy()
+	limit := resource.MustParse(oomKill.MemoryLimit)
+	atLine := max(1, totalLogLines*oomKill.AtPercent/100)
+
+	container := &spec.Containers[0]
+	if container.Resources.Limits == nil {
+		container.Resources.Limits = v1.ResourceList{}
+	}
+	container.Resources.Limits[v1.ResourceMemory] = limit
+	if request, ok := container.Resources.Requests[v1.ResourceMemory]; ok && request.Cmp(limit) > 0 {
+		container.Resources.Requests[v1.ResourceMemory] = limit
+	}
+	container.Env = append(container.Env, v1.EnvVar{Name: oomKillAtLineEnv, Value: strconv.Itoa(atLine)})
+
+	return spec
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// decodePodSpecOverlay converts the pod_template_overlay section into a JSON
+// strategic merge patch, rejecting fields that do not exist in a pod spec.
+func decodePodSpecOverlay(raw interface{}) ([]byte, error) {
+	if err := decodeKubeObject(raw, &v1.PodSpec{}); err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return sigsyaml.YAMLToJSON(data)
+}
+
+// applyPodSpecOverlay strategically merges overlay onto podSpec, the same way
+// kubectl patch does: lists like containers, volumes and env are merged by
+// name, so the logger container can be amended by naming it
+// logger-container, and entries with new names are appended.
+func applyPodSpecOverlay(podSpec v1.PodSpec, overlay []byte) (v1.PodSpec, error) {
+	original, err := json.Marshal(podSpec)
+	if err != nil {
+		return v1.PodSpec{}, err
+	}
+
+	merged, err := strategicpatch.StrategicMergePatch(original, overlay, v1.PodSpec{})
+	if err != nil {
+		return v1.PodSpec{}, err
+	}
+
+	var result v1.PodSpec
+	if err := json.Unmarshal(merged, &result); err != nil {
+		return v1.PodSpec{}, err
+	}
+
+	return result, nil
+}
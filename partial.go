@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const defaultPartialLineDelayMilliseconds = 1000
+
+// PartialLines makes a share of the lines stop before their newline for a
+// while, as a buffered writer flushing part of a line would, so collectors
+// have to hold a partial line until it ends or their flush timeout fires.
+type PartialLines struct {
+	Percent           int `yaml:"percent"`
+	DelayMilliseconds int `yaml:"delay_milliseconds"`
+}
+
+// partialLineCommand returns emit, the command printing a line, printing
+// Percent percent of the lines spread evenly over the lines of the pod
+// without their newline, which follows after the delay. The line is held
+// with $hold rather than captured, so emit keeps its counters.
+func (p *PartialLines) partialLineCommand(emit string) string {
+	delay := strconv.FormatFloat(float64(p.DelayMilliseconds)/1000, 'f', -1, 64)
+
+	return fmt.Sprintf(`partials=$((partials + 1)); if %[1]s; then hold=1; %[2]s; hold=; sleep %[3]s; echo; else %[2]s; fi`, spreadCondition("partials", p.Percent), emit, delay)
+}
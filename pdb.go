@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podDisruptionBudgetName is the name of the PodDisruptionBudget of a run,
+// so that the budgets of several runs sharing namespaces do not collide.
+func podDisruptionBudgetName(runID string) string {
+	return "k8s-pod-log-generator-" + runID
+}
+
+// createPodDisruptionBudget creates a PodDisruptionBudget in namespace that
+// forbids the eviction of any logger pod of runID, so that draining a node
+// waits for them to complete instead of changing the load of the run.
+func createPodDisruptionBudget(clientset *kubernetes.Clientset, namespace, runID string) {
+	maxUnavailable := intstr.FromInt(0)
+	name := podDisruptionBudgetName(runID)
+
+	_, err := clientset.PolicyV1().PodDisruptionBudgets(namespace).Create(context.TODO(), &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{runIDLabel: runID},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{runIDLabel: runID},
+			},
+		},
+	}, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		slog.Info("PodDisruptionBudget already exists", "namespace", namespace, "pod_disruption_budget", name)
+		return
+	}
+	if err != nil {
+		fatal("Failed to create PodDisruptionBudget", "namespace", namespace, "pod_disruption_budget", name, "error", err)
+	}
+	slog.Info("PodDisruptionBudget created", "namespace", namespace, "pod_disruption_budget", name)
+}
+
+// disruptionReason returns why pod was disrupted, such as
+// EvictionByEvictionAPI or PreemptionByScheduler, and false if it was not.
+// Pods evicted by the kubelet under node pressure are reported as Evicted
+// on clusters that do not set the DisruptionTarget condition.
+func disruptionReason(pod *v1.Pod) (string, bool) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.DisruptionTarget && condition.Status == v1.ConditionTrue {
+			return condition.Reason, true
+		}
+	}
+	if pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "Evicted" {
+		return "Evicted", true
+	}
+
+	return "", false
+}
@@ -0,0 +1,122 @@
+// Package bulk creates many pods concurrently and reports the outcome of each
+// creation, leaving pacing decisions to the caller.
+package bulk
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Status is the outcome of a single pod creation.
+type Status string
+
+const (
+	StatusCreated Status = "created"
+	StatusFailed  Status = "failed"
+)
+
+// Result describes the outcome of creating the pod at Index in the slice
+// passed to Create.
+type Result struct {
+	Index     int
+	Namespace string
+	Name      string
+	Status    Status
+	Err       error
+}
+
+// Options controls how Create issues requests.
+type Options struct {
+	// Concurrency is the maximum number of in-flight create requests.
+	// Values below 1 are treated as 1.
+	Concurrency int
+}
+
+// Create submits pods asynchronously and returns a channel that receives one
+// Result per pod in completion order. The channel is closed once every pod
+// has been reported. Pods that have not been submitted when ctx is cancelled
+// are reported as failed with the context error.
+func Create(ctx context.Context, clientset kubernetes.Interface, pods []*v1.Pod, opts Options) <-chan Result {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make(chan Result, len(pods))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results <- createOne(ctx, clientset, index, pods[index])
+			}
+		}()
+	}
+
+	go func() {
+		for i := range pods {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+func createOne(ctx context.Context, clientset kubernetes.Interface, index int, pod *v1.Pod) Result {
+	result := Result{
+		Index:     index,
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Status:    StatusCreated,
+	}
+
+	err := ctx.Err()
+	if err == nil {
+		_, err = clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Err = err
+	}
+
+	return result
+}
+
+// Summary aggregates the results of a Create call.
+type Summary struct {
+	// Results holds every result ordered by submission index.
+	Results []Result
+	Created int
+	Failed  int
+}
+
+// Collect drains results and returns them ordered by submission index.
+func Collect(results <-chan Result) Summary {
+	var summary Summary
+
+	for result := range results {
+		summary.Results = append(summary.Results, result)
+		if result.Status == StatusCreated {
+			summary.Created++
+		} else {
+			summary.Failed++
+		}
+	}
+
+	sort.Slice(summary.Results, func(i, j int) bool {
+		return summary.Results[i].Index < summary.Results[j].Index
+	})
+
+	return summary
+}
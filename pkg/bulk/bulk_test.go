@@ -0,0 +1,133 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testPods(names ...string) []*v1.Pod {
+	pods := make([]*v1.Pod, len(names))
+	for i, name := range names {
+		pods[i] = &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "logger-ns-1", Name: name}}
+	}
+
+	return pods
+}
+
+// onCreate returns a clientset calling reactor on every pod creation, which
+// fails the creation if it returns an error.
+func onCreate(reactor func(pod *v1.Pod) error) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*v1.Pod)
+		if err := reactor(pod); err != nil {
+			return true, nil, err
+		}
+		return false, nil, nil
+	})
+
+	return clientset
+}
+
+func TestCollectOrdersResults(t *testing.T) {
+	var names []string
+	for i := 0; i < 50; i++ {
+		names = append(names, fmt.Sprintf("logger-pod-%d", i+1))
+	}
+	clientset := onCreate(func(*v1.Pod) error {
+		// Random delays make the creations complete out of order.
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		return nil
+	})
+
+	summary := Collect(Create(context.Background(), clientset, testPods(names...), Options{Concurrency: 8}))
+
+	if summary.Created != len(names) || summary.Failed != 0 {
+		t.Fatalf("Created = %d, Failed = %d, want %d and 0", summary.Created, summary.Failed, len(names))
+	}
+	for i, result := range summary.Results {
+		if result.Index != i || result.Name != names[i] || result.Namespace != "logger-ns-1" {
+			t.Errorf("Results[%d] = %+v, want index %d and pod %s", i, result, i, names[i])
+		}
+	}
+	pods, err := clientset.CoreV1().Pods("logger-ns-1").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != len(names) {
+		t.Errorf("%d pods created, want %d", len(pods.Items), len(names))
+	}
+}
+
+func TestCreateCollectsErrorsPerPod(t *testing.T) {
+	errQuota := errors.New("exceeded quota")
+	clientset := onCreate(func(pod *v1.Pod) error {
+		if strings.HasPrefix(pod.Name, "failing-") {
+			return fmt.Errorf("%s: %w", pod.Name, errQuota)
+		}
+		return nil
+	})
+
+	summary := Collect(Create(context.Background(), clientset, testPods("logger-pod-1", "failing-1", "logger-pod-2", "failing-2"), Options{Concurrency: 2}))
+
+	if summary.Created != 2 || summary.Failed != 2 {
+		t.Fatalf("Created = %d, Failed = %d, want 2 and 2", summary.Created, summary.Failed)
+	}
+	for _, result := range summary.Results {
+		failing := strings.HasPrefix(result.Name, "failing-")
+		switch {
+		case failing && (result.Status != StatusFailed || !errors.Is(result.Err, errQuota) || !strings.Contains(result.Err.Error(), result.Name)):
+			t.Errorf("result of %s = %+v, want its own quota error", result.Name, result)
+		case !failing && (result.Status != StatusCreated || result.Err != nil):
+			t.Errorf("result of %s = %+v, want created", result.Name, result)
+		}
+	}
+}
+
+func TestCreateStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var creates atomic.Int64
+	clientset := onCreate(func(*v1.Pod) error {
+		// The run is cancelled while the first pod is being created.
+		if creates.Add(1) == 1 {
+			cancel()
+		}
+		return nil
+	})
+
+	summary := Collect(Create(ctx, clientset, testPods("logger-pod-1", "logger-pod-2", "logger-pod-3", "logger-pod-4"), Options{Concurrency: 1}))
+
+	if got := creates.Load(); got != 1 {
+		t.Errorf("%d create requests sent, want 1", got)
+	}
+	if summary.Created != 1 || summary.Failed != 3 {
+		t.Fatalf("Created = %d, Failed = %d, want 1 and 3", summary.Created, summary.Failed)
+	}
+	for _, result := range summary.Results[1:] {
+		if result.Status != StatusFailed || !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("result of %s = %+v, want failed with %v", result.Name, result, context.Canceled)
+		}
+	}
+}
+
+func TestCreateConcurrencyAtLeastOne(t *testing.T) {
+	summary := Collect(Create(context.Background(), fake.NewSimpleClientset(), testPods("logger-pod-1", "logger-pod-2"), Options{}))
+
+	if summary.Created != 2 {
+		t.Errorf("Created = %d with no concurrency set, want 2", summary.Created)
+	}
+}
@@ -0,0 +1,149 @@
+// Package lifecycle models a run of the generator as explicit states with
+// checked transitions, so an embedding program can query where a run is and
+// react to every change instead of inferring it from log lines.
+package lifecycle
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// State is a stage of a run.
+type State string
+
+const (
+	// Planned: the volume is sized and nothing has been created yet.
+	Planned State = "Planned"
+	// Creating: namespaces are set up and pods are created towards the
+	// target.
+	Creating State = "Creating"
+	// Steady: the target number of running pods has been reached and
+	// completed pods are replaced.
+	Steady State = "Steady"
+	// Draining: no more pods are created and the run is winding down.
+	Draining State = "Draining"
+	// Verifying: the outcome of the run is checked.
+	Verifying State = "Verifying"
+	// Complete: the run finished.
+	Complete State = "Complete"
+	// Failed: the run was aborted.
+	Failed State = "Failed"
+)
+
+// transitions lists the states each state can move to. Every state but the
+// final ones can fail.
+var transitions = map[State][]State{
+	Planned:   {Creating, Failed},
+	Creating:  {Steady, Draining, Failed},
+	Steady:    {Draining, Failed},
+	Draining:  {Verifying, Complete, Failed},
+	Verifying: {Complete, Failed},
+}
+
+// Final reports whether no transition leaves s.
+func (s State) Final() bool {
+	return len(transitions[s]) == 0
+}
+
+// Event is a transition of a run.
+type Event struct {
+	From   State     `json:"from"`
+	To     State     `json:"to"`
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+}
+
+// Run is the lifecycle of a run. It is safe for concurrent use.
+type Run struct {
+	id string
+
+	mu        sync.Mutex
+	state     State
+	history   []Event
+	listeners []func(Event)
+}
+
+// New returns a run in the Planned state.
+func New(id string) *Run {
+	return &Run{id: id, state: Planned}
+}
+
+// ID returns the ID of the run.
+func (r *Run) ID() string {
+	return r.id
+}
+
+// State returns the current state of the run.
+func (r *Run) State() State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state
+}
+
+// History returns the transitions of the run so far, oldest first.
+func (r *Run) History() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.history)
+}
+
+// Since returns the time the run entered its current state, or the zero time
+// while it is Planned.
+func (r *Run) Since() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.history) == 0 {
+		return time.Time{}
+	}
+	return r.history[len(r.history)-1].Time
+}
+
+// OnTransition calls f with every later transition, in order. f is called
+// with no lock held but must not block.
+func (r *Run) OnTransition(f func(Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, f)
+}
+
+// Transition moves the run to state to for reason. Moving to the current
+// state does nothing, so concurrent parts of a run can report the same
+// progress. It returns an error if the transition is not allowed.
+func (r *Run) Transition(to State, reason string) error {
+	r.mu.Lock()
+	if r.state == to {
+		r.mu.Unlock()
+		return nil
+	}
+
+	allowed := false
+	for _, s := range transitions[r.state] {
+		if s == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		from := r.state
+		r.mu.Unlock()
+		return fmt.Errorf("lifecycle: run %s cannot move from %s to %s", r.id, from, to)
+	}
+
+	event := Event{From: r.state, To: to, Time: time.Now(), Reason: reason}
+	r.state = to
+	r.history = append(r.history, event)
+	listeners := slices.Clone(r.listeners)
+	r.mu.Unlock()
+
+	for _, f := range listeners {
+		f(event)
+	}
+
+	return nil
+}
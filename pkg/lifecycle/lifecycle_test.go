@@ -0,0 +1,172 @@
+package lifecycle
+
+import (
+	"reflect"
+	"testing"
+)
+
+// runIn returns a run moved to state through the allowed transitions.
+func runIn(t *testing.T, state State) *Run {
+	t.Helper()
+
+	paths := map[State][]State{
+		Planned:   nil,
+		Creating:  {Creating},
+		Steady:    {Creating, Steady},
+		Draining:  {Creating, Draining},
+		Verifying: {Creating, Draining, Verifying},
+		Complete:  {Creating, Draining, Complete},
+		Failed:    {Failed},
+	}
+	r := New("run")
+	for _, s := range paths[state] {
+		if err := r.Transition(s, "setup"); err != nil {
+			t.Fatalf("moving to %s: %v", s, err)
+		}
+	}
+
+	return r
+}
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		from    State
+		to      State
+		allowed bool
+	}{
+		{from: Planned, to: Creating, allowed: true},
+		{from: Planned, to: Failed, allowed: true},
+		{from: Planned, to: Steady},
+		{from: Planned, to: Draining},
+		{from: Planned, to: Complete},
+		{from: Creating, to: Steady, allowed: true},
+		{from: Creating, to: Draining, allowed: true},
+		{from: Creating, to: Failed, allowed: true},
+		{from: Creating, to: Planned},
+		{from: Creating, to: Complete},
+		{from: Steady, to: Draining, allowed: true},
+		{from: Steady, to: Failed, allowed: true},
+		{from: Steady, to: Creating},
+		{from: Steady, to: Complete},
+		{from: Draining, to: Verifying, allowed: true},
+		{from: Draining, to: Complete, allowed: true},
+		{from: Draining, to: Failed, allowed: true},
+		{from: Draining, to: Steady},
+		{from: Verifying, to: Complete, allowed: true},
+		{from: Verifying, to: Failed, allowed: true},
+		{from: Verifying, to: Draining},
+		{from: Complete, to: Failed},
+		{from: Complete, to: Planned},
+		{from: Failed, to: Complete},
+		{from: Failed, to: Creating},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+string(tt.to), func(t *testing.T) {
+			r := runIn(t, tt.from)
+			var events []Event
+			r.OnTransition(func(e Event) { events = append(events, e) })
+
+			err := r.Transition(tt.to, "test")
+			if tt.allowed {
+				if err != nil {
+					t.Fatalf("Transition(%s) from %s: %v", tt.to, tt.from, err)
+				}
+				if got := r.State(); got != tt.to {
+					t.Errorf("State() = %s, want %s", got, tt.to)
+				}
+				if len(events) != 1 || events[0].From != tt.from || events[0].To != tt.to || events[0].Reason != "test" {
+					t.Errorf("events = %+v, want one from %s to %s", events, tt.from, tt.to)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Transition(%s) from %s succeeded, want an error", tt.to, tt.from)
+			}
+			if got := r.State(); got != tt.from {
+				t.Errorf("State() = %s after a rejected transition, want %s", got, tt.from)
+			}
+			if len(events) != 0 {
+				t.Errorf("events = %+v after a rejected transition, want none", events)
+			}
+		})
+	}
+}
+
+func TestTransitionToCurrentState(t *testing.T) {
+	for _, state := range []State{Planned, Creating, Steady, Draining, Verifying, Complete, Failed} {
+		t.Run(string(state), func(t *testing.T) {
+			r := runIn(t, state)
+			history := r.History()
+			var events []Event
+			r.OnTransition(func(e Event) { events = append(events, e) })
+
+			// Concurrent parts of a run report the same progress twice.
+			for i := 0; i < 2; i++ {
+				if err := r.Transition(state, "again"); err != nil {
+					t.Fatalf("Transition(%s) from %s: %v", state, state, err)
+				}
+			}
+			if len(events) != 0 {
+				t.Errorf("events = %+v, want none", events)
+			}
+			if got := r.History(); !reflect.DeepEqual(got, history) {
+				t.Errorf("History() = %+v, want %+v", got, history)
+			}
+		})
+	}
+}
+
+func TestFinal(t *testing.T) {
+	tests := []struct {
+		state State
+		want  bool
+	}{
+		{state: Planned},
+		{state: Creating},
+		{state: Steady},
+		{state: Draining},
+		{state: Verifying},
+		{state: Complete, want: true},
+		{state: Failed, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.state.Final(); got != tt.want {
+			t.Errorf("%s.Final() = %v, want %v", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	r := New("run")
+	if !r.Since().IsZero() {
+		t.Errorf("Since() = %v while Planned, want the zero time", r.Since())
+	}
+
+	for _, s := range []State{Creating, Steady, Draining, Complete} {
+		if err := r.Transition(s, "next"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history := r.History()
+	want := [][2]State{{Planned, Creating}, {Creating, Steady}, {Steady, Draining}, {Draining, Complete}}
+	if len(history) != len(want) {
+		t.Fatalf("History() = %+v, want %d events", history, len(want))
+	}
+	for i, e := range history {
+		if e.From != want[i][0] || e.To != want[i][1] {
+			t.Errorf("History()[%d] = %s to %s, want %s to %s", i, e.From, e.To, want[i][0], want[i][1])
+		}
+	}
+	if got := r.Since(); !got.Equal(history[len(history)-1].Time) {
+		t.Errorf("Since() = %v, want the time of the last transition %v", got, history[len(history)-1].Time)
+	}
+
+	// The history returned is a copy.
+	history[0].To = Failed
+	if r.History()[0].To != Creating {
+		t.Errorf("changing the result of History() changed the run")
+	}
+}
@@ -0,0 +1,164 @@
+package placement
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/plan"
+)
+
+// Names of the built-in strategies.
+const (
+	Random     = "random"
+	RoundRobin = "round-robin"
+	Hash       = "hash"
+	Weighted   = "weighted"
+	Zipf       = "zipf"
+	PerNode    = "per-node"
+	PerZone    = "per-zone"
+)
+
+func init() {
+	Register(Random, newRandom)
+	Register(RoundRobin, newRoundRobin)
+	Register(Hash, newHash)
+	Register(Weighted, newWeighted)
+	Register(Zipf, newZipf)
+	Register(PerNode, newPerNode)
+	Register(PerZone, newPerZone)
+}
+
+// lockedRand is a rand.Rand safe for concurrent use.
+type lockedRand struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (r *lockedRand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rnd.Intn(n)
+}
+
+func (r *lockedRand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rnd.Float64()
+}
+
+// roundRobin returns the element of items for the 1-based podIndex.
+func roundRobin(items []string, podIndex int) string {
+	return items[(podIndex-1)%len(items)]
+}
+
+// newRandom spreads pods uniformly at random over the namespaces.
+func newRandom(cluster Cluster) (Strategy, error) {
+	rnd := newLockedRand(cluster.Seed)
+
+	return StrategyFunc(func(int) Target {
+		return Target{Namespace: cluster.Namespaces[rnd.Intn(len(cluster.Namespaces))]}
+	}), nil
+}
+
+// newRoundRobin cycles through the namespaces in order.
+func newRoundRobin(cluster Cluster) (Strategy, error) {
+	return StrategyFunc(func(podIndex int) Target {
+		return Target{Namespace: roundRobin(cluster.Namespaces, podIndex)}
+	}), nil
+}
+
+// newHash derives the namespace from a hash of the pod index, so a pod lands
+// in the same namespace on every run with the same namespaces.
+func newHash(cluster Cluster) (Strategy, error) {
+	return StrategyFunc(func(podIndex int) Target {
+		h := fnv.New32a()
+		h.Write([]byte(strconv.Itoa(podIndex)))
+		return Target{Namespace: cluster.Namespaces[h.Sum32()%uint32(len(cluster.Namespaces))]}
+	}), nil
+}
+
+// newWeighted picks namespaces at random with probability proportional to
+// their weight.
+func newWeighted(cluster Cluster) (Strategy, error) {
+	if len(cluster.Weights) != len(cluster.Namespaces) {
+		return nil, fmt.Errorf("placement: %s needs one weight per namespace, got %d weights for %d namespaces", Weighted, len(cluster.Weights), len(cluster.Namespaces))
+	}
+	if plan.WeightedIndex(cluster.Weights, 0) < 0 {
+		return nil, fmt.Errorf("placement: %s needs at least one positive weight", Weighted)
+	}
+
+	rnd := newLockedRand(cluster.Seed)
+
+	return StrategyFunc(func(int) Target {
+		return Target{Namespace: cluster.Namespaces[plan.WeightedIndex(cluster.Weights, rnd.Float64())]}
+	}), nil
+}
+
+// newZipf picks namespaces at random following Zipf's law: the first
+// namespace is the busiest and the n-th receives 1/n^exponent of its pods,
+// like the power law of real multi-tenant log volume.
+func newZipf(cluster Cluster) (Strategy, error) {
+	if cluster.ZipfExponent < 0 {
+		return nil, fmt.Errorf("placement: %s needs a non-negative exponent, got %v", Zipf, cluster.ZipfExponent)
+	}
+
+	weights := plan.ZipfWeights(len(cluster.Namespaces), cluster.ZipfExponent)
+	rnd := newLockedRand(cluster.Seed)
+
+	return StrategyFunc(func(int) Target {
+		return Target{Namespace: cluster.Namespaces[plan.WeightedIndex(weights, rnd.Float64())]}
+	}), nil
+}
+
+// newPerNode pins pods to the nodes in turn, so every node receives the same
+// number of pods, and moves to the next namespace after every round of the
+// nodes, so every namespace reaches every node.
+func newPerNode(cluster Cluster) (Strategy, error) {
+	return newPerLabel(cluster, PerNode, v1.LabelHostname)
+}
+
+// newPerZone pins pods to the zones in turn, so every zone receives the same
+// number of pods regardless of how many nodes it has.
+func newPerZone(cluster Cluster) (Strategy, error) {
+	return newPerLabel(cluster, PerZone, v1.LabelTopologyZone)
+}
+
+func newPerLabel(cluster Cluster, name, label string) (Strategy, error) {
+	seen := make(map[string]bool)
+	var values []string
+	for _, node := range cluster.Nodes {
+		value, ok := node.Labels[label]
+		if !ok || seen[value] {
+			continue
+		}
+		seen[value] = true
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("placement: %s found no schedulable node labeled %s", name, label)
+	}
+	sort.Strings(values)
+
+	return StrategyFunc(func(podIndex int) Target {
+		// Taking the namespace from the same index as the node would
+		// pair each namespace with a subset of the nodes whenever their
+		// counts share a factor.
+		round := (podIndex-1)/len(values) + 1
+		return Target{
+			Namespace:    roundRobin(cluster.Namespaces, round),
+			NodeSelector: map[string]string{label: roundRobin(values, podIndex)},
+		}
+	}), nil
+}
@@ -0,0 +1,177 @@
+package placement
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func namespaces(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("ns-%d", i+1)
+	}
+
+	return names
+}
+
+func hostnameNodes(n int) []Node {
+	nodes := make([]Node, n)
+	for i := range nodes {
+		name := fmt.Sprintf("node-%d", i+1)
+		nodes[i] = Node{Name: name, Labels: map[string]string{v1.LabelHostname: name}}
+	}
+
+	return nodes
+}
+
+func TestPerNode(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces int
+		nodes      int
+	}{
+		{name: "one namespace", namespaces: 1, nodes: 3},
+		{name: "coprime counts", namespaces: 3, nodes: 2},
+		{name: "same counts", namespaces: 2, nodes: 2},
+		{name: "shared factor", namespaces: 2, nodes: 4},
+		{name: "more namespaces than nodes", namespaces: 4, nodes: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := New(PerNode, Cluster{Namespaces: namespaces(tt.namespaces), Nodes: hostnameNodes(tt.nodes)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every namespace reaches every node equally often, and
+			// every node receives the same number of pods.
+			const rounds = 3
+			pairs := make(map[[2]string]int)
+			for podIndex := 1; podIndex <= rounds*tt.namespaces*tt.nodes; podIndex++ {
+				target := strategy.Place(podIndex)
+				pairs[[2]string{target.Namespace, target.NodeSelector[v1.LabelHostname]}]++
+			}
+			if len(pairs) != tt.namespaces*tt.nodes {
+				t.Errorf("pods landed on %d namespace and node pairs, want %d: %v", len(pairs), tt.namespaces*tt.nodes, pairs)
+			}
+			for pair, count := range pairs {
+				if count != rounds {
+					t.Errorf("%s on %s received %d pods, want %d", pair[0], pair[1], count, rounds)
+				}
+			}
+
+			for podIndex := 1; podIndex <= tt.nodes; podIndex++ {
+				want := fmt.Sprintf("node-%d", podIndex)
+				if got := strategy.Place(podIndex).NodeSelector[v1.LabelHostname]; got != want {
+					t.Errorf("pod %d pinned to %s, want %s", podIndex, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPerNodeWithoutNodes(t *testing.T) {
+	nodes := []Node{{Name: "node-1", Labels: map[string]string{"role": "logger"}}}
+	if _, err := New(PerNode, Cluster{Namespaces: namespaces(1), Nodes: nodes}); err == nil {
+		t.Errorf("New(%s) without hostname labels succeeded, want an error", PerNode)
+	}
+}
+
+// shares places pods draws times with strategy and returns the share of the
+// pods every namespace received.
+func shares(strategy Strategy, namespaces []string, draws int) []float64 {
+	counts := make(map[string]int)
+	for podIndex := 1; podIndex <= draws; podIndex++ {
+		counts[strategy.Place(podIndex).Namespace]++
+	}
+
+	shares := make([]float64, len(namespaces))
+	for i, namespace := range namespaces {
+		shares[i] = float64(counts[namespace]) / float64(draws)
+	}
+
+	return shares
+}
+
+func TestWeighted(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []float64
+		want    []float64
+		wantErr bool
+	}{
+		{name: "uneven", weights: []float64{1, 3}, want: []float64{0.25, 0.75}},
+		{name: "zero weight never selected", weights: []float64{2, 0, 2}, want: []float64{0.5, 0, 0.5}},
+		{name: "one weight per namespace", weights: []float64{1}, wantErr: true},
+		{name: "no positive weight", weights: []float64{0, 0}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := namespaces(len(tt.want))
+			if tt.wantErr {
+				names = namespaces(2)
+			}
+			strategy, err := New(Weighted, Cluster{Namespaces: names, Weights: tt.weights, Seed: 1})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("New(%s) with weights %v succeeded, want an error", Weighted, tt.weights)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := shares(strategy, names, 100000)
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 0.01 {
+					t.Errorf("shares = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestZipf(t *testing.T) {
+	tests := []struct {
+		name     string
+		exponent float64
+		want     []float64
+		wantErr  bool
+	}{
+		{name: "exponent one", exponent: 1, want: []float64{6.0 / 11, 3.0 / 11, 2.0 / 11}},
+		{name: "exponent two", exponent: 2, want: []float64{36.0 / 49, 9.0 / 49, 4.0 / 49}},
+		{name: "exponent zero is uniform", exponent: 0, want: []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		{name: "negative exponent", exponent: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := namespaces(3)
+			strategy, err := New(Zipf, Cluster{Namespaces: names, ZipfExponent: tt.exponent, Seed: 1})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("New(%s) with exponent %v succeeded, want an error", Zipf, tt.exponent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := shares(strategy, names, 100000)
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 0.01 {
+					t.Errorf("shares = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Package placement chooses where each logger pod runs: its namespace and,
+// optionally, the node or zone it is pinned to.
+//
+// Strategies are looked up by name, so library users can Register their own
+// and select them the same way as the built-in ones.
+package placement
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Node is a node pods can be placed on.
+type Node struct {
+	Name   string
+	Labels map[string]string
+}
+
+// Cluster is what a Strategy places pods onto.
+type Cluster struct {
+	Namespaces []string
+
+	// Weights holds one weight per namespace for strategies that skew the
+	// load between namespaces. It may be nil.
+	Weights []float64
+
+	// ZipfExponent is the exponent of the zipf strategy.
+	ZipfExponent float64
+
+	// Nodes are the schedulable nodes, for strategies pinning pods to nodes
+	// or zones. It may be nil for the other strategies.
+	Nodes []Node
+
+	// Seed seeds the random strategies.
+	Seed int64
+}
+
+// Target is where a pod is placed.
+type Target struct {
+	Namespace string
+
+	// NodeSelector is merged into the pod's node selector. It is nil when
+	// the strategy leaves node choice to the scheduler.
+	NodeSelector map[string]string
+}
+
+// Strategy places pods. Place receives the 1-based index of the pod and may
+// be called from several goroutines at once.
+type Strategy interface {
+	Place(podIndex int) Target
+}
+
+// StrategyFunc adapts a function to a Strategy.
+type StrategyFunc func(podIndex int) Target
+
+// Place calls f(podIndex).
+func (f StrategyFunc) Place(podIndex int) Target {
+	return f(podIndex)
+}
+
+// Factory builds a Strategy for a cluster, or returns an error if the
+// strategy cannot place pods onto it.
+type Factory func(cluster Cluster) (Strategy, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a strategy available by name. It panics if name is already
+// registered, like database/sql.Register.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, dup := registry[name]; dup {
+		panic("placement: Register called twice for strategy " + name)
+	}
+	registry[name] = factory
+}
+
+// Names returns the registered strategy names in sorted order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New builds the strategy registered as name.
+func New(name string, cluster Cluster) (Strategy, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("placement: unknown strategy %q", name)
+	}
+
+	if len(cluster.Namespaces) == 0 {
+		return nil, fmt.Errorf("placement: no namespaces to place pods in")
+	}
+
+	return factory(cluster)
+}
@@ -0,0 +1,301 @@
+// Package plan holds the sizing math of a run: how many lines each pod prints
+// and how many pods are needed to generate the requested volume.
+//
+// Every function rounds up, so the planned volume is never less than the
+// requested one, and reports ErrOverflow instead of silently wrapping.
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	BytesPerKilobyte     = 1024
+	KilobytesPerMegabyte = 1024
+)
+
+// NewlineBytes is the newline ending every line a pod prints.
+const NewlineBytes = 1
+
+// CRIOverheadBytes is the most the CRI log format of the container runtime
+// adds to a line on the node: an RFC 3339 timestamp with up to nine
+// fractional digits, the stream and the partial flag, as in
+// "2006-01-02T15:04:05.999999999Z stdout F ". Runtimes trim trailing zeros of
+// the fraction, so a line may take a few bytes less.
+const CRIOverheadBytes = 40
+
+// CRIMaxLineBytes is the longest message the container runtime writes as a
+// single entry of the CRI log format. Longer messages are split into
+// partial entries flagged "P" followed by a final one flagged "F", which
+// collectors must join back together.
+const CRIMaxLineBytes = 16 * 1024
+
+// CRIPartialLines returns the most entries the container runtime writes on
+// the node for a line with a message of messageBytes: one per
+// CRIMaxLineBytes started, plus an empty final entry for a message of an
+// exact multiple.
+func CRIPartialLines(messageBytes int64) int64 {
+	return messageBytes/CRIMaxLineBytes + 1
+}
+
+// Accounting selects which bytes of a line count towards the requested
+// volume.
+type Accounting int
+
+const (
+	// AccountMessage counts the message of a line only.
+	AccountMessage Accounting = iota
+	// AccountWire counts the message and its newline, as read from the
+	// container's output.
+	AccountWire
+	// AccountDisk counts the line as the container runtime writes it to
+	// the node, in the CRI log format, split into partial entries if it is
+	// longer than CRIMaxLineBytes.
+	AccountDisk
+)
+
+// LineBytes returns the bytes a line with a message of messageBytes takes
+// under a.
+func (a Accounting) LineBytes(messageBytes int64) int64 {
+	switch a {
+	case AccountWire:
+		return messageBytes + NewlineBytes
+	case AccountDisk:
+		return messageBytes + CRIPartialLines(messageBytes)*(NewlineBytes+CRIOverheadBytes)
+	default:
+		return messageBytes
+	}
+}
+
+var (
+	ErrOverflow = errors.New("plan: value overflows int64")
+	ErrInvalid  = errors.New("plan: value must be positive")
+)
+
+// Input is the requested volume of a run.
+type Input struct {
+	// BytesPerLine is the size of the message of every line.
+	BytesPerLine    int64
+	KilobytesPerPod int64
+	MegabytesTotal  int64
+
+	// Accounting selects the bytes the requested volume is made of; lines
+	// are sized so that those bytes reach it.
+	Accounting Accounting
+}
+
+// Plan is the sizing derived from an Input.
+type Plan struct {
+	LinesPerPod int64
+	Pods        int64
+
+	// BytesPerPod is the payload printed by one pod, excluding newlines.
+	BytesPerPod int64
+
+	// TotalBytes is the payload printed by all pods, excluding newlines.
+	TotalBytes int64
+
+	// WireTotalBytes is TotalBytes with the newlines, and DiskTotalBytes
+	// the most the lines take on the nodes in the CRI log format.
+	WireTotalBytes int64
+	DiskTotalBytes int64
+
+	// RequestedBytes is the requested volume. The total of the accounting
+	// of the Input is at least RequestedBytes; the difference is the volume
+	// added by rounding lines and pods up.
+	RequestedBytes int64
+}
+
+// Total returns the total bytes of the plan under a.
+func (p Plan) Total(a Accounting) int64 {
+	switch a {
+	case AccountWire:
+		return p.WireTotalBytes
+	case AccountDisk:
+		return p.DiskTotalBytes
+	default:
+		return p.TotalBytes
+	}
+}
+
+// New computes the plan for in.
+func New(in Input) (Plan, error) {
+	var p Plan
+	var err error
+
+	if err := positive("bytes per line", in.BytesPerLine); err != nil {
+		return Plan{}, err
+	}
+	if p.LinesPerPod, err = LinesPerPod(in.Accounting.LineBytes(in.BytesPerLine), in.KilobytesPerPod); err != nil {
+		return Plan{}, err
+	}
+	if p.Pods, err = PodsPerRun(in.MegabytesTotal, in.KilobytesPerPod); err != nil {
+		return Plan{}, err
+	}
+	if p.BytesPerPod, err = mul(p.LinesPerPod, in.BytesPerLine); err != nil {
+		return Plan{}, err
+	}
+	if p.TotalBytes, err = mul(p.BytesPerPod, p.Pods); err != nil {
+		return Plan{}, err
+	}
+	lines, err := mul(p.LinesPerPod, p.Pods)
+	if err != nil {
+		return Plan{}, err
+	}
+	if p.WireTotalBytes, err = mul(lines, AccountWire.LineBytes(in.BytesPerLine)); err != nil {
+		return Plan{}, err
+	}
+	if p.DiskTotalBytes, err = mul(lines, AccountDisk.LineBytes(in.BytesPerLine)); err != nil {
+		return Plan{}, err
+	}
+	if p.RequestedBytes, err = mul(in.MegabytesTotal, KilobytesPerMegabyte*BytesPerKilobyte); err != nil {
+		return Plan{}, err
+	}
+
+	return p, nil
+}
+
+// LinesPerPod returns the number of lines of bytesPerLine bytes needed to
+// print at least kilobytesPerPod kilobytes.
+func LinesPerPod(bytesPerLine, kilobytesPerPod int64) (int64, error) {
+	if err := positive("bytes per line", bytesPerLine); err != nil {
+		return 0, err
+	}
+
+	bytesPerPod, err := mul(kilobytesPerPod, BytesPerKilobyte)
+	if err != nil {
+		return 0, err
+	}
+
+	return CeilDiv(bytesPerPod, bytesPerLine)
+}
+
+// PodsPerRun returns the number of pods printing kilobytesPerPod kilobytes
+// each needed to generate at least megabytesTotal megabytes.
+func PodsPerRun(megabytesTotal, kilobytesPerPod int64) (int64, error) {
+	if err := positive("kilobytes per pod", kilobytesPerPod); err != nil {
+		return 0, err
+	}
+
+	totalKilobytes, err := mul(megabytesTotal, KilobytesPerMegabyte)
+	if err != nil {
+		return 0, err
+	}
+
+	return CeilDiv(totalKilobytes, kilobytesPerPod)
+}
+
+// PodsPerNamespace returns the number of pods each namespace needs so that
+// the namespaces hold at least totalPods together.
+func PodsPerNamespace(totalPods, namespaces int64) (int64, error) {
+	if err := positive("namespaces", namespaces); err != nil {
+		return 0, err
+	}
+
+	return CeilDiv(totalPods, namespaces)
+}
+
+// CeilDiv returns a/b rounded up. a must not be negative and b must be
+// positive.
+func CeilDiv(a, b int64) (int64, error) {
+	if a < 0 {
+		return 0, fmt.Errorf("%w: got dividend %d", ErrInvalid, a)
+	}
+	if err := positive("divisor", b); err != nil {
+		return 0, err
+	}
+
+	q := a / b
+	if a%b != 0 {
+		q++
+	}
+
+	return q, nil
+}
+
+// Spread returns n offsets evenly spaced over d, starting at 0, so that
+// events scheduled at the offsets finish within d.
+func Spread(n int, d time.Duration) []time.Duration {
+	if n <= 0 {
+		return nil
+	}
+
+	offsets := make([]time.Duration, n)
+	for i := range offsets {
+		// Multiply before dividing to keep the offsets exact; fall back to
+		// dividing first when the product would overflow.
+		if i != 0 && int64(d) > math.MaxInt64/int64(i) {
+			offsets[i] = d / time.Duration(n) * time.Duration(i)
+		} else {
+			offsets[i] = d * time.Duration(i) / time.Duration(n)
+		}
+	}
+
+	return offsets
+}
+
+// WeightedIndex maps u, a uniform sample in [0, 1), to an index of weights
+// with probability proportional to the weight. Non-positive weights are
+// never selected. It returns -1 if no weight is positive.
+func WeightedIndex(weights []float64, u float64) int {
+	total := 0.0
+	last := -1
+	for i, w := range weights {
+		if w > 0 {
+			total += w
+			last = i
+		}
+	}
+	if last < 0 {
+		return -1
+	}
+
+	target := u * total
+	cumulative := 0.0
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		cumulative += w
+		if target < cumulative {
+			return i
+		}
+	}
+
+	// u close to 1 can exceed the cumulative sum because of rounding.
+	return last
+}
+
+// ZipfWeights returns the weights of n ranks following Zipf's law with the
+// given exponent: rank i, counted from 1, weighs 1/i^exponent, so the first
+// rank is the heaviest and an exponent of 0 weighs every rank the same.
+func ZipfWeights(n int, exponent float64) []float64 {
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1 / math.Pow(float64(i+1), exponent)
+	}
+
+	return weights
+}
+
+func mul(a, b int64) (int64, error) {
+	if a < 0 || b < 0 {
+		return 0, fmt.Errorf("%w: got %d * %d", ErrInvalid, a, b)
+	}
+	if a != 0 && b > math.MaxInt64/a {
+		return 0, fmt.Errorf("%w: %d * %d", ErrOverflow, a, b)
+	}
+
+	return a * b, nil
+}
+
+func positive(name string, v int64) error {
+	if v <= 0 {
+		return fmt.Errorf("%w: %s is %d", ErrInvalid, name, v)
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package plan
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      Input
+		want    Plan
+		wantErr error
+	}{
+		{
+			name: "exact division",
+			in:   Input{BytesPerLine: 64, KilobytesPerPod: 128, MegabytesTotal: 1},
+			want: Plan{LinesPerPod: 2048, Pods: 8, BytesPerPod: 131072, TotalBytes: 1048576, WireTotalBytes: 1064960, DiskTotalBytes: 1720320, RequestedBytes: 1048576},
+		},
+		{
+			name: "lines rounded up",
+			in:   Input{BytesPerLine: 40, KilobytesPerPod: 100, MegabytesTotal: 1},
+			want: Plan{LinesPerPod: 2560, Pods: 11, BytesPerPod: 102400, TotalBytes: 1126400, WireTotalBytes: 1154560, DiskTotalBytes: 2280960, RequestedBytes: 1048576},
+		},
+		{
+			name: "line larger than pod log",
+			in:   Input{BytesPerLine: 4096, KilobytesPerPod: 1, MegabytesTotal: 1},
+			want: Plan{LinesPerPod: 1, Pods: 1024, BytesPerPod: 4096, TotalBytes: 4194304, WireTotalBytes: 4195328, DiskTotalBytes: 4236288, RequestedBytes: 1048576},
+		},
+		{
+			name: "wire accounting",
+			in:   Input{BytesPerLine: 63, KilobytesPerPod: 128, MegabytesTotal: 1, Accounting: AccountWire},
+			want: Plan{LinesPerPod: 2048, Pods: 8, BytesPerPod: 129024, TotalBytes: 1032192, WireTotalBytes: 1048576, DiskTotalBytes: 1703936, RequestedBytes: 1048576},
+		},
+		{
+			name: "disk accounting",
+			in:   Input{BytesPerLine: 23, KilobytesPerPod: 128, MegabytesTotal: 1, Accounting: AccountDisk},
+			want: Plan{LinesPerPod: 2048, Pods: 8, BytesPerPod: 47104, TotalBytes: 376832, WireTotalBytes: 393216, DiskTotalBytes: 1048576, RequestedBytes: 1048576},
+		},
+		{
+			name: "line split by the runtime",
+			in:   Input{BytesPerLine: 20000, KilobytesPerPod: 40, MegabytesTotal: 1},
+			want: Plan{LinesPerPod: 3, Pods: 26, BytesPerPod: 60000, TotalBytes: 1560000, WireTotalBytes: 1560078, DiskTotalBytes: 1566396, RequestedBytes: 1048576},
+		},
+		{
+			name: "zero total",
+			in:   Input{BytesPerLine: 40, KilobytesPerPod: 100, MegabytesTotal: 0},
+			want: Plan{LinesPerPod: 2560, Pods: 0, BytesPerPod: 102400, TotalBytes: 0, RequestedBytes: 0},
+		},
+		{
+			name:    "zero bytes per line",
+			in:      Input{BytesPerLine: 0, KilobytesPerPod: 100, MegabytesTotal: 1},
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "negative kilobytes per pod",
+			in:      Input{BytesPerLine: 40, KilobytesPerPod: -1, MegabytesTotal: 1},
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "overflowing total",
+			in:      Input{BytesPerLine: 40, KilobytesPerPod: 100, MegabytesTotal: math.MaxInt64 / 1024},
+			wantErr: ErrOverflow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("New(%+v) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("New(%+v) = %+v, want %+v", tt.in, got, tt.want)
+			}
+			if err == nil && got.Total(tt.in.Accounting) < got.RequestedBytes {
+				t.Errorf("New(%+v) planned %d bytes, less than the requested %d", tt.in, got.Total(tt.in.Accounting), got.RequestedBytes)
+			}
+		})
+	}
+}
+
+func TestCRIPartialLines(t *testing.T) {
+	tests := []struct {
+		messageBytes int64
+		want         int64
+	}{
+		{messageBytes: 0, want: 1},
+		{messageBytes: CRIMaxLineBytes - 1, want: 1},
+		{messageBytes: CRIMaxLineBytes, want: 2},
+		{messageBytes: 40000, want: 3},
+	}
+
+	for _, tt := range tests {
+		if got := CRIPartialLines(tt.messageBytes); got != tt.want {
+			t.Errorf("CRIPartialLines(%d) = %d, want %d", tt.messageBytes, got, tt.want)
+		}
+	}
+}
+
+func TestCeilDiv(t *testing.T) {
+	tests := []struct {
+		a, b    int64
+		want    int64
+		wantErr error
+	}{
+		{a: 0, b: 3, want: 0},
+		{a: 1, b: 3, want: 1},
+		{a: 3, b: 3, want: 1},
+		{a: 4, b: 3, want: 2},
+		{a: math.MaxInt64, b: 1, want: math.MaxInt64},
+		{a: math.MaxInt64, b: 2, want: math.MaxInt64/2 + 1},
+		{a: 1, b: 0, wantErr: ErrInvalid},
+		{a: -1, b: 3, wantErr: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := CeilDiv(tt.a, tt.b)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("CeilDiv(%d, %d) error = %v, want %v", tt.a, tt.b, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CeilDiv(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPodsPerNamespace(t *testing.T) {
+	tests := []struct {
+		totalPods, namespaces int64
+		want                  int64
+		wantErr               error
+	}{
+		{totalPods: 10, namespaces: 5, want: 2},
+		{totalPods: 11, namespaces: 5, want: 3},
+		{totalPods: 1, namespaces: 5, want: 1},
+		{totalPods: 10, namespaces: 0, wantErr: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := PodsPerNamespace(tt.totalPods, tt.namespaces)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("PodsPerNamespace(%d, %d) error = %v, want %v", tt.totalPods, tt.namespaces, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("PodsPerNamespace(%d, %d) = %d, want %d", tt.totalPods, tt.namespaces, got, tt.want)
+		}
+	}
+}
+
+func TestSpread(t *testing.T) {
+	tests := []struct {
+		n    int
+		d    time.Duration
+		want []time.Duration
+	}{
+		{n: 0, d: time.Minute, want: nil},
+		{n: 1, d: time.Minute, want: []time.Duration{0}},
+		{n: 4, d: time.Minute, want: []time.Duration{0, 15 * time.Second, 30 * time.Second, 45 * time.Second}},
+		{n: 3, d: time.Second, want: []time.Duration{0, 333333333, 666666666}},
+		{n: 2, d: math.MaxInt64, want: []time.Duration{0, math.MaxInt64 / 2}},
+	}
+
+	for _, tt := range tests {
+		got := Spread(tt.n, tt.d)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Spread(%d, %v) = %v, want %v", tt.n, tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestWeightedIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []float64
+		u       float64
+		want    int
+	}{
+		{name: "first bucket", weights: []float64{1, 1, 2}, u: 0, want: 0},
+		{name: "second bucket", weights: []float64{1, 1, 2}, u: 0.25, want: 1},
+		{name: "last bucket", weights: []float64{1, 1, 2}, u: 0.5, want: 2},
+		{name: "u close to one", weights: []float64{1, 1, 2}, u: math.Nextafter(1, 0), want: 2},
+		{name: "zero weight skipped", weights: []float64{0, 1}, u: 0, want: 1},
+		{name: "trailing zero weight never selected", weights: []float64{1, 0}, u: math.Nextafter(1, 0), want: 0},
+		{name: "no positive weight", weights: []float64{0, -1}, u: 0.5, want: -1},
+		{name: "empty", weights: nil, u: 0.5, want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WeightedIndex(tt.weights, tt.u); got != tt.want {
+				t.Errorf("WeightedIndex(%v, %v) = %d, want %d", tt.weights, tt.u, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZipfWeights(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		exponent float64
+		want     []float64
+	}{
+		{name: "exponent one", n: 4, exponent: 1, want: []float64{1, 0.5, 1.0 / 3, 0.25}},
+		{name: "exponent two", n: 3, exponent: 2, want: []float64{1, 0.25, 1.0 / 9}},
+		{name: "exponent zero is uniform", n: 3, exponent: 0, want: []float64{1, 1, 1}},
+		{name: "empty", n: 0, exponent: 1, want: []float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ZipfWeights(tt.n, tt.exponent)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ZipfWeights(%d, %v) = %v, want %v", tt.n, tt.exponent, got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-12 {
+					t.Errorf("ZipfWeights(%d, %v) = %v, want %v", tt.n, tt.exponent, got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const podChurnInterval = 10 * time.Second
+
+// runPodChurn deletes churnRate of the running logger pods of namespaces per
+// minute, picked at random, until stop is closed, like rolling deploys and
+// autoscaling do. The pods deleted are replaced as any other pod that
+// completes. onDeleted is called for every pod deleted.
+func runPodChurn(clientset *kubernetes.Clientset, tracker *podTracker, namespaces []string, churnRate float64, onDeleted func(), stop <-chan struct{}) {
+	if churnRate == 0 {
+		return
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	ticker := time.NewTicker(podChurnInterval)
+	defer ticker.Stop()
+
+	// due carries the fraction of a pod left over from the previous ticks,
+	// so low rates still delete pods.
+	due := 0.0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		pods := tracker.running(namespaces)
+		due += float64(len(pods)) * churnRate * podChurnInterval.Minutes()
+		n := min(int(due), len(pods))
+		due -= float64(n)
+
+		rnd.Shuffle(len(pods), func(i, j int) { pods[i], pods[j] = pods[j], pods[i] })
+		for _, pod := range pods[:n] {
+			err := clientset.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+			if err != nil {
+				slog.Warn("Failed to delete a churned pod", "namespace", pod.Namespace, "pod", pod.Name, "error", err)
+				continue
+			}
+			slog.Debug("Churned pod deleted", "namespace", pod.Namespace, "pod", pod.Name)
+			onDeleted()
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	podConfigMapName   = "logger-config"
+	podConfigMountPath = "/etc/logger-config"
+	podSecretName      = "logger-secret"
+	podSecretMountPath = "/etc/logger-secret"
+
+	defaultPodConfigValueBytes = 32
+
+	// maxPodConfigBytes is the most data a ConfigMap or Secret can hold.
+	maxPodConfigBytes = 1 << 20
+)
+
+// PodConfig is a ConfigMap and a Secret of generated keys created in every
+// namespace and mounted by the logger pods, for collectors that enrich logs
+// from them and metadata systems that watch them.
+type PodConfig struct {
+	ConfigMapKeys int  `yaml:"config_map_keys"`
+	SecretKeys    int  `yaml:"secret_keys"`
+	ValueBytes    int  `yaml:"value_bytes"`
+	Env           bool `yaml:"env"`
+}
+
+// podConfigKey names the key number i, counted from 1.
+func podConfigKey(i int) string {
+	return fmt.Sprintf("key-%d", i)
+}
+
+// podConfigEnvName names the environment variable of key of the object
+// prefixed prefix, e.g. LOGGER_CONFIG_KEY_1.
+func podConfigEnvName(prefix, key string) string {
+	return prefix + "_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// generatePodConfigData returns keys keys of random alphanumerics of
+// valueBytes bytes.
+func generatePodConfigData(keys, valueBytes int) map[string]string {
+	const alphanumerics = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	data := make(map[string]string, keys)
+	for i := 1; i <= keys; i++ {
+		value := make([]byte, valueBytes)
+		for j := range value {
+			value[j] = alphanumerics[rand.Intn(len(alphanumerics))]
+		}
+		data[podConfigKey(i)] = string(value)
+	}
+
+	return data
+}
+
+// createPodConfig creates the ConfigMap and the Secret of podConfig in
+// namespace. Objects left by a resumed run are kept.
+func createPodConfig(clientset *kubernetes.Clientset, namespace string, podConfig PodConfig) {
+	if podConfig.ConfigMapKeys > 0 {
+		_, err := clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: podConfigMapName,
+			},
+			Data: generatePodConfigData(podConfig.ConfigMapKeys, podConfig.ValueBytes),
+		}, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			fatal("Failed to create ConfigMap", "configmap", podConfigMapName, "namespace", namespace, "error", err)
+		}
+	}
+
+	if podConfig.SecretKeys > 0 {
+		_, err := clientset.CoreV1().Secrets(namespace).Create(context.TODO(), &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: podSecretName,
+			},
+			Type:       v1.SecretTypeOpaque,
+			StringData: generatePodConfigData(podConfig.SecretKeys, podConfig.ValueBytes),
+		}, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			fatal("Failed to create Secret", "secret", podSecretName, "namespace", namespace, "error", err)
+		}
+	}
+
+	slog.Info("Pod config created", "namespace", namespace, "config_map_keys", podConfig.ConfigMapKeys, "secret_keys", podConfig.SecretKeys)
+}
+
+// podConfigVolumes returns the volumes of the logger pods mounting the
+// ConfigMap and the Secret of podConfig, their mounts, and the environment
+// variables referencing every key if podConfig.Env is set.
+func podConfigVolumes(podConfig PodConfig) ([]v1.Volume, []v1.VolumeMount, []v1.EnvVar) {
+	var volumes []v1.Volume
+	var volumeMounts []v1.VolumeMount
+	var env []v1.EnvVar
+
+	if podConfig.ConfigMapKeys > 0 {
+		volumes = append(volumes, v1.Volume{
+			Name: podConfigMapName,
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: podConfigMapName},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      podConfigMapName,
+			MountPath: podConfigMountPath,
+			ReadOnly:  true,
+		})
+		for i := 1; podConfig.Env && i <= podConfig.ConfigMapKeys; i++ {
+			env = append(env, v1.EnvVar{
+				Name: podConfigEnvName("LOGGER_CONFIG", podConfigKey(i)),
+				ValueFrom: &v1.EnvVarSource{
+					ConfigMapKeyRef: &v1.ConfigMapKeySelector{
+						LocalObjectReference: v1.LocalObjectReference{Name: podConfigMapName},
+						Key:                  podConfigKey(i),
+					},
+				},
+			})
+		}
+	}
+
+	if podConfig.SecretKeys > 0 {
+		volumes = append(volumes, v1.Volume{
+			Name: podSecretName,
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{
+					SecretName: podSecretName,
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      podSecretName,
+			MountPath: podSecretMountPath,
+			ReadOnly:  true,
+		})
+		for i := 1; podConfig.Env && i <= podConfig.SecretKeys; i++ {
+			env = append(env, v1.EnvVar{
+				Name: podConfigEnvName("LOGGER_SECRET", podConfigKey(i)),
+				ValueFrom: &v1.EnvVarSource{
+					SecretKeyRef: &v1.SecretKeySelector{
+						LocalObjectReference: v1.LocalObjectReference{Name: podSecretName},
+						Key:                  podConfigKey(i),
+					},
+				},
+			})
+		}
+	}
+
+	return volumes, volumeMounts, env
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podLog is what the pods/log API returns for a completed pod.
+type podLog struct {
+	lines  int64
+	bytes  int64
+	sha256 string
+
+	// malformed is the number of lines that are not bytes_per_log_line
+	// long, such as lines the kubelet cut. The blank lines of blank_lines
+	// and the stack traces of incidents are not checked.
+	malformed int64
+}
+
+// readPodLog reads the whole log of pod through the API server, as the
+// kubelet kept it, and checks the length of every line. The logs of
+// containers are read one after another.
+func readPodLog(ctx context.Context, clientset *kubernetes.Clientset, pod podRef, containers []string, bytesPerLine int) (podLog, error) {
+	hash := sha256.New()
+	var log podLog
+	for _, container := range containers {
+		if err := readContainerLog(ctx, clientset, pod, container, bytesPerLine, hash, &log); err != nil {
+			return podLog{}, err
+		}
+	}
+	log.sha256 = hex.EncodeToString(hash.Sum(nil))
+
+	return log, nil
+}
+
+// readContainerLog adds the log of container of pod to log and hash.
+func readContainerLog(ctx context.Context, clientset *kubernetes.Clientset, pod podRef, container string, bytesPerLine int, hash io.Writer, log *podLog) error {
+	stream, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{Container: container}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("pod %s: %w", pod, err)
+	}
+	defer stream.Close()
+
+	reader := bufio.NewReader(io.TeeReader(stream, hash))
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			log.lines++
+			log.bytes += int64(len(line))
+			if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "\tat ") && len(strings.TrimSuffix(line, "\n")) != bytesPerLine {
+				log.malformed++
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("pod %s: %w", pod, err)
+		}
+	}
+}
+
+// samplePods returns percent of pods, at least one, spread evenly over the
+// pods sorted by name.
+func samplePods(pods map[podRef]int64, percent float64) []podRef {
+	sorted := make([]podRef, 0, len(pods))
+	for pod := range pods {
+		sorted = append(sorted, pod)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+
+	n := min(len(sorted), max(1, int(math.Ceil(float64(len(sorted))*percent/100))))
+	sampled := make([]podRef, n)
+	for i := range sampled {
+		sampled[i] = sorted[i*len(sorted)/n]
+	}
+	return sampled
+}
+
+// verifyPodsLog implements verify pods-log: it reads the logs of a sample of
+// the completed pods through the pods/log API and compares them with the
+// lines the pods printed, to tell the loss of the kubelet, such as rotated
+// or cut logs, from the loss of the collectors.
+func verifyPodsLog(configFile string, args []string) int {
+	var options verifyOptions
+	fs := flag.NewFlagSet("verify pods-log", flag.ContinueOnError)
+	options.register(fs)
+	samplePercent := fs.Float64("sample-percent", 10, "percentage of the completed pods whose logs are read")
+	checksumsOut := fs.String("checksums-out", "", "file to write the SHA-256 of every log read to, in the format of sha256sum")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := options.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *samplePercent <= 0 || *samplePercent > 100 {
+		fmt.Fprintln(os.Stderr, "--sample-percent must be greater than 0 and at most 100")
+		return 2
+	}
+
+	config := loadConfig(configFile)
+	if config.RestartsPerPod > 0 {
+		// The pods/log API returns the current instance of a container, or
+		// with previous the one before, never the lines of every restart.
+		fatal("verify pods-log does not support restarts_per_pod, as the pods/log API only returns the last instance of a container", "restarts_per_pod", config.RestartsPerPod)
+	}
+	bytesPerLine := int(config.BytesPerLogLine)
+	containers := podContainers(config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.timeout)
+	defer cancel()
+
+	queries := newBackendQueries("Pod logs", options)
+	sampled := generatedPods{lines: make(map[podRef]int64)}
+	received := make(map[podRef]int64)
+	var completed int
+	var receivedBytes, malformed int64
+	var checksums []string
+
+	// Pods are sampled per cluster, as their logs are read from their own.
+	for _, clientset := range configClientsets(config) {
+		generated, err := listGeneratedPods([]*kubernetes.Clientset{clientset}, options.runID)
+		if err != nil {
+			fatal("Failed to list the pods of the run", "error", err)
+		}
+		completed += len(generated.lines)
+		sampled.skipped += generated.skipped
+		if len(generated.lines) == 0 {
+			continue
+		}
+
+		// The logs are read concurrently and added up in the order of the
+		// pods, which the checksums keep.
+		pods := samplePods(generated.lines, *samplePercent)
+		logs := make([]podLog, len(pods))
+		err = queries.each(ctx, len(pods), func(ctx context.Context, i int) error {
+			return queries.do(ctx, "log of pod "+pods[i].String(), func() (err error) {
+				logs[i], err = readPodLog(ctx, clientset, pods[i], containers, bytesPerLine)
+				return err
+			})
+		})
+		if err != nil {
+			fatal("Failed to read the log of a pod", "error", err)
+		}
+
+		for i, pod := range pods {
+			log := logs[i]
+			slog.Debug("Read the log of a pod", "namespace", pod.Namespace, "pod", pod.Name, "lines", log.lines, "bytes", log.bytes, "sha256", log.sha256)
+
+			sampled.lines[pod] += generated.lines[pod]
+			received[pod] += log.lines
+			receivedBytes += log.bytes
+			malformed += log.malformed
+			checksums = append(checksums, fmt.Sprintf("%s  %s\n", log.sha256, pod))
+		}
+	}
+	if completed == 0 {
+		fatal("No completed pod of the run found", "run_id", options.runID, "skipped", sampled.skipped)
+	}
+
+	if *checksumsOut != "" {
+		if err := os.WriteFile(*checksumsOut, []byte(strings.Join(checksums, "")), 0o644); err != nil {
+			fatal("Failed to write the checksums", "path", *checksumsOut, "error", err)
+		}
+	}
+
+	result := compareLines(sampled, received)
+	code := reportVerification("Pod logs", result, options)
+	fmt.Printf("Read %d of %d completed pods: expected %d bytes, received %d, %d lines not %d bytes long\n",
+		len(sampled.lines), completed, result.ExpectedLines*int64(bytesPerLine+1), receivedBytes, malformed, bytesPerLine)
+	if malformed > 0 {
+		code = exitVerificationFailed
+	}
+	return code
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const podTrackerSyncTimeout = 1 * time.Minute
+
+// podTracker keeps a watch-based cache of the logger pods of a run, so
+// counting them costs no API request.
+type podTracker struct {
+	lister corelisters.PodLister
+}
+
+// startPodTracker watches the pods labeled with runID in every namespace
+// until stop is closed, and returns once the cache holds the current pods.
+// onDisruption is called once for every pod evicted, preempted or otherwise
+// disrupted, with the reason.
+func startPodTracker(clientset *kubernetes.Clientset, runID string, onDisruption func(pod *v1.Pod, reason string), stop <-chan struct{}) (*podTracker, error) {
+	selector := labels.SelectorFromSet(labels.Set{runIDLabel: runID}).String()
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selector
+		}),
+	)
+	podInformer := factory.Core().V1().Pods()
+	lister := podInformer.Lister()
+
+	// The handler is called for one event at a time, so disrupted needs no
+	// lock.
+	disrupted := make(map[types.UID]bool)
+	record := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		pod, ok := obj.(*v1.Pod)
+		if !ok || disrupted[pod.UID] {
+			return
+		}
+		if reason, ok := disruptionReason(pod); ok {
+			disrupted[pod.UID] = true
+			onDisruption(pod, reason)
+		}
+	}
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    record,
+		UpdateFunc: func(_, obj interface{}) { record(obj) },
+		DeleteFunc: record,
+	})
+
+	factory.Start(stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), podTrackerSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), podInformer.Informer().HasSynced) {
+		return nil, fmt.Errorf("pods of run %s could not be listed within %s", runID, podTrackerSyncTimeout)
+	}
+
+	return &podTracker{lister: lister}, nil
+}
+
+// runningPods returns the number of logger pods in namespaces that have not
+// completed.
+func (t *podTracker) runningPods(namespaces []string) int {
+	running, _, _ := t.podPhases(namespaces)
+	return running
+}
+
+// running returns the logger pods in namespaces that are running and not
+// being deleted.
+func (t *podTracker) running(namespaces []string) []*v1.Pod {
+	var running []*v1.Pod
+	for _, ns := range namespaces {
+		pods, _ := t.lister.Pods(ns).List(labels.Everything())
+		for _, pod := range pods {
+			if pod.Status.Phase == v1.PodRunning && pod.DeletionTimestamp == nil {
+				running = append(running, pod)
+			}
+		}
+	}
+
+	return running
+}
+
+// podPhases returns the number of logger pods in namespaces that have not
+// completed, that succeeded and that failed.
+func (t *podTracker) podPhases(namespaces []string) (running, succeeded, failed int) {
+	for _, ns := range namespaces {
+		// Listing from the cache cannot fail.
+		pods, _ := t.lister.Pods(ns).List(labels.Everything())
+		for _, pod := range pods {
+			switch pod.Status.Phase {
+			case v1.PodSucceeded:
+				succeeded++
+			case v1.PodFailed:
+				failed++
+			default:
+				running++
+			}
+		}
+	}
+
+	return running, succeeded, failed
+}
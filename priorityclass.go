@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultPriorityClassName  = "k8s-pod-log-generator-low"
+	defaultPriorityClassValue = -10
+)
+
+func createPriorityClass(clientset *kubernetes.Clientset, name string, value int32) {
+	preemptionPolicy := v1.PreemptNever
+
+	_, err := clientset.SchedulingV1().PriorityClasses().Create(context.TODO(), &schedulingv1.PriorityClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Value:            value,
+		PreemptionPolicy: &preemptionPolicy,
+		Description:      "Low priority for pods created by k8s-pod-log-generator so they are evicted before real workloads.",
+	}, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		slog.Info("PriorityClass already exists", "priority_class", name)
+		return
+	}
+	if err != nil {
+		fatal("Failed to create PriorityClass", "priority_class", name, "error", err)
+	}
+	slog.Info("PriorityClass created", "priority_class", name, "value", value)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	profileSteady         = "steady"
+	profileEphemeralBurst = "ephemeral-burst"
+	profileCatchUp        = "catch-up"
+)
+
+// catchUpTimestampBytes is the length of the "2006-01-02T15:04:05Z " prefix
+// of catch-up lines.
+const catchUpTimestampBytes = 21
+
+// buildProfileScript returns the shell script run by the default
+// container_command for the configured profile.
+func buildProfileScript(config Config, totalLogLines int) string {
+	bytesPerLine := int(config.BytesPerLogLine)
+
+	loopPrefix := ""
+	if len(config.FreezeWindows) > 0 {
+		loopPrefix = "wait_if_paused; "
+	}
+
+	switch config.Profile {
+	case profileEphemeralBurst:
+		// Emit the whole payload in a single pipeline so the pod exits
+		// within a fraction of a second.
+		return loopPrefix + switchFormat(config, func(format string) string {
+			payloadBytes := bytesPerLine - formatOverheadBytes(format)
+			pipeline := fmt.Sprintf("tr -dc 'a-zA-Z0-9' < /dev/urandom | head -c %d | fold -w %d; echo", totalLogLines*payloadBytes, payloadBytes)
+			if config.SequenceNumbers {
+				// The marker replaces the start of every line.
+				pipeline = fmt.Sprintf(`{ %s; } | awk -v pod="$HOSTNAME" '{ m = "pod=" pod " seq=" NR " "; print m substr($0, 1, length($0) - length(m)) }'`, pipeline)
+			}
+			if format == formatJSON {
+				pipeline = fmt.Sprintf(`{ %s; } | sed 's/.*/{"level":"info","msg":"&"}/'`, pipeline)
+			}
+			return pipeline
+		})
+	case profileCatchUp:
+		// Buffer timestamped lines in a file while the application is
+		// "stalled", then dump the whole backlog at once.
+		linesPerSecond := int(math.Ceil(float64(totalLogLines) / float64(config.CatchUpStallSeconds)))
+		return fmt.Sprintf(": > /tmp/backlog; i=0; while [ $i -lt %d ]; do %sts=$(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ); j=0; while [ $j -lt %d ] && [ $i -lt %d ]; do %secho \"$ts $(emit_line %d%s)\" >> /tmp/backlog; i=$((i+1)); j=$((j+1)); done; sleep 1; done; cat /tmp/backlog",
+			totalLogLines, loopPrefix, linesPerSecond, totalLogLines, linenoCommand(config, "$((i+1))"), bytesPerLine-catchUpTimestampBytes, markerArg(config, "$((i+1))"))
+	default:
+		if config.RestartsPerPod > 0 {
+			return buildRestartingScript(config, totalLogLines, loopPrefix)
+		}
+		seq := "$i"
+		if config.sequenceOffset > 0 {
+			seq = fmt.Sprintf("$((i + %d))", config.sequenceOffset)
+		}
+		pace := ""
+		if config.linesPerSecond > 0 {
+			pace = fmt.Sprintf("; [ $((i %% %d)) -ne 0 ] || sleep 1", config.linesPerSecond)
+		}
+		return fmt.Sprintf("for i in $(seq 1 %d); do %s%semit_line %d%s%s%s; done", totalLogLines, loopPrefix, linenoCommand(config, seq), bytesPerLine, markerArg(config, seq), oomKillCheck(config), pace)
+	}
+}
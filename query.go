@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// Defaults of the flags pacing the queries of verify.
+const (
+	defaultQueryConcurrency = 4
+	defaultQueryQPS         = 10
+)
+
+// maxQueryAttempts is the number of attempts of a query the backend refused
+// as too many or failed on its side.
+const maxQueryAttempts = 5
+
+// queryBackoff is the delay between attempts of a query: one second,
+// doubling up to half a minute.
+func queryBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: 1 * time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      30 * time.Second,
+	}
+}
+
+// statusError is a response of a backend with a status other than success.
+type statusError struct {
+	code       int
+	retryAfter time.Duration
+	message    string
+}
+
+// responseError returns the error of resp, whose body was body.
+func responseError(resp *http.Response, body []byte) error {
+	err := &statusError{code: resp.StatusCode, message: fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body)))}
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+		err.retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return err
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// retryable reports whether err is a response that may succeed when sent
+// again, a 429 or a 5xx, and how long the backend asked to wait, if at all.
+func retryable(err error) (bool, time.Duration) {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= 500, status.retryAfter
+	}
+
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		code := int(apiStatus.Status().Code)
+		return code == http.StatusTooManyRequests || code >= 500, 0
+	}
+
+	return false, 0
+}
+
+// backendQueries paces the queries verify sends to a backend: at most
+// concurrency of them at once and qps per second, each retried with backoff
+// when the backend answers with a 429 or a 5xx.
+type backendQueries struct {
+	backend     string
+	concurrency int
+	limiter     flowcontrol.RateLimiter
+}
+
+func newBackendQueries(backend string, options verifyOptions) *backendQueries {
+	return &backendQueries{
+		backend:     backend,
+		concurrency: max(1, options.concurrency),
+		limiter:     flowcontrol.NewTokenBucketRateLimiter(float32(options.qps), 1),
+	}
+}
+
+// do sends the query described by what with send, within the QPS limit,
+// and returns its last error after maxQueryAttempts attempts. Errors that no
+// retry can fix are returned at once.
+func (q *backendQueries) do(ctx context.Context, what string, send func() error) error {
+	backoff := queryBackoff()
+	for attempt := 1; ; attempt++ {
+		if err := q.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		err := send()
+		retry, retryAfter := retryable(err)
+		if err == nil || !retry || attempt == maxQueryAttempts {
+			return err
+		}
+
+		delay := max(backoff.Step(), retryAfter)
+		slog.Warn("Query failed, retrying", "backend", q.backend, "query", what, "attempt", attempt, "delay", delay.Round(time.Millisecond), "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// each calls query for every index below n on concurrency workers, and
+// returns the first error, which stops the queries not started yet.
+func (q *backendQueries) each(ctx context.Context, n int, query func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(q.concurrency, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := query(ctx, i); err != nil {
+					cancel(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
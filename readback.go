@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// operationLogReadBack is the operation of the API errors of the reader.
+const operationLogReadBack = "log read-back"
+
+const (
+	logReadBackPollInterval = 1 * time.Second
+	logReadBackStartTimeout = 5 * time.Minute
+)
+
+// logReader follows the logs of a sample of the logger pods through the API
+// server, the path of `kubectl logs -f`, and accounts for what it reads. A
+// nil *logReader follows nothing.
+type logReader struct {
+	clientset *kubernetes.Clientset
+	cluster   string
+	percent   int
+	m         *metrics
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	start  time.Time
+
+	streams atomic.Int64
+	errors  atomic.Int64
+	lines   atomic.Int64
+	bytes   atomic.Int64
+}
+
+// newLogReader returns a reader following percent of the pods of cluster, or
+// nil if percent is zero.
+func newLogReader(clientset *kubernetes.Clientset, cluster string, percent int, m *metrics) *logReader {
+	if percent == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &logReader{
+		clientset: clientset,
+		cluster:   cluster,
+		percent:   percent,
+		m:         m,
+		ctx:       ctx,
+		cancel:    cancel,
+		start:     time.Now(),
+	}
+}
+
+// sampled reports whether the pod numbered podNumber is followed. Exactly
+// percent of every 100 consecutive pods are.
+func (l *logReader) sampled(podNumber int) bool {
+	if l == nil {
+		return false
+	}
+
+	return (podNumber+1)*l.percent/100 > podNumber*l.percent/100
+}
+
+// follow streams the logs of the pod in the background once its container
+// has started, until the pod completes or the reader is stopped.
+func (l *logReader) follow(namespace, podName string) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		if err := l.waitForStart(namespace, podName); err != nil {
+			if l.ctx.Err() == nil {
+				l.failed(err)
+				slog.Warn("Failed to read back the logs of pod", "namespace", namespace, "pod", podName, "error", err)
+			}
+			return
+		}
+
+		stream, err := l.clientset.CoreV1().Pods(namespace).GetLogs(podName, &v1.PodLogOptions{Follow: true}).Stream(l.ctx)
+		if err != nil {
+			if l.ctx.Err() == nil {
+				l.failed(err)
+				slog.Warn("Failed to read back the logs of pod", "namespace", namespace, "pod", podName, "error", err)
+			}
+			return
+		}
+		defer stream.Close()
+
+		l.streams.Add(1)
+		l.m.logReadBackStreams.WithLabelValues(l.cluster).Inc()
+		defer l.m.logReadBackStreams.WithLabelValues(l.cluster).Dec()
+
+		if _, err := io.Copy(l, stream); err != nil && l.ctx.Err() == nil {
+			l.failed(err)
+			slog.Warn("Reading back the logs of pod broke off", "namespace", namespace, "pod", podName, "error", err)
+		}
+	}()
+}
+
+// waitForStart waits until the pod has left the Pending phase, as logs
+// cannot be read before its container has started.
+func (l *logReader) waitForStart(namespace, podName string) error {
+	ctx, cancel := context.WithTimeout(l.ctx, logReadBackStartTimeout)
+	defer cancel()
+
+	return wait.PollUntilContextCancel(ctx, logReadBackPollInterval, true, func(ctx context.Context) (bool, error) {
+		pod, err := l.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return pod.Status.Phase != v1.PodPending, nil
+	})
+}
+
+// Write accounts for p read from a log stream.
+func (l *logReader) Write(p []byte) (int, error) {
+	lines := bytes.Count(p, []byte{'\n'})
+	l.lines.Add(int64(lines))
+	l.bytes.Add(int64(len(p)))
+	l.m.logReadBack(l.cluster, lines, len(p))
+
+	return len(p), nil
+}
+
+func (l *logReader) failed(err error) {
+	l.errors.Add(1)
+	l.m.logReadBackFailed(l.cluster)
+	l.m.apiError(l.cluster, operationLogReadBack, err)
+}
+
+// stop closes the streams still open and reports the read-back throughput.
+func (l *logReader) stop(tags map[string]string) {
+	if l == nil {
+		return
+	}
+
+	l.cancel()
+	l.wg.Wait()
+
+	elapsed := time.Since(l.start)
+	slog.Info("Log read-back", "tags", tags, "streams", l.streams.Load(), "lines", l.lines.Load(), "bytes", l.bytes.Load(),
+		"elapsed", elapsed.Round(time.Second), "bytes_per_second", math.Round(float64(l.bytes.Load())/elapsed.Seconds()), "failures", l.errors.Load())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// A node is flagged when it received more than this factor of the mean
+// number of pods per node.
+const disproportionateLoadFactor = 1.5
+
+type nodeLoad struct {
+	Node          string
+	Pods          int
+	ExpectedBytes int64
+}
+
+func reportPerNodeLoad(clientset *kubernetes.Clientset, namespaces []string, bytesPerPod int64, tags map[string]string) {
+	loads := map[string]*nodeLoad{}
+
+	nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		slog.Warn("Failed to list nodes, nodes without logger pods are not reported", "error", err)
+	} else {
+		for _, node := range nodes.Items {
+			if node.Spec.Unschedulable {
+				continue
+			}
+			loads[node.Name] = &nodeLoad{Node: node.Name}
+		}
+	}
+
+	for _, ns := range namespaces {
+		pods, err := clientset.CoreV1().Pods(ns).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			fatal("Failed to list pods", "namespace", ns, "error", err)
+		}
+
+		for _, pod := range pods.Items {
+			nodeName := pod.Spec.NodeName
+			if nodeName == "" {
+				nodeName = "<unscheduled>"
+			}
+			if loads[nodeName] == nil {
+				loads[nodeName] = &nodeLoad{Node: nodeName}
+			}
+			loads[nodeName].Pods++
+			loads[nodeName].ExpectedBytes += bytesPerPod
+		}
+	}
+
+	if len(loads) == 0 {
+		return
+	}
+
+	sorted := make([]*nodeLoad, 0, len(loads))
+	totalPods := 0
+	for _, load := range loads {
+		sorted = append(sorted, load)
+		totalPods += load.Pods
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Node < sorted[j].Node
+	})
+
+	meanPods := float64(totalPods) / float64(len(sorted))
+
+	slog.Info("Per-node load", "tags", tags, "pods", totalPods, "nodes", len(sorted), "mean_pods_per_node", math.Round(meanPods*10)/10)
+	for _, load := range sorted {
+		share := 0.0
+		if totalPods > 0 {
+			share = float64(load.Pods) * 100 / float64(totalPods)
+		}
+		slog.Info("Node load", "node", load.Node, "pods", load.Pods, "share_percent", math.Round(share*10)/10, "expected_bytes", load.ExpectedBytes,
+			"disproportionate", float64(load.Pods) > meanPods*disproportionateLoadFactor)
+	}
+}
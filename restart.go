@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+)
+
+const (
+	restartStateVolumeName = "logger-state"
+	restartStateMountPath  = "/logger-state"
+)
+
+// buildRestartingScript returns the steady script of a pod whose container
+// exits with an error restartsPerPod times before completing. The payload is
+// split into restartsPerPod+1 segments; each container instance prints the
+// segment of its restart count, read from an emptyDir that survives
+// restarts, and prefixes its lines with "restart=<count> ". Every instance
+// draws new random content, so no line is printed by two instances.
+func buildRestartingScript(config Config, totalLogLines int, loopPrefix string) string {
+	segments := config.RestartsPerPod + 1
+	linesPerSegment := (totalLogLines + segments - 1) / segments
+	seq := fmt.Sprintf("$((restart * %d + i))", linesPerSegment)
+
+	return fmt.Sprintf(`restart=$(cat %[1]s/restarts 2>/dev/null || echo 0); echo $((restart + 1)) > %[1]s/restarts; marker="restart=$restart "; lines=$((%[2]d - restart * %[3]d)); if [ $lines -gt %[3]d ]; then lines=%[3]d; fi; for i in $(seq 1 $lines); do %[4]s%[8]sprintf '%%s' "$marker"; emit_line $((%[5]d - ${#marker}))%[7]s; done; if [ $restart -lt %[6]d ]; then exit 1; fi`,
+		restartStateMountPath, totalLogLines, linesPerSegment, loopPrefix, config.BytesPerLogLine, config.RestartsPerPod, markerArg(config, seq), linenoCommand(config, seq))
+}
+
+// restartStateVolume returns the emptyDir keeping the restart count of the
+// logger container.
+func restartStateVolume() (v1.Volume, v1.VolumeMount) {
+	return v1.Volume{
+		Name: restartStateVolumeName,
+		VolumeSource: v1.VolumeSource{
+			EmptyDir: &v1.EmptyDirVolumeSource{},
+		},
+	}, v1.VolumeMount{
+		Name:      restartStateVolumeName,
+		MountPath: restartStateMountPath,
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const defaultMaxConsecutiveFailures = 10
+
+// maxCreateAttempts is the number of attempts to create an object before the
+// error policy decides what happens.
+const maxCreateAttempts = 5
+
+// createBackoff is the delay between attempts to create an object: one
+// second, doubling up to a minute.
+func createBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: 1 * time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      1 * time.Minute,
+	}
+}
+
+// failureTracker counts consecutive failed API calls across goroutines and
+// aborts the run once there are too many, as the cluster is then more likely
+// broken than busy.
+type failureTracker struct {
+	max         int64
+	consecutive atomic.Int64
+}
+
+func newFailureTracker(max int) *failureTracker {
+	return &failureTracker{max: int64(max)}
+}
+
+func (t *failureTracker) success() {
+	t.consecutive.Store(0)
+}
+
+func (t *failureTracker) failure(err error) {
+	if n := t.consecutive.Add(1); n >= t.max {
+		fatal("Aborting after consecutive failures", "failures", n, "error", err)
+	}
+}
+
+// retryCreate calls create until it succeeds, backing off exponentially
+// between attempts, and returns the last error after maxCreateAttempts
+// attempts. Errors that no retry can fix are returned at once.
+func retryCreate(failures *failureTracker, what string, create func() error) error {
+	backoff := createBackoff()
+	for attempt := 1; ; attempt++ {
+		err := create()
+
+		// A previous attempt may have succeeded even though its response
+		// was lost.
+		if err == nil || (attempt > 1 && apierrors.IsAlreadyExists(err)) {
+			if attempt > 1 {
+				slog.Debug("Created after retrying", "object", what, "attempts", attempt)
+			}
+			failures.success()
+			return nil
+		}
+		failures.failure(err)
+		if attempt == maxCreateAttempts || apierrors.IsAlreadyExists(err) || apierrors.IsInvalid(err) {
+			return err
+		}
+
+		delay := backoff.Step()
+		slog.Warn("Failed to create, retrying", "object", what, "attempt", attempt, "delay", delay.Round(time.Millisecond), "error", err)
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	sigtermExit           = "exit"
+	sigtermIgnore         = "ignore"
+	sigtermLogUntilKilled = "log-until-killed"
+)
+
+// buildScript returns the shell script exposed to container_command as
+// {{.Script}}: the profile payload wrapped with the configured SIGTERM
+// handling.
+func buildScript(config Config, totalLogLines int) string {
+	parts := []string{emitFunctions(config)}
+
+	if len(config.FreezeWindows) > 0 {
+		parts = append(parts, waitIfPausedFunction)
+	}
+
+	switch config.SigtermBehavior {
+	case sigtermExit:
+		parts = append(parts, `trap 'echo "SIGTERM received, exiting"; exit 0' TERM`)
+	case sigtermIgnore:
+		parts = append(parts, `trap '' TERM`)
+	case sigtermLogUntilKilled:
+		parts = append(parts, `trap 'terminating=1' TERM`)
+	}
+
+	parts = append(parts, buildProfileScript(config, totalLogLines))
+
+	if config.SigtermBehavior == sigtermLogUntilKilled {
+		// Keep printing after the payload until the kubelet sends SIGKILL at
+		// the end of the grace period.
+		parts = append(parts, fmt.Sprintf(`if [ -n "$terminating" ]; then n=%d; while :; do n=$((n+1)); %semit_line %d%s; done; fi`, totalLogLines, linenoCommand(config, "$n"), config.BytesPerLogLine, markerArg(config, "$n")))
+	}
+
+	script := strings.Join(parts, "; ")
+	if config.SidecarTailer {
+		return sidecarScript(script)
+	}
+	return script
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+const (
+	podSecurityPrivileged = "privileged"
+	podSecurityBaseline   = "baseline"
+	podSecurityRestricted = "restricted"
+)
+
+// nobody in busybox, so the default image runs as non-root.
+const restrictedRunAsUser = 65534
+
+func buildNamespaceSecurityLabels(level string) map[string]string {
+	return map[string]string{
+		"pod-security.kubernetes.io/enforce": level,
+		"pod-security.kubernetes.io/warn":    level,
+	}
+}
+
+func buildPodSecurityContext(level string) *v1.PodSecurityContext {
+	if level != podSecurityRestricted {
+		return nil
+	}
+
+	runAsNonRoot := true
+	runAsUser := int64(restrictedRunAsUser)
+
+	return &v1.PodSecurityContext{
+		RunAsNonRoot: &runAsNonRoot,
+		RunAsUser:    &runAsUser,
+		RunAsGroup:   &runAsUser,
+		SeccompProfile: &v1.SeccompProfile{
+			Type: v1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+func buildContainerSecurityContext(level string) *v1.SecurityContext {
+	if level != podSecurityRestricted {
+		return nil
+	}
+
+	allowPrivilegeEscalation := false
+	readOnlyRootFilesystem := true
+
+	return &v1.SecurityContext{
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+		Capabilities: &v1.Capabilities{
+			Drop: []v1.Capability{"ALL"},
+		},
+	}
+}
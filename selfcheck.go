@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// selfCheckLines is the number of lines the self-check generates per format.
+const selfCheckLines = 20
+
+const selfCheckTimeout = 30 * time.Second
+
+// selfCheckPodName stands in for the pod name the kubelet sets as $HOSTNAME.
+const selfCheckPodName = "logger-pod-self-check"
+
+// selfCheck runs the script of the logger pods locally on a sample of lines
+// in every format of the run and verifies that each line has the configured
+// size and format, so a broken profile or format is caught before any pod is
+// created. The sample leaves out restarts, freeze windows and SIGTERM
+// handling, which need the pod around the script.
+func selfCheck(config Config) error {
+	for _, format := range formats(config) {
+		sample := config
+		sample.Format = format
+		sample.FormatMigration = nil
+		sample.RestartsPerPod = 0
+		sample.FreezeWindows = nil
+		sample.SigtermBehavior = ""
+		sample.SidecarTailer = false
+		sample.CatchUpStallSeconds = 1
+		if sample.Profile == profileSteady && (len(sample.LoggerContainers) > 0 || sample.InitContainerLines > 0) {
+			// The sample prints its lines after those of an earlier
+			// container, so the lines are numbered in the pod apart
+			// from the count of the container.
+			sample.sequenceOffset = selfCheckLines
+		}
+		if len(sample.Incidents) > 0 {
+			// The self-check pod takes part in an incident running for the
+			// whole check, like the first one.
+			incident := sample.Incidents[0]
+			incident.StartMinute = 0
+			incident.DurationMinutes = 1
+			incident.PodsPercent = 100
+			sample.Incidents = []Incident{incident}
+		}
+		if sample.Anomalies != nil {
+			// Every fourth line of the self-check pod is an anomaly, so
+			// the few lines checked cover most kinds.
+			anomalies := *sample.Anomalies
+			anomalies.OneInLines = 4
+			sample.Anomalies = &anomalies
+		}
+		if sample.PartialLines != nil {
+			// The lines are checked once complete; the delay only slows
+			// the check down.
+			partialLines := *sample.PartialLines
+			partialLines.DelayMilliseconds = 0
+			sample.PartialLines = &partialLines
+		}
+
+		if sample.TimestampPrefix != nil {
+			sample.timestampPrefixBytes = sample.TimestampPrefix.prefixBytes()
+			if sample.timestampPrefixBytes == 0 {
+				timestamp, err := exec.Command("date", "-u", "+"+sample.TimestampPrefix.Strftime).Output()
+				if err != nil {
+					return fmt.Errorf("running date with timestamp_prefix.strftime: %w", err)
+				}
+				sample.timestampPrefixBytes = len(strings.TrimSuffix(string(timestamp), "\n")) + 1
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), selfCheckTimeout)
+		cmd := exec.CommandContext(ctx, "sh", "-c", buildScript(sample, selfCheckLines))
+		// BSD tr refuses random bytes in a multibyte locale.
+		cmd.Env = append(os.Environ(), "LC_ALL=C", "HOSTNAME="+selfCheckPodName, fmt.Sprintf("%s=%d", runStartEnv, time.Now().Unix()))
+		var output []byte
+		var err error
+		if sample.StderrPercent > 0 {
+			// The lines printed to standard error are checked in order
+			// with the others.
+			output, err = cmd.CombinedOutput()
+		} else {
+			output, err = cmd.Output()
+		}
+		cancel()
+		if err != nil {
+			return fmt.Errorf("running the %s script: %w", format, err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+		if sample.BlankLines != nil {
+			var blanks int
+			lines, blanks = cutBlankLines(lines)
+			if want := spreadCount(selfCheckLines, sample.BlankLines.Percent); blanks != want {
+				return fmt.Errorf("the %s script printed %d blank lines, want %d", format, blanks, want)
+			}
+		}
+		if sample.DuplicateLines != nil {
+			var duplicates int
+			lines, duplicates = sample.DuplicateLines.cutDuplicates(lines, sample.duplicateRunLines)
+			if want := spreadCount(selfCheckLines, sample.DuplicateLines.Percent); duplicates != want {
+				return fmt.Errorf("the %s script printed %d duplicated lines, want %d", format, duplicates, want)
+			}
+		}
+		if len(sample.Incidents) > 0 && sample.Incidents[0].StackTraces {
+			var stackTraces int
+			lines, stackTraces = cutStackTraces(lines)
+			if want := spreadCount(selfCheckLines, sample.Incidents[0].ErrorPercent); stackTraces != want {
+				return fmt.Errorf("the %s script printed %d stack traces, want %d", format, stackTraces, want)
+			}
+		}
+		if len(lines) != selfCheckLines {
+			return fmt.Errorf("the %s script printed %d lines, want %d", format, len(lines), selfCheckLines)
+		}
+
+		for i, line := range lines {
+			if err := checkLine(sample, line, i+1); err != nil {
+				return fmt.Errorf("line %d of the %s script: %w: %q", i+1, format, err, line)
+			}
+		}
+	}
+
+	return nil
+}
+
+// cutBlankLines removes the empty and whitespace-only lines from lines and
+// returns the others and the number removed.
+func cutBlankLines(lines []string) ([]string, int) {
+	var kept []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			kept = append(kept, line)
+		}
+	}
+
+	return kept, len(lines) - len(kept)
+}
+
+// checkLine verifies that line, the seq-th of its container, has the size, format,
+// line ending, invalid byte, timestamp prefix, line template, fake fields,
+// level, emission timestamp, sequence marker, trace, request and error
+// markers, anomalies and colors of config.
+func checkLine(config Config, line string, seq int) error {
+	if ByteSize(len(line)) != config.BytesPerLogLine {
+		return fmt.Errorf("%d bytes, want %d", len(line), config.BytesPerLogLine)
+	}
+
+	if config.InvalidBytes != nil && spreadSelected(seq, config.InvalidBytes.Percent) {
+		var err error
+		if line, err = config.InvalidBytes.cutInvalidByte(line); err != nil {
+			return err
+		}
+	}
+
+	if config.LineEnding == lineEndingCRLF || config.LineEnding == lineEndingMixed && seq%2 == 1 {
+		if !strings.HasSuffix(line, "\r") {
+			return fmt.Errorf("no carriage return")
+		}
+		line = strings.TrimSuffix(line, "\r")
+	}
+
+	// The lines are numbered in the pod after those of the earlier
+	// containers.
+	podSeq := seq + config.sequenceOffset
+	erred := selfCheckErred(config, seq)
+	payload := line
+	if config.Profile == profileCatchUp {
+		if _, err := time.Parse("2006-01-02T15:04:05Z ", line[:catchUpTimestampBytes]); err != nil {
+			return fmt.Errorf("no timestamp prefix")
+		}
+		payload = line[catchUpTimestampBytes:]
+	}
+
+	if config.TimestampPrefix != nil {
+		var err error
+		if payload, err = config.TimestampPrefix.cutTimestamp(payload, config.timestampPrefixBytes); err != nil {
+			return err
+		}
+	}
+
+	if slices.Contains(templatedFormats, config.Format) {
+		var err error
+		if payload, err = cutLineTemplate(config, lineTemplateOf(config, config.Format), payload, podSeq, erred); err != nil {
+			return err
+		}
+	}
+
+	switch config.Format {
+	case formatJSON:
+		var message struct {
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}
+		if err := json.Unmarshal([]byte(payload), &message); err != nil {
+			return fmt.Errorf("not valid JSON")
+		}
+		wantLevel := "info"
+		if erred {
+			wantLevel = "error"
+		}
+		if message.Level != wantLevel {
+			return fmt.Errorf("level %q, want %q", message.Level, wantLevel)
+		}
+		if len(config.FakeFields) > 0 {
+			var fields map[string]any
+			if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+				return fmt.Errorf("not valid JSON")
+			}
+			if err := checkFakeFields(fields, config.FakeFields); err != nil {
+				return err
+			}
+		}
+		if config.EmissionTimestamps {
+			if err := checkEmissionTimestamp(message.Msg); err != nil {
+				return err
+			}
+			message.Msg = message.Msg[emissionTimestampBytes:]
+		}
+		if config.SequenceNumbers {
+			if err := checkSequenceMarker(message.Msg, podSeq); err != nil {
+				return err
+			}
+			_, message.Msg, _ = parseSequenceMarker(message.Msg)
+		}
+		if config.TraceIDs != nil {
+			var err error
+			if message.Msg, err = cutTraceMarker(message.Msg); err != nil {
+				return err
+			}
+		}
+		if config.RequestFlows != nil {
+			var err error
+			if message.Msg, err = config.RequestFlows.cutRequestMarker(message.Msg, config.requestFlowSeed); err != nil {
+				return err
+			}
+		}
+		if erred {
+			var err error
+			if message.Msg, err = cutErrorMarker(message.Msg); err != nil {
+				return err
+			}
+		}
+		if config.Anomalies != nil && config.Anomalies.anomalous(0, podSeq) {
+			var err error
+			if message.Msg, err = cutAnomalyMarker(message.Msg, config.Anomalies.patternAt(0, podSeq)); err != nil {
+				return err
+			}
+		}
+		if config.ANSIColors {
+			if _, err := cutANSIColor(message.Msg); err != nil {
+				return err
+			}
+		}
+	default:
+		if config.EmissionTimestamps {
+			if err := checkEmissionTimestamp(payload); err != nil {
+				return err
+			}
+			payload = payload[emissionTimestampBytes:]
+		}
+		if config.SequenceNumbers {
+			if err := checkSequenceMarker(payload, podSeq); err != nil {
+				return err
+			}
+			_, payload, _ = parseSequenceMarker(payload)
+		}
+		if config.TraceIDs != nil {
+			var err error
+			if payload, err = cutTraceMarker(payload); err != nil {
+				return err
+			}
+		}
+		if config.RequestFlows != nil {
+			var err error
+			if payload, err = config.RequestFlows.cutRequestMarker(payload, config.requestFlowSeed); err != nil {
+				return err
+			}
+		}
+		if erred {
+			var err error
+			if payload, err = cutErrorMarker(payload); err != nil {
+				return err
+			}
+		}
+		if config.Anomalies != nil && config.Anomalies.anomalous(0, podSeq) {
+			var err error
+			if payload, err = cutAnomalyMarker(payload, config.Anomalies.patternAt(0, podSeq)); err != nil {
+				return err
+			}
+		}
+		if config.ANSIColors {
+			var err error
+			if payload, err = cutANSIColor(payload); err != nil {
+				return err
+			}
+		}
+		if err := checkPayload(config, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// selfCheckErred reports whether line seq of the self-check pod, which takes
+// part in the incident of config, if any, is an error line.
+func selfCheckErred(config Config, seq int) bool {
+	return len(config.Incidents) > 0 && spreadSelected(seq, config.Incidents[0].ErrorPercent)
+}
+
+// checkEmissionTimestamp verifies that message starts with the emission
+// timestamp of a line printed within the self-check.
+func checkEmissionTimestamp(message string) error {
+	if len(message) < emissionTimestampBytes || !strings.HasPrefix(message, emissionTimestampKey) {
+		return fmt.Errorf("no emission timestamp")
+	}
+	emitted, ok := parseEmissionTimestamp(message[:emissionTimestampBytes])
+	if !ok {
+		return fmt.Errorf("no emission timestamp, the date of the image may not support %%N")
+	}
+	if age := time.Since(emitted); age < 0 || age > selfCheckTimeout {
+		return fmt.Errorf("emission timestamp %s is not the time of the line", emitted.UTC().Format(time.RFC3339Nano))
+	}
+
+	return nil
+}
+
+// checkSequenceMarker verifies that message starts with the marker of line
+// seq of the self-check pod.
+func checkSequenceMarker(message string, seq int) error {
+	got, _, err := parseSequenceMarker(message)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(message, sequenceMarker(selfCheckPodName, seq)) {
+		return fmt.Errorf("sequence marker of line %d, want line %d of pod %s", got, seq, selfCheckPodName)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxPodNameBytes is the length of the longest pod name a run gives, with a
+// ten-digit index.
+const maxPodNameBytes = len("logger-pod-") + 10
+
+// sequenceMarker returns the prefix of line seq of pod podName with
+// sequence_numbers.
+func sequenceMarker(podName string, seq int) string {
+	return fmt.Sprintf("pod=%s seq=%d ", podName, seq)
+}
+
+// markerArg returns the argument of emit_line passing the markers of the
+// line numbered by the shell expression seq: its emission timestamp with
+// emission_timestamps, then its sequence marker with sequence_numbers. It
+// returns nothing without either. Pods print their name from $HOSTNAME,
+// which the kubelet sets to the pod name.
+func markerArg(config Config, seq string) string {
+	marker := ""
+	if config.EmissionTimestamps {
+		marker += emissionTimestampMarker
+	}
+	if config.SequenceNumbers {
+		marker += fmt.Sprintf("pod=$HOSTNAME seq=%s ", seq)
+	}
+	if marker == "" {
+		return ""
+	}
+
+	return ` "` + marker + `"`
+}
+
+// linenoCommand returns the shell command setting $lineno to the number of
+// the next line in its pod, the shell expression seq, ahead of emit_line, for
+// {{.Seq}}, status and anomalies. It returns nothing when none is used.
+func linenoCommand(config Config, seq string) string {
+	if !usesLineTemplates(config) && config.Anomalies == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("lineno=%s; ", seq)
+}
+
+// parseSequenceMarker splits the marker off line and returns the sequence
+// number in it.
+func parseSequenceMarker(line string) (seq int, rest string, err error) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 || !strings.HasPrefix(fields[0], "pod=") || !strings.HasPrefix(fields[1], "seq=") {
+		return 0, "", fmt.Errorf("no sequence marker")
+	}
+
+	seq, err = strconv.Atoi(strings.TrimPrefix(fields[1], "seq="))
+	if err != nil {
+		return 0, "", fmt.Errorf("sequence number: %w", err)
+	}
+
+	return seq, fields[2], nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+)
+
+const (
+	sidecarContainerName = "log-tailer"
+	sidecarVolumeName    = "app-logs"
+	sidecarMountPath     = "/var/log/app"
+	sidecarLogFile       = sidecarMountPath + "/app.log"
+
+	// sidecarDoneFile is created once the logger has written its last line,
+	// so the tailer knows when to stop.
+	sidecarDoneFile = sidecarMountPath + "/done"
+)
+
+// sidecarScript wraps script so that its lines go to the log file the
+// tailer streams instead of standard output.
+func sidecarScript(script string) string {
+	return fmt.Sprintf("{ %s; } >> %s; touch %s", script, sidecarLogFile, sidecarDoneFile)
+}
+
+// sidecarTailerScript follows the log file from its first line and stops
+// once the logger is done. tail re-reads the file every second, so the
+// two-second wait lets it print the last lines before it is killed.
+const sidecarTailerScript = `touch ` + sidecarLogFile + `; tail -n +1 -f ` + sidecarLogFile + ` & tailer=$!; until [ -f ` + sidecarDoneFile + ` ]; do sleep 1; done; sleep 2; kill $tailer`
+
+// addSidecarTailer mounts the log volume into the logger container of
+// podSpec and adds the tailer streaming its log file to standard output.
+func addSidecarTailer(podSpec *v1.PodSpec) {
+	mount := v1.VolumeMount{Name: sidecarVolumeName, MountPath: sidecarMountPath}
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: sidecarVolumeName,
+		VolumeSource: v1.VolumeSource{
+			EmptyDir: &v1.EmptyDirVolumeSource{},
+		},
+	})
+
+	logger := &podSpec.Containers[0]
+	logger.VolumeMounts = append(logger.VolumeMounts, mount)
+
+	podSpec.Containers = append(podSpec.Containers, v1.Container{
+		Name:            sidecarContainerName,
+		Image:           logger.Image,
+		ImagePullPolicy: logger.ImagePullPolicy,
+		Command:         []string{"sh", "-c", sidecarTailerScript},
+		VolumeMounts:    []v1.VolumeMount{mount},
+		SecurityContext: logger.SecurityContext,
+		Resources:       logger.Resources,
+	})
+}
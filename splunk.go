@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// splunkClient runs searches through the REST API of Splunk. The credentials
+// are only ever sent in the headers of the requests.
+type splunkClient struct {
+	addr     string
+	index    string
+	username string
+	password string
+	token    string
+	client   *http.Client
+}
+
+// splunkFlags are the flags of the commands reading from Splunk.
+type splunkFlags struct {
+	addr           string
+	index          string
+	username       string
+	passwordFrom   string
+	tokenFrom      string
+	runIDField     string
+	namespaceField string
+	podField       string
+}
+
+func (f *splunkFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.addr, "addr", "", "address of the REST API of Splunk, such as https://splunk.logging:8089")
+	fs.StringVar(&f.index, "index", "main", "index holding the events")
+	fs.StringVar(&f.username, "username", "", "user name for basic authentication")
+	fs.StringVar(&f.passwordFrom, "password-from", "", "password for basic authentication: env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY")
+	fs.StringVar(&f.tokenFrom, "token-from", "", "authentication token: env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY")
+	fs.StringVar(&f.runIDField, "run-id-field", "k8s.pod.labels.k8s-pod-log-generator/run-id", "field holding the run-id label of the pod")
+	fs.StringVar(&f.namespaceField, "namespace-field", "k8s.namespace.name", "field holding the namespace")
+	fs.StringVar(&f.podField, "pod-field", "k8s.pod.name", "field holding the pod name")
+}
+
+// check returns the problem with the flags, if any.
+func (f *splunkFlags) check() error {
+	if f.addr == "" {
+		return fmt.Errorf("--addr is required")
+	}
+	if f.passwordFrom != "" && f.tokenFrom != "" {
+		return fmt.Errorf("--password-from and --token-from cannot be used together")
+	}
+	return nil
+}
+
+// credentialRefs returns the credentials the flags refer to.
+func (f *splunkFlags) credentialRefs() []string {
+	return []string{f.passwordFrom, f.tokenFrom}
+}
+
+// client returns the client of the flags, reading Secrets with clientset.
+func (f *splunkFlags) client(clientset *kubernetes.Clientset) *splunkClient {
+	client := &splunkClient{addr: f.addr, index: f.index, username: f.username, client: &http.Client{}}
+
+	var err error
+	if f.passwordFrom != "" {
+		if client.password, err = readCredential(f.passwordFrom, clientset); err != nil {
+			fatal("Failed to read the Splunk password", "error", err)
+		}
+	}
+	if f.tokenFrom != "" {
+		if client.token, err = readCredential(f.tokenFrom, clientset); err != nil {
+			fatal("Failed to read the Splunk token", "error", err)
+		}
+	}
+
+	return client
+}
+
+// runEvents returns the search of the events of the index since the given
+// time whose runIDField is runID, with the fields renamed to run_id,
+// namespace and pod, which may hold characters the search language does not
+// take in field names.
+func (f *splunkFlags) runEvents(runID string, since time.Time) string {
+	return fmt.Sprintf(`search index=%q earliest=%d | rename %q AS run_id, %q AS namespace, %q AS pod | search run_id=%q`,
+		f.index, since.Unix(), f.runIDField, f.namespaceField, f.podField, runID)
+}
+
+// export runs search and returns its results, streamed by the export
+// endpoint as one JSON object per line.
+func (c *splunkClient) export(ctx context.Context, search string) ([]map[string]interface{}, error) {
+	form := url.Values{}
+	form.Set("search", search)
+	form.Set("output_mode", "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.addr, "/")+"/services/search/jobs/export", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("search: %w", responseError(resp, body))
+	}
+
+	var results []map[string]interface{}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var row struct {
+			Preview  bool                   `json:"preview"`
+			Result   map[string]interface{} `json:"result"`
+			Messages []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"messages"`
+		}
+		if err := decoder.Decode(&row); err == io.EOF {
+			return results, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("search: %w", err)
+		}
+
+		for _, message := range row.Messages {
+			if message.Type == "FATAL" || message.Type == "ERROR" {
+				return nil, fmt.Errorf("search: %s", message.Text)
+			}
+		}
+		if row.Result != nil && !row.Preview {
+			results = append(results, row.Result)
+		}
+	}
+}
+
+// countLines returns the number of events per pod of the search, run
+// through queries.
+func (c *splunkClient) countLines(ctx context.Context, queries *backendQueries, events string) (map[podRef]int64, error) {
+	var results []map[string]interface{}
+	err := queries.do(ctx, "search", func() (err error) {
+		results, err = c.export(ctx, events+" | stats count by namespace, pod")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[podRef]int64)
+	for _, result := range results {
+		namespace, _ := result["namespace"].(string)
+		pod, _ := result["pod"].(string)
+		value, _ := result["count"].(string)
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("search: count of pod %s/%s: %w", namespace, pod, err)
+		}
+		counts[podRef{Namespace: namespace, Name: pod}] += count
+	}
+
+	return counts, nil
+}
+
+// recentLines returns the raw text of the newest limit events of the search.
+func (c *splunkClient) recentLines(ctx context.Context, events string, limit int) ([]string, error) {
+	results, err := c.export(ctx, fmt.Sprintf("%s | head %d | fields _raw", events, limit))
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, result := range results {
+		if line, ok := result["_raw"].(string); ok {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// verifySplunk implements verify splunk.
+func verifySplunk(configFile string, args []string) int {
+	var options verifyOptions
+	var splunk splunkFlags
+	fs := flag.NewFlagSet("verify splunk", flag.ContinueOnError)
+	options.register(fs)
+	splunk.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := splunk.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := options.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	clientsets, generated := verifyClusters(configFile, options.runID)
+	client := splunk.client(clientsets[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.timeout)
+	defer cancel()
+
+	received, err := client.countLines(ctx, newBackendQueries("Splunk", options), splunk.runEvents(options.runID, generated.since.Add(-verifyQueryMargin)))
+	if err != nil {
+		fatal("Failed to search Splunk", "addr", splunk.addr, "error", err)
+	}
+	slog.Debug("Searched Splunk", "index", splunk.index, "pods", len(received))
+
+	return reportVerification("Splunk", compareLines(generated, received), options)
+}
+
+// latencySplunk implements latency splunk.
+func latencySplunk(configFile string, args []string) int {
+	var options latencyOptions
+	var splunk splunkFlags
+	fs := flag.NewFlagSet("latency splunk", flag.ContinueOnError)
+	options.register(fs)
+	splunk.register(fs)
+	runID := fs.String("run-id", "", "ID of the run to sample, as logged when it started")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := splunk.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *runID == "" {
+		fmt.Fprintln(os.Stderr, "--run-id is required")
+		return 2
+	}
+
+	config := loadConfig(configFile)
+	client := splunk.client(secretClient(config, splunk.credentialRefs()))
+
+	return measureLatency("Splunk", options, func(ctx context.Context, since time.Time) ([]string, error) {
+		return client.recentLines(ctx, splunk.runEvents(*runID, since), options.samples)
+	})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// stateVersion is the version of the state file format. Bump it on every
+// change of runState; older versions this binary can still resume must stay
+// at or above minResumableStateVersion.
+const stateVersion = 1
+
+// minResumableStateVersion is the oldest state file version this binary can
+// resume. Raise it when a change makes older runs impossible to continue,
+// such as a change of pod naming or labels.
+const minResumableStateVersion = 1
+
+// runState is the content of state_file.
+type runState struct {
+	Version          int    `json:"version"`
+	GeneratorVersion string `json:"generator_version"`
+	RunID            string `json:"run_id"`
+	Completed        bool   `json:"completed"`
+
+	// The settings that shape the pods and namespaces of the run. A run
+	// cannot be resumed with different values.
+	LinesPerPod      int    `json:"lines_per_pod"`
+	BytesPerLogLine  int    `json:"bytes_per_log_line"`
+	NumK8sNamespaces int    `json:"num_k8s_namespaces"`
+	NamespacePrefix  string `json:"namespace_prefix"`
+
+	Clusters map[string]clusterState `json:"clusters"`
+}
+
+type clusterState struct {
+	StartTime    time.Time `json:"start_time"`
+	NextPodIndex int       `json:"next_pod_index"`
+}
+
+// stateSaveInterval is how often the progress of a running cluster is saved.
+const stateSaveInterval = 1 * time.Second
+
+// stateFile persists the progress of a run so that it can be resumed, also by
+// a newer version of the generator. A nil *stateFile records nothing.
+type stateFile struct {
+	path    string
+	mu      sync.Mutex
+	state   runState
+	resumed bool
+}
+
+// generatorVersion returns the module version of the running binary, or
+// "(devel)" when built from a checkout.
+func generatorVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+
+	return info.Main.Version
+}
+
+// openState resumes the run recorded in path, or starts recording a new run
+// with runID if path does not exist or holds a completed run. It returns an
+// error if the recorded run cannot be resumed by this binary or with this
+// configuration.
+func openState(path string, config Config, linesPerPod int, runID string) (*stateFile, error) {
+	current := runState{
+		Version:          stateVersion,
+		GeneratorVersion: generatorVersion(),
+		RunID:            runID,
+		LinesPerPod:      linesPerPod,
+		BytesPerLogLine:  int(config.BytesPerLogLine),
+		NumK8sNamespaces: config.NumK8sNamespaces,
+		NamespacePrefix:  config.NamespacePrefix,
+		Clusters:         make(map[string]clusterState),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &stateFile{path: path, state: current}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved runState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if saved.Completed {
+		return &stateFile{path: path, state: current}, nil
+	}
+
+	if saved.Version > stateVersion {
+		return nil, fmt.Errorf("%s: state version %d was written by generator %s, which is newer than this one (state version %d)", path, saved.Version, saved.GeneratorVersion, stateVersion)
+	}
+	if saved.Version < minResumableStateVersion {
+		return nil, fmt.Errorf("%s: state version %d was written by generator %s, and this generator cannot resume runs older than state version %d; delete the namespaces and the state file to start over", path, saved.Version, saved.GeneratorVersion, minResumableStateVersion)
+	}
+
+	if saved.LinesPerPod != current.LinesPerPod || saved.BytesPerLogLine != current.BytesPerLogLine {
+		return nil, fmt.Errorf("%s: run %s was started with %d lines of %d bytes per pod, the configuration now gives %d lines of %d bytes", path, saved.RunID, saved.LinesPerPod, saved.BytesPerLogLine, current.LinesPerPod, current.BytesPerLogLine)
+	}
+	if saved.NumK8sNamespaces != current.NumK8sNamespaces || saved.NamespacePrefix != current.NamespacePrefix {
+		return nil, fmt.Errorf("%s: run %s was started with %d namespaces prefixed %s, the configuration now gives %d prefixed %s", path, saved.RunID, saved.NumK8sNamespaces, saved.NamespacePrefix, current.NumK8sNamespaces, current.NamespacePrefix)
+	}
+
+	slog.Info("Resuming run", "run_id", saved.RunID, "generator_version", saved.GeneratorVersion)
+
+	// Record the version that continues the run, so the next resumption
+	// is checked against it.
+	saved.Version = stateVersion
+	saved.GeneratorVersion = current.GeneratorVersion
+	if saved.Clusters == nil {
+		saved.Clusters = make(map[string]clusterState)
+	}
+
+	return &stateFile{path: path, state: saved, resumed: true}, nil
+}
+
+// runID returns the run ID of the recorded run.
+func (s *stateFile) runID() string {
+	return s.state.RunID
+}
+
+// cluster returns the recorded progress of the named cluster, and whether
+// the cluster is being resumed.
+func (s *stateFile) cluster(name string) (clusterState, bool) {
+	if s == nil {
+		return clusterState{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cs, ok := s.state.Clusters[name]
+	return cs, ok && s.resumed
+}
+
+// update records the progress of the named cluster.
+func (s *stateFile) update(name string, cs clusterState) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Clusters[name] = cs
+	s.save()
+}
+
+// complete records that the run finished, so the next start begins a new run.
+func (s *stateFile) complete() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Completed = true
+	s.save()
+}
+
+// save writes the state through a temporary file, so a crash never leaves a
+// truncated state file behind. The caller must hold s.mu.
+func (s *stateFile) save() {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		fatal("Failed to encode state", "error", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		fatal("Failed to write state file", "path", s.path, "error", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		fatal("Failed to write state file", "path", s.path, "error", err)
+	}
+	if err := tmp.Close(); err != nil {
+		fatal("Failed to write state file", "path", s.path, "error", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		fatal("Failed to write state file", "path", s.path, "error", err)
+	}
+}
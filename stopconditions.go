@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const stopConditionCheckInterval = 15 * time.Second
+
+// StopCondition halts pod creation for the rest of the run once the instant
+// query, run against Prometheus, exceeds the threshold, such as the
+// ingestion lag of Loki or the error rate of a collector.
+type StopCondition struct {
+	Name          string  `yaml:"name"`
+	PrometheusURL string  `yaml:"prometheus_url"`
+	TokenFrom     string  `yaml:"token_from"`
+	Query         string  `yaml:"query"`
+	Threshold     float64 `yaml:"threshold"`
+}
+
+// watchStopConditions checks conditions every stopConditionCheckInterval
+// until one exceeds its threshold, then sets halted and calls onHalt with its
+// name, or until stop is closed. A condition that cannot be queried is
+// skipped until the next check.
+func watchStopConditions(clientset *kubernetes.Clientset, conditions []StopCondition, halted *atomic.Bool, onHalt func(name string), stop <-chan struct{}) {
+	if len(conditions) == 0 {
+		return
+	}
+
+	tokens := make([]string, len(conditions))
+	for i, condition := range conditions {
+		if condition.TokenFrom == "" {
+			continue
+		}
+		var err error
+		if tokens[i], err = readCredential(condition.TokenFrom, clientset); err != nil {
+			fatal("Failed to read the token of a stop condition", "stop_condition", condition.Name, "error", err)
+		}
+	}
+
+	client := &http.Client{Timeout: closedLoopQueryTimeout}
+	ticker := time.NewTicker(stopConditionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		for i, condition := range conditions {
+			ctx, cancel := context.WithTimeout(context.Background(), closedLoopQueryTimeout)
+			value, err := queryPrometheus(ctx, client, condition.PrometheusURL, tokens[i], condition.Query)
+			cancel()
+			if err != nil {
+				slog.Warn("Failed to query a stop condition", "stop_condition", condition.Name, "error", err)
+				continue
+			}
+			slog.Debug("Checked a stop condition", "stop_condition", condition.Name, "value", value, "threshold", condition.Threshold)
+
+			if value > condition.Threshold {
+				halted.Store(true)
+				slog.Warn("Stop condition met, halting pod creation for the rest of the run", "stop_condition", condition.Name, "value", value, "threshold", condition.Threshold)
+				onHalt(condition.Name)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// generateStream runs the script of the logger pods locally with sh, one pod
+// after another, and writes their lines to w, so the content of a run can be
+// piped into any tool without a cluster. It stops after pods pods, or
+// without an error when the reader of w goes away. Restarts and freeze
+// windows need the pod around the script and are left out. The lines of
+// stderr_percent go to standard error, and the init container and the
+// logger_containers of a pod print one after another.
+func generateStream(config Config, totalLogLines, pods int, w io.Writer) error {
+	local := config
+	local.RestartsPerPod = 0
+	local.FreezeWindows = nil
+	local.SidecarTailer = false
+
+	var scripts []string
+	if config.InitContainerLines > 0 {
+		scripts = append(scripts, buildScript(initContainerConfig(local), config.InitContainerLines))
+	}
+	mainLines := totalLogLines - config.InitContainerLines
+	if len(config.LoggerContainers) == 0 {
+		local.sequenceOffset = config.InitContainerLines
+		scripts = append(scripts, buildScript(local, mainLines))
+	}
+	for i, container := range config.LoggerContainers {
+		lines, before := containerLines(mainLines, len(config.LoggerContainers), i)
+		containerLocal := containerConfig(local, container)
+		containerLocal.sequenceOffset = config.InitContainerLines + before
+		containerLocal.linesPerSecond = 0
+		scripts = append(scripts, buildScript(containerLocal, lines))
+	}
+
+	// The incidents are measured from the start of the stream.
+	runStart := fmt.Sprintf("%s=%d", runStartEnv, time.Now().Unix())
+	for i := 0; i < pods; i++ {
+		for _, script := range scripts {
+			cmd := exec.Command("sh", "-c", script)
+			// BSD tr refuses random bytes in a multibyte locale.
+			// The kubelet sets $HOSTNAME to the pod name.
+			cmd.Env = append(os.Environ(), "LC_ALL=C", fmt.Sprintf("HOSTNAME=logger-pod-%d", i+1), runStart)
+			cmd.Stdout = w
+			cmd.Stderr = os.Stderr
+
+			if err := cmd.Run(); err != nil {
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() && status.Signal() == syscall.SIGPIPE {
+						return nil
+					}
+				}
+				return fmt.Errorf("running the script of pod %d: %w", i+1, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zinrai/k8s-pod-log-generator/pkg/lifecycle"
+	"github.com/zinrai/k8s-pod-log-generator/pkg/plan"
+)
+
+// clusterSummary counts the pods created in each namespace of a cluster.
+type clusterSummary struct {
+	Name                    string         `json:"name,omitempty"`
+	PodsCreated             int            `json:"pods_created"`
+	PodsCreatedPerNamespace map[string]int `json:"pods_created_per_namespace"`
+
+	// PodsDisrupted counts the pods evicted, preempted or otherwise
+	// disrupted, by reason.
+	PodsDisrupted map[string]int `json:"pods_disrupted"`
+
+	// MaxSustainableLoad is the load discovered by closed_loop.
+	MaxSustainableLoad *sustainableLoad `json:"max_sustainable_load,omitempty"`
+
+	// HaltedBy is the name of the stop condition that halted pod creation.
+	HaltedBy string `json:"halted_by,omitempty"`
+
+	// NamespacesChurned counts the namespaces namespace_churn created and
+	// deleted again.
+	NamespacesChurned int `json:"namespaces_churned,omitempty"`
+
+	// PodsChurned counts the running pods churn_rate deleted.
+	PodsChurned int `json:"pods_churned,omitempty"`
+
+	mu         sync.Mutex
+	tracker    *podTracker
+	namespaces []string
+}
+
+func newClusterSummary(name string) *clusterSummary {
+	return &clusterSummary{Name: name, PodsCreatedPerNamespace: make(map[string]int), PodsDisrupted: make(map[string]int)}
+}
+
+// track makes the running pods of namespaces available to the dashboard.
+func (s *clusterSummary) track(tracker *podTracker, namespaces []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tracker = tracker
+	s.namespaces = namespaces
+}
+
+func (s *clusterSummary) createdPods() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.PodsCreated
+}
+
+// runningPerNamespace returns the running pods of every namespace, or nil
+// before the pods of the cluster are tracked.
+func (s *clusterSummary) runningPerNamespace() map[string]int {
+	s.mu.Lock()
+	tracker, namespaces := s.tracker, s.namespaces
+	s.mu.Unlock()
+
+	if tracker == nil {
+		return nil
+	}
+
+	running := make(map[string]int, len(namespaces))
+	for _, ns := range namespaces {
+		running[ns] = tracker.runningPods([]string{ns})
+	}
+	return running
+}
+
+func (s *clusterSummary) podCreated(namespace string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.PodsCreated++
+	s.PodsCreatedPerNamespace[namespace]++
+}
+
+// sustainableLoad is the highest load a step of the closed loop ran at
+// without the saturation signal reaching the threshold.
+type sustainableLoad struct {
+	RunningPods    int     `json:"running_pods"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	Saturated      bool    `json:"saturated"`
+}
+
+func (s *clusterSummary) setMaxSustainableLoad(load sustainableLoad) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.MaxSustainableLoad = &load
+}
+
+func (s *clusterSummary) podChurned() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.PodsChurned++
+}
+
+func (s *clusterSummary) namespaceChurned() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.NamespacesChurned++
+}
+
+func (s *clusterSummary) halt(stopCondition string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.HaltedBy = stopCondition
+}
+
+func (s *clusterSummary) podDisrupted(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.PodsDisrupted[reason]++
+}
+
+// runSummary is the machine-readable summary of a run written to
+// --report-out.
+type runSummary struct {
+	RunID            string            `json:"run_id"`
+	GeneratorVersion string            `json:"generator_version"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	StartTime        time.Time         `json:"start_time"`
+	EndTime          time.Time         `json:"end_time"`
+	DurationSeconds  float64           `json:"duration_seconds"`
+	State            lifecycle.State   `json:"state"`
+	Transitions      []lifecycle.Event `json:"transitions"`
+	PodsCreated      int               `json:"pods_created"`
+	LinesScheduled   int64             `json:"lines_scheduled"`
+	BytesScheduled   int64             `json:"bytes_scheduled"`
+
+	// MessageBytesScheduled leaves out the newlines of BytesScheduled, and
+	// DiskBytesScheduled is the most the lines take on the nodes.
+	MessageBytesScheduled int64 `json:"message_bytes_scheduled"`
+	DiskBytesScheduled    int64 `json:"disk_bytes_scheduled"`
+
+	Clusters []*clusterSummary          `json:"clusters"`
+	Errors   map[string]operationErrors `json:"errors"`
+}
+
+// writeSummary writes the summary of the run to path as JSON. It must be
+// called once the clusters have finished.
+func writeSummary(path string, summary runSummary, runPlan plan.Plan) error {
+	summary.GeneratorVersion = generatorVersion()
+	summary.DurationSeconds = summary.EndTime.Sub(summary.StartTime).Seconds()
+	for _, c := range summary.Clusters {
+		summary.PodsCreated += c.PodsCreated
+	}
+	summary.LinesScheduled = int64(summary.PodsCreated) * runPlan.LinesPerPod
+	summary.MessageBytesScheduled = int64(summary.PodsCreated) * runPlan.BytesPerPod
+	summary.BytesScheduled = summary.MessageBytesScheduled + summary.LinesScheduled*plan.NewlineBytes
+	if runPlan.LinesPerPod > 0 {
+		bytesPerLine := runPlan.BytesPerPod / runPlan.LinesPerPod
+		summary.DiskBytesScheduled = summary.LinesScheduled * plan.AccountDisk.LineBytes(bytesPerLine)
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
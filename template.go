@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const formatTemplate = "template"
+
+// lineTemplateMark delimits the variables in a rendered line template, as no
+// line holds it.
+const lineTemplateMark = "\x00"
+
+// lineTemplateValues holds, for every variable of line_template but the
+// fake values, the shell expression giving its value in the pod, the most
+// bytes of the value and the pattern matching it. Payload is left out: it
+// fills the line. The self-check knows the values of PodName, Seq and Status
+// and matches them exactly.
+var lineTemplateValues = map[string]struct {
+	expression string
+	bytes      int
+	pattern    string
+}{
+	"PodName":      {`$HOSTNAME`, maxPodNameBytes, ""},
+	"Seq":          {`$lineno`, 10, ""},
+	"RandomInt":    {`$(od -An -tu4 -N4 /dev/urandom | tr -d ' ')`, len("4294967295"), `[0-9]{1,10}`},
+	"Timestamp":    {`$(date -u +%Y-%m-%dT%H:%M:%SZ)`, len("2006-01-02T15:04:05Z"), `[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}Z`},
+	"CLFTimestamp": {`$(date -u '+%d/%b/%Y:%H:%M:%S +0000')`, len("02/Jan/2006:15:04:05 +0000"), `[0-9]{2}/[A-Z][a-z]{2}/[0-9]{4}:[0-9]{2}:[0-9]{2}:[0-9]{2} \+0000`},
+	"Method":       {`$(pick GET GET GET GET POST POST PUT DELETE)`, len("DELETE"), `(?:GET|POST|PUT|DELETE)`},
+	"Path":         {`/$(pick ` + shellWords(fakeURLPaths) + `)`, len("/") + longestWord(fakeURLPaths), `/[a-z0-9/]+`},
+	"Status":       {`$(status)`, 3, ""},
+	"Size":         {`$(od -An -tu2 -N2 /dev/urandom | tr -d ' ')`, len("65535"), `[0-9]{1,5}`},
+}
+
+// lineTemplateValue returns the shell expression giving the value of the
+// line_template variable name in the pod, the most bytes of the value and the
+// pattern matching it.
+func lineTemplateValue(name string) (expression string, bytes int, pattern string) {
+	if value, ok := fakeValueOf(name); ok {
+		return "$(fake_" + value.field + ")", value.bytes, value.pattern
+	}
+
+	value := lineTemplateValues[name]
+	return value.expression, value.bytes, value.pattern
+}
+
+// lineTemplateData are the variables of line_template. Rendering the
+// template with them leaves every variable as its name between two
+// lineTemplateMark, for the pod to fill in.
+type lineTemplateData struct {
+	PodName      string
+	Seq          string
+	RandomInt    string
+	Timestamp    string
+	CLFTimestamp string
+	Method       string
+	Path         string
+	Status       string
+	Size         string
+	IP           string
+	UserAgent    string
+	Email        string
+	UUID         string
+	URL          string
+	Payload      string
+}
+
+// templatedFormats are the formats printing a line template.
+var templatedFormats = []string{formatTemplate, formatCombined}
+
+// lineTemplateOf returns the line template printed by format, a templated
+// format.
+func lineTemplateOf(config Config, format string) string {
+	if format == formatCombined {
+		return combinedLogTemplate
+	}
+
+	return config.LineTemplate
+}
+
+// usesLineTemplates reports whether the run prints a templated format.
+func usesLineTemplates(config Config) bool {
+	for _, format := range formats(config) {
+		if slices.Contains(templatedFormats, format) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// renderLineTemplate renders text, a line template, and splits it around
+// the payload: before and after alternate literal text and variable names,
+// starting with literal text.
+func renderLineTemplate(text string) (before, after []string, err error) {
+	tmpl, err := template.New("line_template").Parse(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	mark := func(name string) string { return lineTemplateMark + name + lineTemplateMark }
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, lineTemplateData{
+		PodName:      mark("PodName"),
+		Seq:          mark("Seq"),
+		RandomInt:    mark("RandomInt"),
+		Timestamp:    mark("Timestamp"),
+		CLFTimestamp: mark("CLFTimestamp"),
+		Method:       mark("Method"),
+		Path:         mark("Path"),
+		Status:       mark("Status"),
+		Size:         mark("Size"),
+		IP:           mark("IP"),
+		UserAgent:    mark("UserAgent"),
+		Email:        mark("Email"),
+		UUID:         mark("UUID"),
+		URL:          mark("URL"),
+		Payload:      mark("Payload"),
+	}); err != nil {
+		return nil, nil, err
+	}
+	if strings.Contains(rendered.String(), "\n") {
+		return nil, nil, fmt.Errorf("it renders a newline, which would split the line")
+	}
+
+	parts := strings.Split(rendered.String(), lineTemplateMark)
+	for i := 1; i < len(parts); i += 2 {
+		if parts[i] != "Payload" {
+			continue
+		}
+		if before != nil {
+			return nil, nil, fmt.Errorf("it uses {{.Payload}} more than once")
+		}
+		before, after = parts[:i], parts[i+1:]
+	}
+	if before == nil {
+		return nil, nil, fmt.Errorf("it does not use {{.Payload}}, which fills the line up to bytes_per_log_line")
+	}
+
+	return before, after, nil
+}
+
+// lineTemplateBytes returns the most bytes the line template text adds
+// around the payload, or 0 if it does not render.
+func lineTemplateBytes(text string) int {
+	before, after, err := renderLineTemplate(text)
+	if err != nil {
+		return 0
+	}
+
+	bytes := 0
+	for _, parts := range [][]string{before, after} {
+		for i, part := range parts {
+			if i%2 == 0 {
+				bytes += len(part)
+			} else {
+				_, valueBytes, _ := lineTemplateValue(part)
+				bytes += valueBytes
+			}
+		}
+	}
+
+	return bytes
+}
+
+// shellLineTemplate returns parts as a double-quoted shell word, the
+// variables replaced by the expressions of their values.
+func shellLineTemplate(parts []string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	var word strings.Builder
+	for i, part := range parts {
+		if i%2 == 0 {
+			word.WriteString(escape.Replace(part))
+		} else {
+			expression, _, _ := lineTemplateValue(part)
+			word.WriteString(expression)
+		}
+	}
+
+	return `"` + word.String() + `"`
+}
+
+// templateFunction returns emit_<format>, which prints text, the line
+// template of format, with its variables filled in and the markers in $2 and
+// the payload in place of {{.Payload}}, sized so the line is $1 bytes.
+func templateFunction(format, text string) string {
+	// validateConfig rejects the templates that do not render.
+	before, after, _ := renderLineTemplate(text)
+
+	return fmt.Sprintf(`emit_%s() { before=%s; after=%s; printf '%%s%%s' "$before" "$2"; payload $(($1 - ${#before} - ${#2} - ${#after} - ${#sfx} - ${#cr})); printf '%%s%%s%%s' "$sfx" "$after" "$cr"; [ -n "$hold" ] || echo; }`,
+		format, shellLineTemplate(before), shellLineTemplate(after))
+}
+
+// cutLineTemplate verifies that line, the seq-th of the self-check pod and an
+// error line of an incident if erred, follows the line template text with the
+// status codes of config and returns what stands for {{.Payload}}.
+func cutLineTemplate(config Config, text, line string, seq int, erred bool) (string, error) {
+	before, after, err := renderLineTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	pattern := func(parts []string) string {
+		var expr strings.Builder
+		for i, part := range parts {
+			switch {
+			case i%2 == 0:
+				expr.WriteString(regexp.QuoteMeta(part))
+			case part == "PodName":
+				expr.WriteString(regexp.QuoteMeta(selfCheckPodName))
+			case part == "Seq":
+				expr.WriteString(strconv.Itoa(seq))
+			case part == "Status":
+				expr.WriteString(statusPattern(config.StatusCodes, seq, erred))
+			default:
+				_, _, valuePattern := lineTemplateValue(part)
+				expr.WriteString(valuePattern)
+			}
+		}
+		return expr.String()
+	}
+	expr := regexp.MustCompile(`^(?s)` + pattern(before) + `(?P<payload>.*)` + pattern(after) + `$`)
+	match := expr.FindStringSubmatch(line)
+	if match == nil {
+		return "", fmt.Errorf("does not follow the line template")
+	}
+
+	return match[expr.SubexpIndex("payload")], nil
+}
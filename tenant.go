@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// tenantName names the ServiceAccount, Role and RoleBinding of the synthetic
+// tenant created in every namespace with tenant_impersonation.
+const tenantName = "logger-tenant"
+
+// createTenant creates the synthetic tenant of namespace: a ServiceAccount
+// bound to a Role that only allows it to create pods in namespace.
+func createTenant(clientset *kubernetes.Clientset, namespace string) {
+	_, err := clientset.CoreV1().ServiceAccounts(namespace).Create(context.TODO(), &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: tenantName,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		fatal("Failed to create the tenant ServiceAccount", "namespace", namespace, "error", err)
+	}
+
+	_, err = clientset.RbacV1().Roles(namespace).Create(context.TODO(), &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: tenantName,
+		},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"create"},
+		}},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		fatal("Failed to create the tenant Role", "namespace", namespace, "error", err)
+	}
+
+	_, err = clientset.RbacV1().RoleBindings(namespace).Create(context.TODO(), &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: tenantName,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      tenantName,
+			Namespace: namespace,
+		}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     tenantName,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		fatal("Failed to create the tenant RoleBinding", "namespace", namespace, "error", err)
+	}
+
+	slog.Info("Tenant created", "namespace", namespace, "service_account", tenantName)
+}
+
+// tenantClients returns a client for every namespace that impersonates the
+// tenant ServiceAccount of the namespace, so the API server authorizes,
+// admits and audits the pods of each namespace as created by a distinct
+// tenant.
+func tenantClients(restConfig *rest.Config, namespaces []string) (map[string]*kubernetes.Clientset, error) {
+	clients := make(map[string]*kubernetes.Clientset, len(namespaces))
+	for _, ns := range namespaces {
+		config := rest.CopyConfig(restConfig)
+		config.Impersonate = rest.ImpersonationConfig{
+			UserName: fmt.Sprintf("system:serviceaccount:%s:%s", ns, tenantName),
+		}
+
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", ns, err)
+		}
+		clients[ns] = clientset
+	}
+
+	return clients, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// timelineMinute compares what a cluster was planned to run during one
+// minute of the run with what it actually did.
+type timelineMinute struct {
+	Minute int `json:"minute"`
+
+	PlannedRunningPods int   `json:"planned_running_pods"`
+	PlannedBytes       int64 `json:"planned_bytes"`
+
+	// ActualRunningPods is the highest number of running pods seen during
+	// the minute.
+	ActualRunningPods int   `json:"actual_running_pods"`
+	PodsCreated       int   `json:"pods_created"`
+	BytesCreated      int64 `json:"bytes_created"`
+}
+
+// clusterTimeline records the timeline of a cluster minute by minute from
+// the start of the run. The bytes of a pod are accounted for in full in the
+// minute it is created.
+type clusterTimeline struct {
+	Name    string           `json:"name,omitempty"`
+	Minutes []timelineMinute `json:"minutes"`
+
+	mu          sync.Mutex
+	startTime   time.Time
+	bytesPerPod int64
+}
+
+func newClusterTimeline(name string, runDurationMinutes int, bytesPerPod int64) *clusterTimeline {
+	t := &clusterTimeline{
+		Name:        name,
+		Minutes:     make([]timelineMinute, runDurationMinutes),
+		bytesPerPod: bytesPerPod,
+	}
+	for i := range t.Minutes {
+		t.Minutes[i].Minute = i
+	}
+
+	return t
+}
+
+// plan records the pods the groups keep running in every minute, counting
+// from startTime.
+func (t *clusterTimeline) plan(groups []namespaceGroup, startTime time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.startTime = startTime
+	for i := range t.Minutes {
+		minuteStart := startTime.Add(time.Duration(i) * time.Minute)
+		for _, group := range groups {
+			if !minuteStart.Before(group.startTime) && minuteStart.Before(group.stopTime) {
+				t.Minutes[i].PlannedRunningPods += group.totalPods
+			}
+		}
+		t.Minutes[i].PlannedBytes = int64(t.Minutes[i].PlannedRunningPods) * t.bytesPerPod
+	}
+}
+
+// minute returns the minute of now, or nil outside of the run.
+func (t *clusterTimeline) minute(now time.Time) *timelineMinute {
+	i := int(now.Sub(t.startTime) / time.Minute)
+	if t.startTime.IsZero() || i < 0 || i >= len(t.Minutes) {
+		return nil
+	}
+
+	return &t.Minutes[i]
+}
+
+func (t *clusterTimeline) podCreated(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if m := t.minute(now); m != nil {
+		m.PodsCreated++
+		m.BytesCreated += t.bytesPerPod
+	}
+}
+
+func (t *clusterTimeline) runningPods(now time.Time, running int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if m := t.minute(now); m != nil && running > m.ActualRunningPods {
+		m.ActualRunningPods = running
+	}
+}
+
+// writeTimeline writes the timelines of the clusters of the run to path as
+// JSON, for plotting the planned shape of the run against the actual one.
+// It must be called once the clusters have finished.
+func writeTimeline(path, runID string, tags map[string]string, bytesPerPod int64, timelines []*clusterTimeline) error {
+	data, err := json.MarshalIndent(struct {
+		RunID       string             `json:"run_id"`
+		Tags        map[string]string  `json:"tags,omitempty"`
+		BytesPerPod int64              `json:"bytes_per_pod"`
+		Clusters    []*clusterTimeline `json:"clusters"`
+	}{runID, tags, bytesPerPod, timelines}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	timestampRFC3339     = "rfc3339"
+	timestampEpochMillis = "epoch-millis"
+	timestampCLF         = "clf"
+)
+
+// timestampLayouts are the strftime formats of date and the Go layouts of
+// the named layouts of timestamp_prefix but epoch-millis, in UTC.
+var timestampLayouts = map[string]struct{ strftime, layout string }{
+	timestampRFC3339: {"%Y-%m-%dT%H:%M:%SZ", "2006-01-02T15:04:05Z"},
+	timestampCLF:     {"[%d/%b/%Y:%H:%M:%S +0000]", "[02/Jan/2006:15:04:05 +0000]"},
+}
+
+// epochMillisBytes is the length of a Unix time in milliseconds, thirteen
+// digits until the year 2286.
+const epochMillisBytes = len("1700000000000")
+
+// TimestampPrefix starts every line with the time it is printed, in a named
+// layout or a custom strftime format, so the timestamp parsing of the
+// pipeline is exercised.
+type TimestampPrefix struct {
+	Layout            string `yaml:"layout"`
+	Strftime          string `yaml:"strftime"`
+	OutOfOrderPercent int    `yaml:"out_of_order_percent"`
+	OutOfOrderSeconds int    `yaml:"out_of_order_seconds"`
+	ClockSkewSeconds  int    `yaml:"clock_skew_seconds"`
+}
+
+// clockSkewMultiplier scatters the clock skews of consecutive pods over the
+// range of clock_skew_seconds.
+const clockSkewMultiplier = 2654435761
+
+// clockSkewSeconds returns the constant offset of the clock of the pod
+// numbered podNumber, between -ClockSkewSeconds and ClockSkewSeconds.
+func (t *TimestampPrefix) clockSkewSeconds(podNumber int) int {
+	if t == nil || t.ClockSkewSeconds == 0 {
+		return 0
+	}
+
+	return int(uint64(podNumber)*clockSkewMultiplier%uint64(2*t.ClockSkewSeconds+1)) - t.ClockSkewSeconds
+}
+
+// skewCommand returns the shell command setting $skewms to the
+// clockSkewSeconds of the pod, in milliseconds, from the number ending its
+// name in $HOSTNAME.
+func (t *TimestampPrefix) skewCommand() string {
+	return fmt.Sprintf(`skewms=$(((${HOSTNAME##*-} * %d %% %d - %d) * 1000))`, clockSkewMultiplier, 2*t.ClockSkewSeconds+1, t.ClockSkewSeconds)
+}
+
+// prefixBytes returns the length of the prefix, the timestamp and a space,
+// or 0 if it depends on a custom format.
+func (t *TimestampPrefix) prefixBytes() int {
+	switch t.Layout {
+	case timestampEpochMillis:
+		return epochMillisBytes + 1
+	case timestampRFC3339, timestampCLF:
+		return len(timestampLayouts[t.Layout].layout) + 1
+	}
+
+	return 0
+}
+
+// clockCommand returns the shell command setting $tsms to the time of the
+// line in Unix milliseconds: the current time on the clock of the pod,
+// skewed by $skewms with ClockSkewSeconds, or for OutOfOrderPercent
+// percent of the lines, spread evenly over the lines of the pod, the time of
+// the line before minus OutOfOrderSeconds.
+func (t *TimestampPrefix) clockCommand() string {
+	clock := `tsms=$(($(date +%s%N) / 1000000))`
+	if t.ClockSkewSeconds > 0 {
+		clock = `tsms=$(($(date +%s%N) / 1000000 + skewms))`
+	}
+	if t.OutOfOrderPercent > 0 {
+		clock += fmt.Sprintf(`; disorders=$((disorders + 1)); if %s; then tsms=$((${prevms:-$tsms} - %d)); fi; prevms=$tsms`,
+			spreadCondition("disorders", t.OutOfOrderPercent), t.OutOfOrderSeconds*1000)
+	}
+
+	return clock
+}
+
+// prefixCommand returns the shell command printing the prefix of the line
+// printed at the Unix time in milliseconds in $tsms, and taking its bytes
+// off the $1 bytes of the line.
+func (t *TimestampPrefix) prefixCommand() string {
+	ts := `ts=$tsms`
+	if t.Layout != timestampEpochMillis {
+		ts = fmt.Sprintf(`ts=$(date -u -d "@$((tsms / 1000))" '+%s')`, t.strftime())
+	}
+
+	return ts + `; printf '%s ' "$ts"; set -- $(($1 - ${#ts} - 1)) "$2"`
+}
+
+// strftime returns the strftime format of date printing the timestamp.
+func (t *TimestampPrefix) strftime() string {
+	if t.Strftime != "" {
+		return t.Strftime
+	}
+
+	return timestampLayouts[t.Layout].strftime
+}
+
+// cutTimestamp verifies that line starts with the prefix of a line printed
+// within the self-check, or as far before as the out of order lines of the
+// self-check go, and returns the rest. With a custom format, only the space
+// ending the prefix of prefixBytes bytes is checked.
+func (t *TimestampPrefix) cutTimestamp(line string, prefixBytes int) (string, error) {
+	if len(line) < prefixBytes || line[prefixBytes-1] != ' ' {
+		return "", fmt.Errorf("no timestamp prefix")
+	}
+	timestamp := line[:prefixBytes-1]
+
+	var printed time.Time
+	switch t.Layout {
+	case "":
+		return line[prefixBytes:], nil
+	case timestampEpochMillis:
+		ms, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("timestamp prefix %q: %w", timestamp, err)
+		}
+		printed = time.UnixMilli(ms)
+	default:
+		var err error
+		if printed, err = time.Parse(timestampLayouts[t.Layout].layout, timestamp); err != nil {
+			return "", fmt.Errorf("timestamp prefix: %w", err)
+		}
+	}
+	// The name of the self-check pod ends with no number, so its clock is
+	// skewed as that of pod 0, ClockSkewSeconds behind.
+	maxAge := selfCheckTimeout + time.Duration(t.ClockSkewSeconds)*time.Second
+	if t.OutOfOrderPercent > 0 {
+		maxAge += time.Duration(t.OutOfOrderSeconds*selfCheckLines) * time.Second
+	}
+	if age := time.Since(printed); age < -time.Second || age > maxAge {
+		return "", fmt.Errorf("timestamp prefix %s is not the time of the line", timestamp)
+	}
+
+	return line[prefixBytes:], nil
+}
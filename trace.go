@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultLinesPerTrace = 10
+
+// traceMarkerBytes is the length of the "trace_id=<32 hex digits>
+// span_id=<16 hex digits> " marker of trace_ids.
+const traceMarkerBytes = len("trace_id=") + 32 + len(" span_id=") + 16 + 1
+
+// TraceIDs starts the message of every line with a W3C trace ID and span ID
+// shared by bursts of consecutive lines, so the correlation of logs with
+// traces can be tested.
+type TraceIDs struct {
+	LinesPerTrace int `yaml:"lines_per_trace"`
+	LinesPerSpan  int `yaml:"lines_per_span"`
+}
+
+// markerCommand returns the shell command appending the trace marker of the
+// line to the markers in $2, drawing a new trace ID every LinesPerTrace
+// lines and a new span ID every LinesPerSpan lines.
+func (t *TraceIDs) markerCommand() string {
+	return fmt.Sprintf(`traced=$((traced + 1)); if [ $(((traced - 1) %% %d)) -eq 0 ]; then trace=$(od -An -tx1 -N16 /dev/urandom | tr -d ' \n'); fi; if [ $(((traced - 1) %% %d)) -eq 0 ]; then span=$(od -An -tx1 -N8 /dev/urandom | tr -d ' \n'); fi; set -- "$1" "${2}trace_id=$trace span_id=$span "`,
+		t.LinesPerTrace, t.LinesPerSpan)
+}
+
+// cutTraceMarker verifies that message starts with a trace marker and
+// returns the rest.
+func cutTraceMarker(message string) (string, error) {
+	traceID, rest, ok := strings.Cut(strings.TrimPrefix(message, "trace_id="), " ")
+	if !ok || !strings.HasPrefix(message, "trace_id=") || !isHex(traceID, 32) {
+		return "", fmt.Errorf("no trace ID")
+	}
+	spanID, rest, ok := strings.Cut(strings.TrimPrefix(rest, "span_id="), " ")
+	if !ok || !isHex(spanID, 16) {
+		return "", fmt.Errorf("no span ID")
+	}
+
+	return rest, nil
+}
+
+// isHex reports whether s is n lowercase hexadecimal digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteUnits are the units a ByteSize can be written in.
+var byteUnits = map[string]float64{
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// ByteSize is a number of bytes, written in the config file either as an
+// integer or as a number with a unit, such as 512B, 1.5KiB or 10GiB.
+type ByteSize int
+
+func (s *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var n int
+	if err := unmarshal(&n); err == nil {
+		*s = ByteSize(n)
+		return nil
+	}
+
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+
+	size, err := parseByteSize(text)
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
+
+func parseByteSize(text string) (ByteSize, error) {
+	text = strings.TrimSpace(text)
+	i := strings.IndexFunc(text, func(r rune) bool {
+		return !('0' <= r && r <= '9' || r == '.')
+	})
+	if i <= 0 {
+		return 0, fmt.Errorf("invalid size %q: want a number followed by B, KB, MB, GB, TB, KiB, MiB, GiB or TiB", text)
+	}
+
+	value, err := strconv.ParseFloat(text[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", text, err)
+	}
+	unit, ok := byteUnits[strings.TrimSpace(text[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q, want B, KB, MB, GB, TB, KiB, MiB, GiB or TiB", text, strings.TrimSpace(text[i:]))
+	}
+
+	bytes := math.Ceil(value * unit)
+	if bytes > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", text)
+	}
+	return ByteSize(bytes), nil
+}
+
+// Duration is a duration written in the config file as in Go, such as 90m
+// or 1h30m.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: want a number with a unit, such as 90m or 1h30m", text)
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// ceilUnits returns n in units of unit, rounded up.
+func ceilUnits(n, unit int64) int {
+	return int((n + unit - 1) / unit)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// exitVerificationFailed is the exit code of verify when the backend lost or
+// duplicated more lines than tolerated, the same as failed expectations.
+const exitVerificationFailed = exitExpectationsFailed
+
+// verifyQueryMargin widens the range queried before the creation of the
+// first pod, for clock differences between the cluster and the backend.
+const verifyQueryMargin = time.Minute
+
+// maxVerifyMismatches is the number of pods with a wrong line count listed.
+const maxVerifyMismatches = 10
+
+// podRef identifies a pod in the log backend, which knows pods by
+// namespace and name.
+type podRef struct {
+	Namespace string
+	Name      string
+}
+
+func (p podRef) String() string {
+	return p.Namespace + "/" + p.Name
+}
+
+// generatedPods are the completed logger pods of a run.
+type generatedPods struct {
+	// lines is the number of lines every completed pod printed. Pods of
+	// different clusters with the same namespace and name are summed, as
+	// the backend may not tell them apart.
+	lines map[podRef]int64
+
+	// namespaces are those of the completed pods, and since the creation
+	// of the first of them.
+	namespaces []string
+	since      time.Time
+
+	// skipped is the number of pods that have not succeeded and are left
+	// out, as their output is not final.
+	skipped int
+}
+
+// listGeneratedPods reads the lines the pods of runID printed from their
+// total_log_lines annotation in every cluster.
+func listGeneratedPods(clientsets []*kubernetes.Clientset, runID string) (generatedPods, error) {
+	generated := generatedPods{lines: make(map[podRef]int64)}
+	namespaces := make(map[string]bool)
+
+	selector := labels.SelectorFromSet(labels.Set{runIDLabel: runID}).String()
+	for _, clientset := range clientsets {
+		pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return generatedPods{}, fmt.Errorf("listing the pods of run %s: %w", runID, err)
+		}
+
+		for _, pod := range pods.Items {
+			if pod.Status.Phase != v1.PodSucceeded {
+				generated.skipped++
+				continue
+			}
+			lines, err := strconv.ParseInt(pod.Annotations[totalLogLinesAnnotation], 10, 64)
+			if err != nil {
+				return generatedPods{}, fmt.Errorf("pod %s/%s: annotation %s: %w", pod.Namespace, pod.Name, totalLogLinesAnnotation, err)
+			}
+
+			generated.lines[podRef{Namespace: pod.Namespace, Name: pod.Name}] += lines
+			namespaces[pod.Namespace] = true
+			if created := pod.CreationTimestamp.Time; generated.since.IsZero() || created.Before(generated.since) {
+				generated.since = created
+			}
+		}
+	}
+
+	for ns := range namespaces {
+		generated.namespaces = append(generated.namespaces, ns)
+	}
+	sort.Strings(generated.namespaces)
+
+	return generated, nil
+}
+
+// verifyResult compares the lines the pods printed with those the backend
+// holds.
+type verifyResult struct {
+	Pods            int
+	SkippedPods     int
+	PodsWithoutLogs int
+	ExpectedLines   int64
+	ReceivedLines   int64
+	LostLines       int64
+	DuplicatedLines int64
+
+	mismatches []podMismatch
+}
+
+type podMismatch struct {
+	pod      podRef
+	expected int64
+	received int64
+}
+
+// compareLines compares generated with the lines received per pod. Lines of
+// pods that are not in generated are ignored.
+func compareLines(generated generatedPods, received map[podRef]int64) verifyResult {
+	result := verifyResult{Pods: len(generated.lines), SkippedPods: generated.skipped}
+	for pod, expected := range generated.lines {
+		got := received[pod]
+		result.ExpectedLines += expected
+		result.ReceivedLines += got
+		if got == 0 {
+			result.PodsWithoutLogs++
+		}
+		if got < expected {
+			result.LostLines += expected - got
+		} else {
+			result.DuplicatedLines += got - expected
+		}
+		if got != expected {
+			result.mismatches = append(result.mismatches, podMismatch{pod: pod, expected: expected, received: got})
+		}
+	}
+
+	sort.Slice(result.mismatches, func(i, j int) bool {
+		di := abs(result.mismatches[i].received - result.mismatches[i].expected)
+		dj := abs(result.mismatches[j].received - result.mismatches[j].expected)
+		if di != dj {
+			return di > dj
+		}
+		return result.mismatches[i].pod.String() < result.mismatches[j].pod.String()
+	})
+
+	return result
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (r verifyResult) lostPercent() float64 {
+	return percentOf(r.LostLines, r.ExpectedLines)
+}
+
+func (r verifyResult) duplicatedPercent() float64 {
+	return percentOf(r.DuplicatedLines, r.ExpectedLines)
+}
+
+func percentOf(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// print writes the result to w, with the pods whose count is furthest off.
+func (r verifyResult) print(w io.Writer, backend string) {
+	fmt.Fprintf(w, "%s: %d completed pods", backend, r.Pods)
+	if r.SkippedPods > 0 {
+		fmt.Fprintf(w, ", %d not completed and left out", r.SkippedPods)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Expected %d lines, received %d\n", r.ExpectedLines, r.ReceivedLines)
+	fmt.Fprintf(w, "Lost %d lines (%.2f%%), duplicated %d lines (%.2f%%), %d pods without any line\n",
+		r.LostLines, r.lostPercent(), r.DuplicatedLines, r.duplicatedPercent(), r.PodsWithoutLogs)
+
+	for i, m := range r.mismatches {
+		if i == maxVerifyMismatches {
+			fmt.Fprintf(w, "  ... %d more pods\n", len(r.mismatches)-i)
+			break
+		}
+		fmt.Fprintf(w, "  %s: %d expected, %d received\n", m.pod, m.expected, m.received)
+	}
+}
+
+// verifyOptions are the flags common to every backend of verify.
+type verifyOptions struct {
+	runID               string
+	maxLossPercent      float64
+	maxDuplicatePercent float64
+	timeout             time.Duration
+	concurrency         int
+	qps                 float64
+}
+
+func (o *verifyOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.runID, "run-id", "", "ID of the run to verify, as logged when it started")
+	fs.Float64Var(&o.maxLossPercent, "max-loss-percent", 0, "percentage of lost lines tolerated")
+	fs.Float64Var(&o.maxDuplicatePercent, "max-duplicate-percent", 0, "percentage of duplicated lines tolerated")
+	fs.DurationVar(&o.timeout, "timeout", 5*time.Minute, "how long the queries to the backend may take in total")
+	fs.IntVar(&o.concurrency, "concurrency", defaultQueryConcurrency, "number of queries sent to the backend at once")
+	fs.Float64Var(&o.qps, "qps", defaultQueryQPS, "most queries sent to the backend per second, retries included")
+}
+
+// check returns the problem with the flags, if any.
+func (o *verifyOptions) check() error {
+	if o.runID == "" {
+		return fmt.Errorf("--run-id is required")
+	}
+	if o.concurrency < 1 || o.qps <= 0 {
+		return fmt.Errorf("--concurrency and --qps must be positive")
+	}
+	return nil
+}
+
+// verifyCommand implements verify: it compares the lines the completed pods
+// of a run printed with those a log backend holds, and exits with
+// exitVerificationFailed if more lines were lost or duplicated than
+// tolerated.
+func verifyCommand(configFile string, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "verify needs a backend: loki, elasticsearch, opensearch, splunk, victorialogs, kafka or pods-log")
+		return 2
+	}
+
+	switch args[0] {
+	case "loki":
+		return verifyLoki(configFile, args[1:])
+	case "elasticsearch":
+		return verifyElasticsearch(configFile, "Elasticsearch", args[1:])
+	case "opensearch":
+		return verifyElasticsearch(configFile, "OpenSearch", args[1:])
+	case "splunk":
+		return verifySplunk(configFile, args[1:])
+	case "victorialogs":
+		return verifyVictoriaLogs(configFile, args[1:])
+	case "kafka":
+		return verifyKafka(configFile, args[1:])
+	case "pods-log":
+		return verifyPodsLog(configFile, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown verify backend %q: must be loki, elasticsearch, opensearch, splunk, victorialogs, kafka or pods-log\n", args[0])
+		return 2
+	}
+}
+
+// configClientsets connects to the clusters of config.
+func configClientsets(config Config) []*kubernetes.Clientset {
+	clusterConfigs, _ := clusterPods(config, 0)
+
+	clientsets := make([]*kubernetes.Clientset, len(clusterConfigs))
+	for i, cc := range clusterConfigs {
+		_, clientsets[i] = connectCluster(config, cc)
+	}
+
+	return clientsets
+}
+
+// verifyClusters connects to the clusters of the configuration and lists
+// the completed pods of the run.
+func verifyClusters(configFile string, runID string) ([]*kubernetes.Clientset, generatedPods) {
+	clientsets := configClientsets(loadConfig(configFile))
+
+	generated, err := listGeneratedPods(clientsets, runID)
+	if err != nil {
+		fatal("Failed to list the pods of the run", "error", err)
+	}
+	if len(generated.lines) == 0 {
+		fatal("No completed pod of the run found", "run_id", runID, "skipped", generated.skipped)
+	}
+
+	return clientsets, generated
+}
+
+// reportVerification prints result and returns the exit code of verify.
+func reportVerification(backend string, result verifyResult, options verifyOptions) int {
+	result.print(os.Stdout, backend)
+	if result.lostPercent() > options.maxLossPercent || result.duplicatedPercent() > options.maxDuplicatePercent {
+		return exitVerificationFailed
+	}
+
+	return 0
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// victoriaLogsClient runs LogsQL queries through the HTTP API of
+// VictoriaLogs. The credentials are only ever sent in the headers of the
+// requests.
+type victoriaLogsClient struct {
+	addr      string
+	accountID string
+	projectID string
+	username  string
+	password  string
+	token     string
+	client    *http.Client
+}
+
+// victoriaLogsFlags are the flags of the commands reading from VictoriaLogs.
+type victoriaLogsFlags struct {
+	addr           string
+	accountID      string
+	projectID      string
+	username       string
+	passwordFrom   string
+	tokenFrom      string
+	runIDField     string
+	namespaceField string
+	podField       string
+}
+
+func (f *victoriaLogsFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.addr, "addr", "", "address of VictoriaLogs, such as http://victorialogs.logging:9428")
+	fs.StringVar(&f.accountID, "account-id", "", "tenant account sent as AccountID")
+	fs.StringVar(&f.projectID, "project-id", "", "tenant project sent as ProjectID")
+	fs.StringVar(&f.username, "username", "", "user name for basic authentication")
+	fs.StringVar(&f.passwordFrom, "password-from", "", "password for basic authentication: env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY")
+	fs.StringVar(&f.tokenFrom, "token-from", "", "bearer token: env:NAME, file:PATH or secret:NAMESPACE/NAME/KEY")
+	fs.StringVar(&f.runIDField, "run-id-field", "kubernetes.labels.k8s-pod-log-generator/run-id", "field holding the run-id label of the pod")
+	fs.StringVar(&f.namespaceField, "namespace-field", "kubernetes.namespace_name", "field holding the namespace")
+	fs.StringVar(&f.podField, "pod-field", "kubernetes.pod_name", "field holding the pod name")
+}
+
+// check returns the problem with the flags, if any.
+func (f *victoriaLogsFlags) check() error {
+	if f.addr == "" {
+		return fmt.Errorf("--addr is required")
+	}
+	if f.passwordFrom != "" && f.tokenFrom != "" {
+		return fmt.Errorf("--password-from and --token-from cannot be used together")
+	}
+	return nil
+}
+
+// credentialRefs returns the credentials the flags refer to.
+func (f *victoriaLogsFlags) credentialRefs() []string {
+	return []string{f.passwordFrom, f.tokenFrom}
+}
+
+// client returns the client of the flags, reading Secrets with clientset.
+func (f *victoriaLogsFlags) client(clientset *kubernetes.Clientset) *victoriaLogsClient {
+	client := &victoriaLogsClient{addr: f.addr, accountID: f.accountID, projectID: f.projectID, username: f.username, client: &http.Client{}}
+
+	var err error
+	if f.passwordFrom != "" {
+		if client.password, err = readCredential(f.passwordFrom, clientset); err != nil {
+			fatal("Failed to read the VictoriaLogs password", "error", err)
+		}
+	}
+	if f.tokenFrom != "" {
+		if client.token, err = readCredential(f.tokenFrom, clientset); err != nil {
+			fatal("Failed to read the VictoriaLogs token", "error", err)
+		}
+	}
+
+	return client
+}
+
+// runFilter returns the LogsQL filter of the logs whose runIDField is runID.
+func (f *victoriaLogsFlags) runFilter(runID string) string {
+	return fmt.Sprintf(`%q:=%q`, f.runIDField, runID)
+}
+
+// query runs the LogsQL query on the logs since the given time and returns
+// its rows, streamed as one JSON object per line.
+func (c *victoriaLogsClient) query(ctx context.Context, query string, since time.Time) ([]map[string]string, error) {
+	form := url.Values{}
+	form.Set("query", query)
+	form.Set("start", since.UTC().Format(time.RFC3339))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.addr, "/")+"/select/logsql/query", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.accountID != "" {
+		req.Header.Set("AccountID", c.accountID)
+	}
+	if c.projectID != "" {
+		req.Header.Set("ProjectID", c.projectID)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("query: %w", responseError(resp, body))
+	}
+
+	var rows []map[string]string
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var row map[string]string
+		if err := decoder.Decode(&row); err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("query: %w", err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// countLines returns the number of logs per pod matching filter since the
+// given time, grouped by namespaceField and podField, querying through
+// queries.
+func (c *victoriaLogsClient) countLines(ctx context.Context, queries *backendQueries, filter, namespaceField, podField string, since time.Time) (map[podRef]int64, error) {
+	var rows []map[string]string
+	err := queries.do(ctx, "query", func() (err error) {
+		rows, err = c.query(ctx, fmt.Sprintf(`%s | stats by (%q, %q) count() as lines`, filter, namespaceField, podField), since)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[podRef]int64)
+	for _, row := range rows {
+		count, err := strconv.ParseInt(row["lines"], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("query: count of pod %s/%s: %w", row[namespaceField], row[podField], err)
+		}
+		counts[podRef{Namespace: row[namespaceField], Name: row[podField]}] += count
+	}
+
+	return counts, nil
+}
+
+// recentLines returns the message of the newest limit logs matching filter
+// that carry an emission timestamp, since the given time.
+func (c *victoriaLogsClient) recentLines(ctx context.Context, filter string, since time.Time, limit int) ([]string, error) {
+	rows, err := c.query(ctx, fmt.Sprintf(`%s %q | sort by (_time desc) | limit %d`, filter, emissionTimestampKey, limit), since)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, row["_msg"])
+	}
+	return lines, nil
+}
+
+// verifyVictoriaLogs implements verify victorialogs.
+func verifyVictoriaLogs(configFile string, args []string) int {
+	var options verifyOptions
+	var vl victoriaLogsFlags
+	fs := flag.NewFlagSet("verify victorialogs", flag.ContinueOnError)
+	options.register(fs)
+	vl.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := vl.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := options.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	clientsets, generated := verifyClusters(configFile, options.runID)
+	client := vl.client(clientsets[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.timeout)
+	defer cancel()
+
+	received, err := client.countLines(ctx, newBackendQueries("VictoriaLogs", options), vl.runFilter(options.runID), vl.namespaceField, vl.podField, generated.since.Add(-verifyQueryMargin))
+	if err != nil {
+		fatal("Failed to query VictoriaLogs", "addr", vl.addr, "error", err)
+	}
+	slog.Debug("Queried VictoriaLogs", "pods", len(received))
+
+	return reportVerification("VictoriaLogs", compareLines(generated, received), options)
+}
+
+// latencyVictoriaLogs implements latency victorialogs.
+func latencyVictoriaLogs(configFile string, args []string) int {
+	var options latencyOptions
+	var vl victoriaLogsFlags
+	fs := flag.NewFlagSet("latency victorialogs", flag.ContinueOnError)
+	options.register(fs)
+	vl.register(fs)
+	runID := fs.String("run-id", "", "ID of the run to sample, as logged when it started")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := vl.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *runID == "" {
+		fmt.Fprintln(os.Stderr, "--run-id is required")
+		return 2
+	}
+
+	config := loadConfig(configFile)
+	client := vl.client(secretClient(config, vl.credentialRefs()))
+
+	return measureLatency("VictoriaLogs", options, func(ctx context.Context, since time.Time) ([]string, error) {
+		return client.recentLines(ctx, vl.runFilter(*runID), since, options.samples)
+	})
+}